@@ -0,0 +1,502 @@
+package unstruct
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/gabriel-vasile/mimetype"
+)
+
+// ErrArchiveLimit is returned when an archive violates one of its safety limits.
+var ErrArchiveLimit = errors.New("archive limit exceeded")
+
+// ArchiveFormat identifies the container format of an ArchiveAsset
+type ArchiveFormat string
+
+const (
+	ArchiveFormatAuto  ArchiveFormat = ""       // detect from magic bytes
+	ArchiveFormatZip   ArchiveFormat = "zip"    // PKZIP archive
+	ArchiveFormatTar   ArchiveFormat = "tar"    // uncompressed tarball
+	ArchiveFormatTarGz ArchiveFormat = "tar.gz" // gzip-compressed tarball
+)
+
+// ArchiveLimits bounds the work done while expanding an archive.
+// Zero values are replaced by the corresponding DefaultArchiveLimits value.
+type ArchiveLimits struct {
+	MaxEntries          int     // maximum number of entries, including skipped ones
+	MaxEntrySize        int64   // maximum uncompressed size of a single entry
+	MaxTotalSize        int64   // maximum uncompressed size of all entries combined, or of a whole tar.gz stream
+	MaxCompressionRatio float64 // maximum uncompressed/compressed ratio
+}
+
+// DefaultArchiveLimits returns conservative limits that protect against zip bombs.
+func DefaultArchiveLimits() ArchiveLimits {
+	return ArchiveLimits{
+		MaxEntries:          1000,
+		MaxEntrySize:        32 << 20,  // 32 MiB
+		MaxTotalSize:        256 << 20, // 256 MiB
+		MaxCompressionRatio: 100,
+	}
+}
+
+// withDefaults fills zero fields from DefaultArchiveLimits
+func (l ArchiveLimits) withDefaults() ArchiveLimits {
+	d := DefaultArchiveLimits()
+	if l.MaxEntries <= 0 {
+		l.MaxEntries = d.MaxEntries
+	}
+	if l.MaxEntrySize <= 0 {
+		l.MaxEntrySize = d.MaxEntrySize
+	}
+	if l.MaxTotalSize <= 0 {
+		l.MaxTotalSize = d.MaxTotalSize
+	}
+	if l.MaxCompressionRatio <= 0 {
+		l.MaxCompressionRatio = d.MaxCompressionRatio
+	}
+	return l
+}
+
+// ArchiveEntry is a single extracted file from an archive
+type ArchiveEntry struct {
+	Name     string // slash-separated path inside the archive
+	MimeType string
+	Data     []byte
+}
+
+// Asset maps the entry to the asset type matching its MIME type.
+// Textual entries become TextAssets, everything else is sent inline as a DataAsset.
+func (e ArchiveEntry) Asset() Asset {
+	if isTextMIMEType(e.MimeType) {
+		return NewTextAsset(string(e.Data))
+	}
+	return NewDataAsset(e.Data, e.MimeType)
+}
+
+// ArchiveAsset expands a ZIP or TAR archive into child assets.
+// The archive is read either from Reader/Size or from an already opened FS.
+type ArchiveAsset struct {
+	Reader io.ReaderAt
+	Size   int64
+	FS     fs.FS
+	Format ArchiveFormat
+
+	// Include and Exclude are path.Match globs. Patterns without a "/" are
+	// also matched against the base name, so "*.pdf" matches "docs/a.pdf".
+	Include []string
+	Exclude []string
+	Limits  ArchiveLimits
+}
+
+// CreateMessages implements Asset for archives.
+// Each entry becomes one message that starts with a filename marker, in path order.
+func (a *ArchiveAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Message, error) {
+	entries, err := a.Entries(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("archive contains no matching entries")
+	}
+
+	messages := make([]*Message, 0, len(entries))
+	for _, entry := range entries {
+		childMessages, err := entry.Asset().CreateMessages(ctx, log)
+		if err != nil {
+			return nil, fmt.Errorf("archive entry %s: %w", entry.Name, err)
+		}
+
+		parts := []*Part{NewTextPart(fmt.Sprintf("--- File: %s (%s) ---", entry.Name, entry.MimeType))}
+		for _, msg := range childMessages {
+			parts = append(parts, msg.Parts...)
+		}
+		messages = append(messages, NewUserMessage(parts...))
+	}
+
+	log.Debug("Expanded archive", "entries", len(entries), "messages", len(messages))
+	return messages, nil
+}
+
+// Assets returns one child asset per matching archive entry, in path order.
+func (a *ArchiveAsset) Assets(ctx context.Context, log *slog.Logger) ([]Asset, error) {
+	entries, err := a.Entries(ctx, log)
+	if err != nil {
+		return nil, err
+	}
+	assets := make([]Asset, 0, len(entries))
+	for _, entry := range entries {
+		assets = append(assets, entry.Asset())
+	}
+	return assets, nil
+}
+
+// Entries extracts all regular files that pass the include/exclude filters,
+// enforcing the configured limits. Entries are sorted by name.
+func (a *ArchiveAsset) Entries(ctx context.Context, log *slog.Logger) ([]ArchiveEntry, error) {
+	if log == nil {
+		log = slog.Default()
+	}
+
+	x := &archiveExtractor{asset: a, limits: a.Limits.withDefaults(), log: log}
+
+	var err error
+	switch {
+	case a.FS != nil:
+		err = x.walkFS(ctx, a.FS)
+	case a.Reader != nil:
+		format := a.Format
+		if format == ArchiveFormatAuto {
+			format, err = detectArchiveFormat(a.Reader, a.Size)
+			if err != nil {
+				return nil, err
+			}
+		}
+		log.Debug("Reading archive", "format", format, "size", a.Size)
+		switch format {
+		case ArchiveFormatZip:
+			err = x.walkZip(ctx, a.Reader, a.Size)
+		case ArchiveFormatTar:
+			err = x.walkTar(ctx, io.NewSectionReader(a.Reader, 0, a.Size), a.Size, false)
+		case ArchiveFormatTarGz:
+			err = x.walkTar(ctx, io.NewSectionReader(a.Reader, 0, a.Size), a.Size, true)
+		default:
+			err = fmt.Errorf("unsupported archive format %q", format)
+		}
+	default:
+		return nil, fmt.Errorf("ArchiveAsset requires either a Reader or an FS")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(x.entries, func(i, j int) bool { return x.entries[i].Name < x.entries[j].Name })
+	return x.entries, nil
+}
+
+// matches reports whether name passes the include/exclude filters
+func (a *ArchiveAsset) matches(name string) bool {
+	for _, pattern := range a.Exclude {
+		if globMatch(pattern, name) {
+			return false
+		}
+	}
+	if len(a.Include) == 0 {
+		return true
+	}
+	for _, pattern := range a.Include {
+		if globMatch(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func globMatch(pattern, name string) bool {
+	if ok, _ := path.Match(pattern, name); ok {
+		return true
+	}
+	if !strings.Contains(pattern, "/") {
+		ok, _ := path.Match(pattern, path.Base(name))
+		return ok
+	}
+	return false
+}
+
+// archiveExtractor accumulates entries while tracking limits
+type archiveExtractor struct {
+	asset   *ArchiveAsset
+	limits  ArchiveLimits
+	log     *slog.Logger
+	entries []ArchiveEntry
+	seen    int // entries visited, kept or not
+	total   int64
+}
+
+// visit counts one entry of the archive against MaxEntries, whether it is kept or not
+func (x *archiveExtractor) visit() error {
+	x.seen++
+	if x.seen > x.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrArchiveLimit, x.limits.MaxEntries)
+	}
+	return nil
+}
+
+// minRatioCheckSize is how much must be inflated before the compression ratio
+// of actual bytes is checked; padding alone gives tiny tarballs high ratios.
+const minRatioCheckSize = 1 << 20
+
+// inflatedReader fails once the bytes inflated from compressed bytes exceed max
+// or the compression ratio limit, however small the declared sizes are
+type inflatedReader struct {
+	r          io.Reader
+	name       string
+	n          int64 // bytes read so far
+	max        int64
+	compressed int64
+	ratio      float64
+}
+
+// inflated wraps r, the decompressed stream of name, so that the size and ratio
+// limits hold for the bytes actually read, including skipped entries
+func (x *archiveExtractor) inflated(name string, r io.Reader, compressed, max int64) io.Reader {
+	return &inflatedReader{r: r, name: name, max: max, compressed: compressed, ratio: x.limits.MaxCompressionRatio}
+}
+
+func (r *inflatedReader) Read(p []byte) (int, error) {
+	if room := r.max - r.n + 1; int64(len(p)) > room {
+		p = p[:room]
+	}
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	if r.n > r.max {
+		return n, fmt.Errorf("%w: %s inflates to more than %d bytes", ErrArchiveLimit, r.name, r.max)
+	}
+	if r.n > minRatioCheckSize && r.compressed > 0 && float64(r.n)/float64(r.compressed) > r.ratio {
+		return n, fmt.Errorf("%w: %s has compression ratio above %.0f", ErrArchiveLimit, r.name, r.ratio)
+	}
+	return n, err
+}
+
+// add reads one entry, enforcing the per-entry and total size limits
+func (x *archiveExtractor) add(ctx context.Context, name string, r io.Reader) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	limit := min(x.limits.MaxEntrySize, x.limits.MaxTotalSize-x.total)
+	data, err := io.ReadAll(io.LimitReader(r, limit+1))
+	if err != nil {
+		return fmt.Errorf("read %s: %w", name, err)
+	}
+	if int64(len(data)) > limit {
+		return fmt.Errorf("%w: %s exceeds size limit", ErrArchiveLimit, name)
+	}
+	x.total += int64(len(data))
+
+	if len(data) == 0 {
+		x.log.Debug("Skipping empty archive entry", "name", name)
+		return nil
+	}
+
+	mimeType := archiveEntryMIMEType(name, data)
+	if isArchiveMIMEType(mimeType) {
+		x.log.Debug("Skipping nested archive", "name", name, "mime_type", mimeType)
+		return nil
+	}
+
+	x.entries = append(x.entries, ArchiveEntry{Name: name, MimeType: mimeType, Data: data})
+	x.log.Debug("Extracted archive entry", "name", name, "size", len(data), "mime_type", mimeType)
+	return nil
+}
+
+// checkRatio rejects data that expanded too much relative to its compressed size
+func (x *archiveExtractor) checkRatio(name string, uncompressed, compressed int64) error {
+	if compressed <= 0 || uncompressed <= 0 {
+		return nil
+	}
+	if ratio := float64(uncompressed) / float64(compressed); ratio > x.limits.MaxCompressionRatio {
+		return fmt.Errorf("%w: %s has compression ratio %.0f (max %.0f)", ErrArchiveLimit, name, ratio, x.limits.MaxCompressionRatio)
+	}
+	return nil
+}
+
+func (x *archiveExtractor) walkZip(ctx context.Context, r io.ReaderAt, size int64) error {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return fmt.Errorf("open zip archive: %w", err)
+	}
+	for _, f := range zr.File {
+		if err := x.visit(); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() || !f.Mode().IsRegular() || !x.asset.matches(f.Name) {
+			continue
+		}
+		// Declared sizes can lie; they only reject early, the reader below and
+		// add() enforce the limits on the bytes actually inflated.
+		if f.UncompressedSize64 > uint64(x.limits.MaxEntrySize) {
+			return fmt.Errorf("%w: %s declares %d bytes", ErrArchiveLimit, f.Name, f.UncompressedSize64)
+		}
+		if err := x.checkRatio(f.Name, int64(f.UncompressedSize64), int64(f.CompressedSize64)); err != nil {
+			return err
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return fmt.Errorf("open %s: %w", f.Name, err)
+		}
+		err = x.add(ctx, f.Name, x.inflated(f.Name, rc, int64(f.CompressedSize64), x.limits.MaxEntrySize))
+		_ = rc.Close() // Best effort close, data is already read
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *archiveExtractor) walkTar(ctx context.Context, r io.Reader, size int64, gzipped bool) error {
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return fmt.Errorf("open gzip stream: %w", err)
+		}
+		defer func() {
+			_ = gz.Close() // Best effort close, ignore error in defer
+		}()
+		// tar.Reader inflates skipped entries too, so the whole stream is bounded
+		r = x.inflated("archive", gz, size, x.limits.MaxTotalSize)
+	}
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read tar archive: %w", err)
+		}
+		if err := x.visit(); err != nil {
+			return err
+		}
+		name := strings.TrimPrefix(hdr.Name, "./")
+		if hdr.Typeflag != tar.TypeReg || !x.asset.matches(name) {
+			continue
+		}
+		if hdr.Size > x.limits.MaxEntrySize {
+			return fmt.Errorf("%w: %s declares %d bytes", ErrArchiveLimit, name, hdr.Size)
+		}
+		if err := x.add(ctx, name, tr); err != nil {
+			return err
+		}
+	}
+}
+
+func (x *archiveExtractor) walkFS(ctx context.Context, fsys fs.FS) error {
+	return fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if name == "." {
+			return nil
+		}
+		if err := x.visit(); err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !x.asset.matches(name) {
+			return nil
+		}
+		f, err := fsys.Open(name)
+		if err != nil {
+			return fmt.Errorf("open %s: %w", name, err)
+		}
+		err = x.add(ctx, name, f)
+		_ = f.Close() // Best effort close, data is already read
+		return err
+	})
+}
+
+// detectArchiveFormat sniffs the magic bytes at the start of the archive
+func detectArchiveFormat(r io.ReaderAt, size int64) (ArchiveFormat, error) {
+	header := make([]byte, min(size, 512))
+	n, err := r.ReadAt(header, 0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", fmt.Errorf("read archive header: %w", err)
+	}
+	header = header[:n]
+
+	switch {
+	case bytes.HasPrefix(header, []byte("PK\x03\x04")), bytes.HasPrefix(header, []byte("PK\x05\x06")):
+		return ArchiveFormatZip, nil
+	case bytes.HasPrefix(header, []byte{0x1f, 0x8b}):
+		return ArchiveFormatTarGz, nil
+	case len(header) >= 262 && string(header[257:262]) == "ustar":
+		return ArchiveFormatTar, nil
+	default:
+		return "", fmt.Errorf("unrecognised archive format")
+	}
+}
+
+// archiveEntryMIMEType prefers the extension and falls back to content sniffing
+func archiveEntryMIMEType(name string, data []byte) string {
+	if mimeType := mimeTypeFromExtension(name); mimeType != "application/octet-stream" {
+		return mimeType
+	}
+	mimeType, _, _ := strings.Cut(mimetype.Detect(data).String(), ";")
+	return mimeType
+}
+
+func isTextMIMEType(mimeType string) bool {
+	if strings.HasPrefix(mimeType, "text/") {
+		return true
+	}
+	switch mimeType {
+	case "application/json", "application/xml", "application/javascript":
+		return true
+	}
+	return false
+}
+
+func isArchiveMIMEType(mimeType string) bool {
+	switch mimeType {
+	case "application/zip", "application/x-tar", "application/gzip", "application/x-gzip":
+		return true
+	}
+	return false
+}
+
+// NewArchiveAsset creates an asset that expands the ZIP or TAR archive read from r
+func NewArchiveAsset(r io.ReaderAt, size int64, options ...func(*ArchiveAsset)) *ArchiveAsset {
+	asset := &ArchiveAsset{Reader: r, Size: size}
+	for _, opt := range options {
+		opt(asset)
+	}
+	return asset
+}
+
+// NewArchiveAssetFromFS creates an asset that expands every file of fsys,
+// e.g. a *zip.Reader or os.DirFS of an unpacked archive
+func NewArchiveAssetFromFS(fsys fs.FS, options ...func(*ArchiveAsset)) *ArchiveAsset {
+	asset := &ArchiveAsset{FS: fsys}
+	for _, opt := range options {
+		opt(asset)
+	}
+	return asset
+}
+
+// WithArchiveFormat forces the archive format instead of detecting it
+func WithArchiveFormat(format ArchiveFormat) func(*ArchiveAsset) {
+	return func(a *ArchiveAsset) {
+		a.Format = format
+	}
+}
+
+// WithArchiveInclude only extracts entries matching one of the glob patterns
+func WithArchiveInclude(patterns ...string) func(*ArchiveAsset) {
+	return func(a *ArchiveAsset) {
+		a.Include = append(a.Include, patterns...)
+	}
+}
+
+// WithArchiveExclude skips entries matching any of the glob patterns
+func WithArchiveExclude(patterns ...string) func(*ArchiveAsset) {
+	return func(a *ArchiveAsset) {
+		a.Exclude = append(a.Exclude, patterns...)
+	}
+}
+
+// WithArchiveLimits overrides the default extraction limits
+func WithArchiveLimits(limits ArchiveLimits) func(*ArchiveAsset) {
+	return func(a *ArchiveAsset) {
+		a.Limits = limits
+	}
+}
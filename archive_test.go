@@ -0,0 +1,203 @@
+package unstruct
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func buildZip(t *testing.T, files map[string][]byte) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, data := range files {
+		w, err := zw.Create(name)
+		require.NoError(t, err)
+		_, err = w.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, zw.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func buildTarGz(t *testing.T, files map[string][]byte) *bytes.Reader {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for name, data := range files {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}))
+		_, err := tw.Write(data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+	return bytes.NewReader(buf.Bytes())
+}
+
+func TestArchiveAsset_Zip(t *testing.T) {
+	ctx := context.Background()
+	logger := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	r := buildZip(t, map[string][]byte{
+		"docs/b.txt":   []byte("second"),
+		"docs/a.txt":   []byte("first"),
+		"img/logo.png": pngHeader,
+		"nested.zip":   []byte("PK\x03\x04"),
+		"empty.txt":    {},
+	})
+	asset := NewArchiveAsset(r, r.Size())
+
+	messages, err := asset.CreateMessages(ctx, logger)
+	require.NoError(t, err)
+	require.Len(t, messages, 3)
+
+	assert.Equal(t, "--- File: docs/a.txt (text/plain) ---", messages[0].Parts[0].Text)
+	assert.Equal(t, "first", messages[0].Parts[1].Text)
+	assert.Equal(t, "--- File: docs/b.txt (text/plain) ---", messages[1].Parts[0].Text)
+	assert.Equal(t, "image", messages[2].Parts[1].Type)
+	assert.Equal(t, "image/png", messages[2].Parts[1].MimeType)
+}
+
+func TestArchiveAsset_TarGz(t *testing.T) {
+	r := buildTarGz(t, map[string][]byte{
+		"./report.json": []byte(`{"ok":true}`),
+		"notes.md":      []byte("# Notes"),
+	})
+	asset := NewArchiveAsset(r, r.Size())
+
+	entries, err := asset.Entries(context.Background(), nil)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "notes.md", entries[0].Name)
+	assert.Equal(t, "report.json", entries[1].Name)
+	assert.Equal(t, "application/json", entries[1].MimeType)
+	assert.IsType(t, &TextAsset{}, entries[1].Asset())
+}
+
+func TestArchiveAsset_FS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/invoice.pdf": {Data: []byte("%PDF-1.4")},
+		"a/readme.txt":  {Data: []byte("hello")},
+		"b/photo.png":   {Data: pngHeader},
+	}
+
+	t.Run("include", func(t *testing.T) {
+		asset := NewArchiveAssetFromFS(fsys, WithArchiveInclude("*.pdf", "b/*"))
+		assets, err := asset.Assets(context.Background(), nil)
+		require.NoError(t, err)
+		require.Len(t, assets, 2)
+		assert.Equal(t, "application/pdf", assets[0].(*DataAsset).MimeType)
+		assert.Equal(t, "image/png", assets[1].(*DataAsset).MimeType)
+	})
+
+	t.Run("exclude", func(t *testing.T) {
+		asset := NewArchiveAssetFromFS(fsys, WithArchiveExclude("a/*"))
+		entries, err := asset.Entries(context.Background(), nil)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "b/photo.png", entries[0].Name)
+	})
+
+	t.Run("no matches", func(t *testing.T) {
+		asset := NewArchiveAssetFromFS(fsys, WithArchiveInclude("*.docx"))
+		_, err := asset.CreateMessages(context.Background(), slog.Default())
+		assert.Error(t, err)
+	})
+}
+
+func TestArchiveAsset_Limits(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("compression ratio", func(t *testing.T) {
+		r := buildZip(t, map[string][]byte{"bomb.txt": []byte(strings.Repeat("0", 1<<20))})
+		_, err := NewArchiveAsset(r, r.Size()).Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+	})
+
+	t.Run("entry size", func(t *testing.T) {
+		r := buildTarGz(t, map[string][]byte{"big.txt": []byte(strings.Repeat("x", 2048))})
+		asset := NewArchiveAsset(r, r.Size(), WithArchiveLimits(ArchiveLimits{MaxEntrySize: 1024, MaxCompressionRatio: 1000}))
+		_, err := asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+	})
+
+	t.Run("entry count", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"1.txt": {Data: []byte("a")},
+			"2.txt": {Data: []byte("b")},
+			"3.txt": {Data: []byte("c")},
+		}
+		asset := NewArchiveAssetFromFS(fsys, WithArchiveLimits(ArchiveLimits{MaxEntries: 2}))
+		_, err := asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+	})
+
+	t.Run("total size", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"1.txt": {Data: []byte("aaaa")},
+			"2.txt": {Data: []byte("bbbb")},
+		}
+		asset := NewArchiveAssetFromFS(fsys, WithArchiveLimits(ArchiveLimits{MaxTotalSize: 6}))
+		_, err := asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+	})
+}
+
+func TestArchiveAsset_LimitsOnActualBytes(t *testing.T) {
+	ctx := context.Background()
+	zeros := bytes.Repeat([]byte{0}, 4<<20)
+
+	t.Run("skipped tar.gz entry", func(t *testing.T) {
+		r := buildTarGz(t, map[string][]byte{"bomb.bin": zeros, "a.txt": []byte("kept")})
+		asset := NewArchiveAsset(r, r.Size(), WithArchiveInclude("*.txt"))
+		_, err := asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit, "the ratio holds for entries that are not kept")
+
+		asset = NewArchiveAsset(r, r.Size(), WithArchiveInclude("*.txt"),
+			WithArchiveLimits(ArchiveLimits{MaxTotalSize: 1 << 20, MaxCompressionRatio: 1e9}))
+		_, err = asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit, "the total size holds for the whole stream")
+	})
+
+	t.Run("inflated reader", func(t *testing.T) {
+		// archive/zip already stops at an entry's declared size; the reader
+		// bounds what the declared sizes let through
+		x := &archiveExtractor{limits: DefaultArchiveLimits()}
+		_, err := io.ReadAll(x.inflated("bomb.txt", bytes.NewReader(zeros), 4<<10, 32<<20))
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+		assert.ErrorContains(t, err, "bomb.txt has compression ratio above 100")
+
+		data, err := io.ReadAll(x.inflated("small.txt", bytes.NewReader(zeros[:100]), 1, 100))
+		require.NoError(t, err, "small outputs pass whatever their ratio")
+		assert.Len(t, data, 100)
+		_, err = io.ReadAll(x.inflated("big.txt", bytes.NewReader(zeros[:101]), 101, 100))
+		assert.ErrorContains(t, err, "big.txt inflates to more than 100 bytes")
+	})
+
+	t.Run("skipped entries count", func(t *testing.T) {
+		r := buildZip(t, map[string][]byte{"a.txt": []byte("a"), "b.bin": []byte("b"), "c.bin": []byte("c")})
+		asset := NewArchiveAsset(r, r.Size(), WithArchiveInclude("*.txt"), WithArchiveLimits(ArchiveLimits{MaxEntries: 2}))
+		_, err := asset.Entries(ctx, nil)
+		assert.ErrorIs(t, err, ErrArchiveLimit)
+	})
+}
+
+func TestArchiveAsset_UnknownFormat(t *testing.T) {
+	r := bytes.NewReader([]byte("definitely not an archive"))
+	_, err := NewArchiveAsset(r, r.Size()).Entries(context.Background(), nil)
+	assert.Error(t, err)
+}
@@ -9,6 +9,8 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/gabriel-vasile/mimetype"
@@ -51,8 +53,9 @@ func (t *TextAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Me
 
 // DataAsset represents an image document
 type DataAsset struct {
-	Data     []byte
-	MimeType string
+	Data       []byte
+	MimeType   string
+	Preprocess *ImagePreprocessing // optional resize/orient/tile pipeline for images
 }
 
 // CreateMessages implements Asset for image content
@@ -60,6 +63,14 @@ func (i *DataAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Me
 	if len(i.Data) == 0 {
 		return nil, errors.New("image data is empty")
 	}
+	if i.Preprocess != nil {
+		parts, err := PreprocessImage(i.Data, i.MimeType, *i.Preprocess)
+		if err != nil {
+			return nil, err
+		}
+		log.Debug("Preprocessed image", "original_size", len(i.Data), "parts", len(parts))
+		return []*Message{NewUserMessage(parts...)}, nil
+	}
 	part := &Part{
 		Type:     "image",
 		Data:     i.Data,
@@ -97,12 +108,18 @@ type FileAsset struct {
 	client      *genai.Client // injected for file upload
 
 	// Advanced features
-	AutoCleanup      bool
-	IncludeMetadata  bool
-	RetentionDays    int
-	Metadata         *FileMetadata
-	ProgressCallback ProgressCallback
-	uploadedFile     *genai.File // cached uploaded file reference
+	AutoCleanup       bool
+	IncludeMetadata   bool
+	RetentionDays     int           // re-upload and allow Cleanup to delete after this many days; 0 → Files API expiry only
+	ActivationTimeout time.Duration // how long to wait for the file to become ACTIVE; 0 → DefaultFileActivationTimeout
+	PollInterval      time.Duration // delay between state checks; 0 → DefaultFilePollInterval
+	Metadata          *FileMetadata
+	ProgressCallback  ProgressCallback
+	UploadCache       UploadCache // optional cache shared across assets and processes
+	uploadedFile      *genai.File // cached uploaded file reference
+	uploadedAt        time.Time   // when uploadedFile was uploaded
+	cacheKey          UploadCacheKey
+	reused            bool // the last CreateMessages used an existing upload
 }
 
 // CreateMessages implements Asset for file content
@@ -130,77 +147,60 @@ func (f *FileAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Me
 		}
 	}
 
-	// Use cached uploaded file if available
-	var file *genai.File
-	if f.uploadedFile != nil {
-		file = f.uploadedFile
-		log.Debug("Using cached uploaded file", "uri", file.URI)
-	} else {
-		// Determine MIME type if not provided
-		mimeType := f.MimeType
-		if mimeType == "" {
-			mimeType = getMIMETypeFromPath(f.Path)
+	// Drop a cached upload that expired or outlived its retention window
+	if f.uploadedFile != nil && fileExpired(f.uploadedFile, f.uploadedAt, f.RetentionDays, time.Now()) {
+		log.Debug("Cached upload expired, uploading again", "name", f.uploadedFile.Name)
+		if err := deleteUploadedFile(ctx, f.client, f.uploadedFile); err != nil {
+			log.Warn("Failed to delete expired upload", "name", f.uploadedFile.Name, "error", err)
 		}
-
-		// Set display name if not provided
-		displayName := f.DisplayName
-		if displayName == "" {
-			displayName = fmt.Sprintf("File Upload - %s", filepath.Base(f.Path))
+		if err := f.forgetCachedUpload(ctx); err != nil {
+			log.Warn("Failed to remove expired upload from cache", "name", f.uploadedFile.Name, "error", err)
 		}
+		f.uploadedFile = nil
+	}
 
-		// Call progress callback if provided
-		if f.ProgressCallback != nil {
-			f.ProgressCallback(0, 1, f.Path)
-		}
+	// Determine MIME type if not provided
+	mimeType := f.MimeType
+	if mimeType == "" {
+		mimeType = getMIMETypeFromPath(f.Path)
+	}
 
-		// Upload file to Files API
-		log.Debug("Uploading file to Files API", "path", f.Path, "mime_type", mimeType)
-		file, err = f.client.Files.UploadFromPath(ctx, f.Path, &genai.UploadFileConfig{
-			MIMEType:    mimeType,
-			DisplayName: displayName,
-		})
-		if err != nil {
-			return nil, fmt.Errorf("failed to upload file %s: %w", f.Path, err)
+	// Use cached uploaded file if available
+	file := f.uploadedFile
+	f.reused = file != nil
+	if file != nil {
+		log.Debug("Using cached uploaded file", "uri", file.URI)
+	} else {
+		// Reuse an upload of identical content from the shared cache
+		if f.UploadCache != nil {
+			file = f.lookupUploadCache(ctx, metadata, mimeType, log)
+			f.reused = file != nil
 		}
 
-		log.Debug("File uploaded", "uri", file.URI, "name", file.Name, "state", file.State, "mime_type", file.MIMEType)
+		if file == nil {
+			file, err = f.upload(ctx, mimeType, log)
+			if err != nil {
+				return nil, err
+			}
 
-		// Check if file is ready to use
-		if file.State != "ACTIVE" {
-			log.Warn("File is not in ACTIVE state", "state", file.State, "uri", file.URI)
-			// For now, we'll continue anyway, but this might be the issue
+			if f.UploadCache != nil && f.cacheKey.Checksum != "" {
+				if err := f.UploadCache.Put(ctx, f.cacheKey, newUploadCacheEntry(file, f.uploadedAt)); err != nil {
+					log.Warn("Failed to store upload in cache", "path", f.Path, "error", err)
+				}
+			}
 		}
 
-		// Cache the uploaded file reference
-		f.uploadedFile = file
-
 		// Update metadata with upload information
 		if metadata != nil {
 			metadata.FileURI = file.URI
 			metadata.FileName = file.Name
-			metadata.UploadedAt = time.Now()
+			metadata.UploadedAt = f.uploadedAt
 			f.Metadata = metadata
 		}
-
-		// Call progress callback completion
-		if f.ProgressCallback != nil {
-			f.ProgressCallback(1, 1, f.Path)
-		}
-
-		log.Debug("File upload completed", "uri", file.URI, "name", file.Name, "state", file.State)
-	}
-
-	// Create message with file part that references the uploaded file
-	var filePart *Part
-
-	// Determine the MIME type for the file part
-	mimeType := f.MimeType
-	if mimeType == "" {
-		mimeType = getMIMETypeFromPath(f.Path)
 	}
 
 	// Create file part that references the uploaded file URI
-	filePart = NewFilePart(file.URI, mimeType)
+	filePart := NewFilePart(file.URI, mimeType)
 
 	log.Debug("Created file part", "uri", file.URI, "mime_type", mimeType, "part_type", filePart.Type)
 
@@ -223,12 +223,111 @@ func (f *FileAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Me
 	return []*Message{NewUserMessage(filePart)}, nil
 }
 
-// generateFileMetadata creates detailed file metadata
-func (f *FileAsset) generateFileMetadata(fileInfo os.FileInfo) (*FileMetadata, error) {
-	// Calculate checksum
-	file, err := os.Open(f.Path)
+// upload sends the file to the Files API and waits until it is ACTIVE
+func (f *FileAsset) upload(ctx context.Context, mimeType string, log *slog.Logger) (*genai.File, error) {
+	// Set display name if not provided
+	displayName := f.DisplayName
+	if displayName == "" {
+		displayName = fmt.Sprintf("File Upload - %s", filepath.Base(f.Path))
+	}
+
+	// Call progress callback if provided
+	if f.ProgressCallback != nil {
+		f.ProgressCallback(0, 1, f.Path)
+	}
+
+	// Upload file to Files API
+	log.Debug("Uploading file to Files API", "path", f.Path, "mime_type", mimeType)
+	file, err := f.client.Files.UploadFromPath(ctx, f.Path, &genai.UploadFileConfig{
+		MIMEType:    mimeType,
+		DisplayName: displayName,
+	})
 	if err != nil {
-		return nil, fmt.Errorf("failed to open file for checksum: %w", err)
+		return nil, fmt.Errorf("failed to upload file %s: %w", f.Path, err)
+	}
+
+	log.Debug("File uploaded", "uri", file.URI, "name", file.Name, "state", file.State, "mime_type", file.MIMEType)
+
+	uploadedAt := time.Now()
+
+	// Files must finish processing before a model can reference them
+	file, err = waitForFileActive(ctx, f.client, file, f.ActivationTimeout, f.PollInterval, log)
+	if err != nil {
+		return nil, fmt.Errorf("file %s: %w", f.Path, err)
+	}
+
+	// Cache the uploaded file reference
+	f.uploadedFile = file
+	f.uploadedAt = uploadedAt
+
+	// Call progress callback completion
+	if f.ProgressCallback != nil {
+		f.ProgressCallback(1, 1, f.Path)
+	}
+
+	log.Debug("File upload completed", "uri", file.URI, "name", file.Name, "state", file.State)
+	return file, nil
+}
+
+// lookupUploadCache returns a still-valid upload of identical content, or nil.
+// A hit is checked with the Files API first, since the upload may have been
+// deleted since it was cached; entries for missing or inactive files are
+// dropped. Cache failures are logged and treated as a miss so extraction can
+// proceed with an upload.
+func (f *FileAsset) lookupUploadCache(ctx context.Context, metadata *FileMetadata, mimeType string, log *slog.Logger) *genai.File {
+	key, err := f.uploadCacheKey(metadata, mimeType)
+	if err != nil {
+		log.Warn("Failed to compute upload cache key", "path", f.Path, "error", err)
+		return nil
+	}
+	f.cacheKey = key
+
+	entry, ok, err := f.UploadCache.Get(ctx, key)
+	if err != nil {
+		log.Warn("Upload cache lookup failed", "path", f.Path, "error", err)
+		return nil
+	}
+	if !ok {
+		log.Debug("Upload cache miss", "path", f.Path, "checksum", key.Checksum)
+		return nil
+	}
+
+	file, err := f.client.Files.Get(ctx, entry.Name, nil)
+	if err != nil && !fileNotFound(err) {
+		log.Warn("Failed to verify cached upload", "path", f.Path, "name", entry.Name, "error", err)
+		return nil
+	}
+	if err != nil || file.State != genai.FileStateActive {
+		log.Debug("Cached upload is gone, uploading again", "path", f.Path, "name", entry.Name)
+		if err := f.UploadCache.Delete(ctx, key); err != nil {
+			log.Warn("Failed to remove stale upload from cache", "path", f.Path, "error", err)
+		}
+		return nil
+	}
+
+	f.uploadedFile = entry.file()
+	f.uploadedAt = entry.UploadedAt
+	log.Debug("Reusing upload from cache", "path", f.Path, "name", entry.Name, "checksum", key.Checksum)
+	return f.uploadedFile
+}
+
+// uploadCacheKey derives the content-addressed cache key, reusing the metadata checksum when present
+func (f *FileAsset) uploadCacheKey(metadata *FileMetadata, mimeType string) (UploadCacheKey, error) {
+	if metadata != nil && metadata.Checksum != "" {
+		return UploadCacheKey{Checksum: metadata.Checksum, MIMEType: mimeType}, nil
+	}
+	checksum, err := fileChecksum(f.Path)
+	if err != nil {
+		return UploadCacheKey{}, err
+	}
+	return UploadCacheKey{Checksum: checksum, MIMEType: mimeType}, nil
+}
+
+// fileChecksum returns the hex-encoded SHA-256 of the file at path
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to open file for checksum: %w", err)
 	}
 	defer func() {
 		_ = file.Close() // Best effort close, ignore error in defer
@@ -236,10 +335,18 @@ func (f *FileAsset) generateFileMetadata(fileInfo os.FileInfo) (*FileMetadata, e
 
 	hasher := sha256.New()
 	if _, err := io.Copy(hasher, file); err != nil {
-		return nil, fmt.Errorf("failed to calculate checksum: %w", err)
+		return "", fmt.Errorf("failed to calculate checksum: %w", err)
 	}
+	return fmt.Sprintf("%x", hasher.Sum(nil)), nil
+}
 
-	checksum := fmt.Sprintf("%x", hasher.Sum(nil))
+// generateFileMetadata creates detailed file metadata
+func (f *FileAsset) generateFileMetadata(fileInfo os.FileInfo) (*FileMetadata, error) {
+	// Calculate checksum
+	checksum, err := fileChecksum(f.Path)
+	if err != nil {
+		return nil, err
+	}
 
 	// Determine MIME type
 	mimeType := f.MimeType
@@ -258,14 +365,28 @@ func (f *FileAsset) generateFileMetadata(fileInfo os.FileInfo) (*FileMetadata, e
 }
 
 // Cleanup removes the uploaded file from the Files API if AutoCleanup is enabled
+// or the file has outlived RetentionDays
 func (f *FileAsset) Cleanup(ctx context.Context) error {
-	if !f.AutoCleanup || f.uploadedFile == nil {
+	if f.uploadedFile == nil {
 		return nil
 	}
+	if !f.AutoCleanup && !fileExpired(f.uploadedFile, f.uploadedAt, f.RetentionDays, time.Now()) {
+		return nil
+	}
+
+	if err := deleteUploadedFile(ctx, f.client, f.uploadedFile); err != nil {
+		return err
+	}
+	f.uploadedFile = nil
+	return f.forgetCachedUpload(ctx)
+}
 
-	// Note: The Files API doesn't provide a direct delete method in the current genai library
-	// This would need to be implemented when the API becomes available
-	return nil
+// forgetCachedUpload drops the cache entry pointing at this asset's upload
+func (f *FileAsset) forgetCachedUpload(ctx context.Context) error {
+	if f.UploadCache == nil || f.cacheKey.Checksum == "" {
+		return nil
+	}
+	return f.UploadCache.Delete(ctx, f.cacheKey)
 }
 
 // URLAsset represents content from a URL
@@ -286,8 +407,19 @@ func NewTextAsset(content string) *TextAsset {
 }
 
 // NewDataAsset creates a new image asset
-func NewDataAsset(data []byte, mimeType string) *DataAsset {
-	return &DataAsset{Data: data, MimeType: mimeType}
+func NewDataAsset(data []byte, mimeType string, options ...func(*DataAsset)) *DataAsset {
+	asset := &DataAsset{Data: data, MimeType: mimeType}
+	for _, opt := range options {
+		opt(asset)
+	}
+	return asset
+}
+
+// WithImagePreprocessing enables the image preprocessing pipeline for the data asset
+func WithImagePreprocessing(p ImagePreprocessing) func(*DataAsset) {
+	return func(d *DataAsset) {
+		d.Preprocess = &p
+	}
 }
 
 // NewMultiModalAsset creates a new multi-modal asset
@@ -356,6 +488,28 @@ func WithRetentionDays(days int) func(*FileAsset) {
 	}
 }
 
+// WithUploadCache reuses uploads of identical content across assets and processes.
+// Combined with AutoCleanup, Cleanup also deletes uploads that other workers may still reference.
+func WithUploadCache(cache UploadCache) func(*FileAsset) {
+	return func(f *FileAsset) {
+		f.UploadCache = cache
+	}
+}
+
+// WithActivationTimeout sets how long to wait for an uploaded file to become ACTIVE
+func WithActivationTimeout(timeout time.Duration) func(*FileAsset) {
+	return func(f *FileAsset) {
+		f.ActivationTimeout = timeout
+	}
+}
+
+// WithPollInterval sets the delay between file state checks while waiting for ACTIVE
+func WithPollInterval(interval time.Duration) func(*FileAsset) {
+	return func(f *FileAsset) {
+		f.PollInterval = interval
+	}
+}
+
 func AssetsFrom(content string) []Asset {
 	return []Asset{NewTextAsset(content)}
 }
@@ -369,8 +523,12 @@ func getMIMETypeFromPath(path string) string {
 	}
 
 	// Fallback to extension-based detection if file doesn't exist
-	ext := filepath.Ext(path)
-	switch ext {
+	return mimeTypeFromExtension(path)
+}
+
+// mimeTypeFromExtension maps well-known file extensions to MIME types
+func mimeTypeFromExtension(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
 	case ".txt":
 		return "text/plain"
 	case ".pdf":
@@ -407,22 +565,95 @@ func getMIMETypeFromPath(path string) string {
 		return "application/zip"
 	case ".tar":
 		return "application/x-tar"
-	case ".gz":
+	case ".gz", ".tgz":
 		return "application/gzip"
 	default:
 		return "application/octet-stream"
 	}
 }
 
-// BatchFileAsset represents multiple files for batch processing
+// DefaultBatchConcurrency is the number of parallel uploads used by BatchFileAsset
+const DefaultBatchConcurrency = 4
+
+// BatchFileStatus describes what happened to one file of a batch
+type BatchFileStatus string
+
+const (
+	BatchFileUploaded BatchFileStatus = "uploaded" // uploaded now or reused from an earlier upload
+	BatchFileSkipped  BatchFileStatus = "skipped"  // not attempted because the batch was aborted
+	BatchFileFailed   BatchFileStatus = "failed"   // upload or processing failed, see Err
+)
+
+// BatchFileResult reports the outcome for a single file of a BatchFileAsset
+type BatchFileResult struct {
+	Path   string
+	Status BatchFileStatus
+	Reused bool   // true when an earlier upload or an UploadCache entry was used instead of uploading again
+	URI    string // Files API URI when uploaded
+	Err    error  // cause when failed or skipped
+}
+
+// BatchUploadError is returned when a batch exceeds its failure tolerance.
+// It unwraps to the individual per-file causes.
+type BatchUploadError struct {
+	Results []BatchFileResult
+}
+
+func (e *BatchUploadError) Error() string {
+	var failed, skipped int
+	var first error
+	for _, r := range e.Results {
+		switch r.Status {
+		case BatchFileFailed:
+			failed++
+			if first == nil {
+				first = fmt.Errorf("%s: %w", r.Path, r.Err)
+			}
+		case BatchFileSkipped:
+			skipped++
+		}
+	}
+	msg := fmt.Sprintf("batch upload: %d of %d files failed", failed, len(e.Results))
+	if skipped > 0 {
+		msg += fmt.Sprintf(", %d skipped", skipped)
+	}
+	if first != nil {
+		msg += ": " + first.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the per-file errors
+func (e *BatchUploadError) Unwrap() []error {
+	var errs []error
+	for _, r := range e.Results {
+		if r.Status == BatchFileFailed && r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// BatchFileAsset represents multiple files for batch processing.
+// Files are uploaded concurrently; completed uploads are kept so that repeated
+// CreateMessages calls only retry files that failed before.
 type BatchFileAsset struct {
-	FilePaths        []string
-	client           *genai.Client
-	ProgressCallback ProgressCallback
-	AutoCleanup      bool
-	IncludeMetadata  bool
-	RetentionDays    int
-	uploadedFiles    []*genai.File // cached uploaded files
+	FilePaths         []string
+	client            *genai.Client
+	ProgressCallback  ProgressCallback
+	AutoCleanup       bool
+	IncludeMetadata   bool
+	RetentionDays     int
+	ActivationTimeout time.Duration
+	PollInterval      time.Duration
+	UploadCache       UploadCache
+	MaxConcurrency    int  // parallel uploads; 0 → DefaultBatchConcurrency
+	FailFast          bool // abort the batch on the first failure
+	MaxFailures       int  // > 0 → fail when more files fail; 0 → tolerate failures while at least one file succeeds
+
+	mu      sync.Mutex
+	files   map[string]*FileAsset // per-path assets holding uploads across calls
+	results []BatchFileResult     // outcome of the most recent run
 }
 
 // CreateMessages implements Asset for batch file content
@@ -435,53 +666,46 @@ func (b *BatchFileAsset) CreateMessages(ctx context.Context, log *slog.Logger) (
 		return nil, fmt.Errorf("no file paths provided")
 	}
 
-	var messages []*Message
-	var allMetadata []*FileMetadata
+	// Concurrent callers wait for the running batch and then reuse its uploads
+	b.mu.Lock()
+	defer b.mu.Unlock()
 
-	for i, filePath := range b.FilePaths {
-		// Call progress callback
-		if b.ProgressCallback != nil {
-			b.ProgressCallback(i, len(b.FilePaths), filePath)
-		}
+	perFile, results := b.uploadAll(ctx, log)
+	b.results = results
 
-		// Create individual FileAsset
-		fileAsset := &FileAsset{
-			Path:            filePath,
-			client:          b.client,
-			AutoCleanup:     b.AutoCleanup,
-			IncludeMetadata: b.IncludeMetadata,
-			RetentionDays:   b.RetentionDays,
+	var failed, succeeded int
+	for _, r := range results {
+		switch r.Status {
+		case BatchFileUploaded:
+			succeeded++
+		case BatchFileFailed:
+			failed++
+			log.Warn("Failed to process file", "path", r.Path, "error", r.Err)
 		}
+	}
+	log.Debug("Batch upload finished", "files", len(results), "succeeded", succeeded, "failed", failed)
 
-		// Process the file
-		fileMessages, err := fileAsset.CreateMessages(ctx, log)
-		if err != nil {
-			log.Warn("Failed to process file", "path", filePath, "error", err)
+	switch {
+	case b.FailFast && failed > 0,
+		b.MaxFailures > 0 && failed > b.MaxFailures,
+		succeeded == 0:
+		return nil, &BatchUploadError{Results: results}
+	}
+
+	var messages []*Message
+	var allMetadata []*FileMetadata
+	for i, fileMessages := range perFile {
+		if results[i].Status != BatchFileUploaded {
 			continue
 		}
-
 		messages = append(messages, fileMessages...)
 
 		// Collect metadata if available
-		if fileAsset.Metadata != nil {
-			allMetadata = append(allMetadata, fileAsset.Metadata)
-		}
-
-		// Store uploaded file reference
-		if fileAsset.uploadedFile != nil {
-			b.uploadedFiles = append(b.uploadedFiles, fileAsset.uploadedFile)
+		if md := b.files[b.FilePaths[i]].Metadata; md != nil {
+			allMetadata = append(allMetadata, md)
 		}
 	}
 
-	// Call final progress callback
-	if b.ProgressCallback != nil {
-		b.ProgressCallback(len(b.FilePaths), len(b.FilePaths), "")
-	}
-
-	if len(messages) == 0 {
-		return nil, fmt.Errorf("no files were successfully processed")
-	}
-
 	// If metadata is included, add a summary message
 	if b.IncludeMetadata && len(allMetadata) > 0 {
 		summaryText := fmt.Sprintf("\nBatch Processing Summary:\n- Total files processed: %d\n- Total size: %d bytes\n",
@@ -499,19 +723,136 @@ func (b *BatchFileAsset) CreateMessages(ctx context.Context, log *slog.Logger) (
 	return messages, nil
 }
 
-// Cleanup removes all uploaded files from the Files API if AutoCleanup is enabled
-func (b *BatchFileAsset) Cleanup(ctx context.Context) error {
-	if !b.AutoCleanup {
-		return nil
+// uploadAll processes every file with bounded concurrency and returns the
+// messages and result for each path, in FilePaths order
+func (b *BatchFileAsset) uploadAll(ctx context.Context, log *slog.Logger) ([][]*Message, []BatchFileResult) {
+	total := len(b.FilePaths)
+	perFile := make([][]*Message, total)
+	results := make([]BatchFileResult, total)
+
+	limit := b.MaxConcurrency
+	if limit <= 0 {
+		limit = DefaultBatchConcurrency
+	}
+
+	runCtx, abort := context.WithCancel(ctx)
+	defer abort()
+
+	var (
+		progressMu sync.Mutex
+		processed  int
+		wg         sync.WaitGroup
+		sem        = make(chan struct{}, limit)
+	)
+
+	for i, filePath := range b.FilePaths {
+		fileAsset := b.fileAsset(filePath)
+		result := BatchFileResult{Path: filePath}
+
+		// Acquire in FilePaths order so that an abort skips every file not yet started
+		sem <- struct{}{}
+		if err := runCtx.Err(); err != nil {
+			<-sem
+			result.Status, result.Err = BatchFileSkipped, err
+			results[i] = result
+			continue
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }() // release
+
+			fileMessages, err := fileAsset.CreateMessages(runCtx, log)
+			switch {
+			case err != nil && abortedByBatch(err, runCtx, ctx):
+				result.Status, result.Err = BatchFileSkipped, err
+			case err != nil:
+				result.Status, result.Err = BatchFileFailed, err
+				if b.FailFast {
+					abort()
+				}
+			default:
+				result.Status = BatchFileUploaded
+				result.Reused = fileAsset.reused
+				if fileAsset.uploadedFile != nil {
+					result.URI = fileAsset.uploadedFile.URI
+				}
+				perFile[i] = fileMessages
+			}
+			results[i] = result
+
+			// Call progress callback
+			if b.ProgressCallback != nil {
+				progressMu.Lock()
+				processed++
+				b.ProgressCallback(processed, total, filePath)
+				progressMu.Unlock()
+			}
+		}()
 	}
+	wg.Wait()
 
-	for _, file := range b.uploadedFiles {
-		// Note: The Files API doesn't provide a direct delete method in the current genai library
-		// This would need to be implemented when the API becomes available
-		_ = file
+	// Call final progress callback
+	if b.ProgressCallback != nil {
+		b.ProgressCallback(total, total, "")
 	}
+	return perFile, results
+}
+
+// abortedByBatch reports whether err only says that the file was interrupted
+// because another file failed in fail-fast mode. Files that fail for their own
+// reason meanwhile still count as failed.
+func abortedByBatch(err error, runCtx, ctx context.Context) bool {
+	return errors.Is(err, context.Canceled) && runCtx.Err() != nil && ctx.Err() == nil
+}
 
-	return nil
+// fileAsset returns the asset for path, creating it on first use
+func (b *BatchFileAsset) fileAsset(path string) *FileAsset {
+	if b.files == nil {
+		b.files = make(map[string]*FileAsset)
+	}
+	if fa, ok := b.files[path]; ok {
+		return fa
+	}
+	fa := &FileAsset{
+		Path:              path,
+		client:            b.client,
+		AutoCleanup:       b.AutoCleanup,
+		IncludeMetadata:   b.IncludeMetadata,
+		RetentionDays:     b.RetentionDays,
+		ActivationTimeout: b.ActivationTimeout,
+		PollInterval:      b.PollInterval,
+		UploadCache:       b.UploadCache,
+	}
+	b.files[path] = fa
+	return fa
+}
+
+// Results returns the per-file outcome of the most recent CreateMessages call
+func (b *BatchFileAsset) Results() []BatchFileResult {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]BatchFileResult(nil), b.results...)
+}
+
+// Cleanup removes all uploaded files from the Files API if AutoCleanup is enabled
+// or they have outlived RetentionDays. All deletions are attempted and their errors joined.
+func (b *BatchFileAsset) Cleanup(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var errs []error
+	for _, path := range b.FilePaths {
+		fileAsset, ok := b.files[path]
+		if !ok {
+			continue
+		}
+		if err := fileAsset.Cleanup(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
 }
 
 // NewBatchFileAsset creates a new batch file asset
@@ -553,3 +894,45 @@ func WithBatchRetentionDays(days int) func(*BatchFileAsset) {
 		b.RetentionDays = days
 	}
 }
+
+// WithBatchActivationTimeout sets how long to wait for each uploaded file to become ACTIVE
+func WithBatchActivationTimeout(timeout time.Duration) func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.ActivationTimeout = timeout
+	}
+}
+
+// WithBatchConcurrency sets the maximum number of parallel uploads
+func WithBatchConcurrency(n int) func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.MaxConcurrency = n
+	}
+}
+
+// WithBatchFailFast aborts the batch as soon as one file fails
+func WithBatchFailFast() func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.FailFast = true
+	}
+}
+
+// WithBatchMaxFailures tolerates up to n failed files before the batch fails
+func WithBatchMaxFailures(n int) func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.MaxFailures = n
+	}
+}
+
+// WithBatchUploadCache reuses uploads of identical content across assets and processes
+func WithBatchUploadCache(cache UploadCache) func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.UploadCache = cache
+	}
+}
+
+// WithBatchPollInterval sets the delay between file state checks while waiting for ACTIVE
+func WithBatchPollInterval(interval time.Duration) func(*BatchFileAsset) {
+	return func(b *BatchFileAsset) {
+		b.PollInterval = interval
+	}
+}
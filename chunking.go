@@ -0,0 +1,502 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultChunkTokens is the chunk budget used when ChunkingOptions.ChunkTokens is zero
+const DefaultChunkTokens = 8000
+
+// ChunkStrategy selects how long text assets are split into chunks
+type ChunkStrategy int
+
+const (
+	ChunkNone         ChunkStrategy = iota // chunking disabled
+	ChunkByTokens                          // fixed token windows, broken at whitespace
+	ChunkByParagraphs                      // blank-line separated paragraphs and markdown headings
+	ChunkByPages                           // form-feed separated pages
+)
+
+// MergeRule decides how per-chunk values of a field are combined
+type MergeRule int
+
+const (
+	MergeFirstNonEmpty MergeRule = iota // value from the earliest chunk that has one
+	MergeMajorityVote                   // most frequent value; ties go to the earliest chunk
+	MergeConcatDedupe                   // concatenate arrays, dropping duplicates
+	MergeReconcile                      // ask the model to reconcile the candidates
+)
+
+// ChunkingOptions configures map-reduce extraction over long documents.
+// Each prompt group runs once per chunk and the fragments are merged per field.
+type ChunkingOptions struct {
+	Strategy        ChunkStrategy
+	ChunkTokens     int                  // budget per chunk; 0 → DefaultChunkTokens
+	Overlap         int                  // tokens (ChunkByTokens) or paragraphs/pages repeated in the next chunk
+	Merge           MergeRule            // default merge rule
+	FieldMerge      map[string]MergeRule // per-field rules keyed by dotted JSON key
+	ReconcilePrompt string               // prompt label for MergeReconcile; "" → built-in prompt
+}
+
+// defaultReconcilePrompt is used by MergeReconcile when no prompt label is configured.
+// {{.Keys}} and {{.Candidates}} are replaced before the call.
+const defaultReconcilePrompt = `The fields {{.Keys}} were extracted separately from consecutive chunks of one document.
+For each field, reconcile the candidate values below into the single value that best describes the whole document.
+Respond with one JSON object containing exactly these fields.
+
+Candidates per field, in document order:
+{{.Candidates}}`
+
+func (c *ChunkingOptions) chunkTokens() int {
+	if c.ChunkTokens > 0 {
+		return c.ChunkTokens
+	}
+	return DefaultChunkTokens
+}
+
+func (c *ChunkingOptions) ruleFor(key string) MergeRule {
+	if rule, ok := c.FieldMerge[key]; ok {
+		return rule
+	}
+	return c.Merge
+}
+
+var (
+	paragraphBreak = regexp.MustCompile(`\n[ \t]*\n`)
+	headingLine    = regexp.MustCompile(`(?m)^#{1,6} `)
+)
+
+// ChunkText splits text according to opts. Text that fits into one chunk is returned unchanged.
+func ChunkText(text string, opts ChunkingOptions) []string {
+	if opts.Strategy == ChunkNone || EstimateTokensFromText(text) <= opts.chunkTokens() {
+		return []string{text}
+	}
+	return splitText(text, opts)
+}
+
+// splitText splits text with opts.Strategy even when it would fit one chunk
+func splitText(text string, opts ChunkingOptions) []string {
+	budget := opts.chunkTokens()
+	switch opts.Strategy {
+	case ChunkByParagraphs:
+		return packBlocks(splitParagraphs(text), budget, opts.Overlap, "\n\n")
+	case ChunkByPages:
+		return packBlocks(strings.Split(text, "\f"), budget, opts.Overlap, "\f")
+	default:
+		return chunkByTokens(text, budget, opts.Overlap)
+	}
+}
+
+// chunkByTokens cuts text into windows of budget tokens that overlap by overlap tokens
+func chunkByTokens(text string, budget, overlap int) []string {
+	charsPerToken := DefaultTokenEstimationConfig().CharsPerToken
+	size := budget * charsPerToken
+	overlapChars := min(overlap*charsPerToken, size/2)
+
+	var chunks []string
+	for start := 0; start < len(text); {
+		end := runeBoundary(text, min(start+size, len(text)), start)
+		if end < len(text) {
+			// Prefer to break at the last whitespace inside the window
+			if i := strings.LastIndexFunc(text[start:end], unicode.IsSpace); i > 0 {
+				end = start + i
+			}
+		}
+		if chunk := strings.TrimSpace(text[start:end]); chunk != "" {
+			chunks = append(chunks, chunk)
+		}
+		if end >= len(text) {
+			break
+		}
+
+		next := runeBoundary(text, end-overlapChars, start)
+		if overlapChars > 0 {
+			// Start the overlap at a word boundary
+			if i := strings.IndexFunc(text[next:end], unicode.IsSpace); i >= 0 {
+				next += i
+			}
+		}
+		if next <= start {
+			next = end
+		}
+		start = next
+	}
+	return chunks
+}
+
+// runeBoundary moves byte offset i back to the start of the rune it falls in,
+// or forward when that would reach floor, so that text is never cut inside a
+// multi-byte character
+func runeBoundary(text string, i, floor int) int {
+	j := i
+	for j > floor && j < len(text) && !utf8.RuneStart(text[j]) {
+		j--
+	}
+	if j > floor || i <= floor {
+		return j
+	}
+	for i < len(text) && !utf8.RuneStart(text[i]) {
+		i++
+	}
+	return i
+}
+
+// splitParagraphs splits on blank lines and before markdown headings
+func splitParagraphs(text string) []string {
+	var blocks []string
+	for _, para := range paragraphBreak.Split(text, -1) {
+		locs := headingLine.FindAllStringIndex(para, -1)
+		prev := 0
+		for _, loc := range locs {
+			if loc[0] > prev {
+				blocks = append(blocks, para[prev:loc[0]])
+			}
+			prev = loc[0]
+		}
+		blocks = append(blocks, para[prev:])
+	}
+	return blocks
+}
+
+// packBlocks greedily groups blocks into chunks within budget, repeating the
+// last overlap blocks of a chunk at the start of the next one. Blocks larger
+// than the budget are split by tokens.
+func packBlocks(blocks []string, budget, overlap int, sep string) []string {
+	var pieces []string
+	for _, b := range blocks {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		if EstimateTokensFromText(b) > budget {
+			pieces = append(pieces, chunkByTokens(b, budget, 0)...)
+			continue
+		}
+		pieces = append(pieces, b)
+	}
+
+	var (
+		chunks  []string
+		current []string
+		tokens  int
+		fresh   int // pieces in current that are not overlap from the previous chunk
+	)
+	flush := func() {
+		chunks = append(chunks, strings.Join(current, sep))
+		carry := current[max(len(current)-overlap, 0):]
+		if overlap <= 0 {
+			carry = nil
+		}
+		current = append([]string(nil), carry...)
+		tokens = EstimateTokensFromText(strings.Join(current, sep))
+		fresh = 0
+	}
+	for _, p := range pieces {
+		t := EstimateTokensFromText(p)
+		if fresh > 0 && tokens+t > budget {
+			flush()
+			// Drop overlap that would not leave room for new content
+			for len(current) > 0 && tokens+t > budget {
+				current = current[1:]
+				tokens = EstimateTokensFromText(strings.Join(current, sep))
+			}
+		}
+		current = append(current, p)
+		tokens += t
+		fresh++
+	}
+	if fresh > 0 {
+		chunks = append(chunks, strings.Join(current, sep))
+	}
+	return chunks
+}
+
+// chunks returns one snapshot per chunk of the text parts. Media parts are kept in
+// every snapshot; each snapshot carries exactly one text chunk. A snapshot whose
+// text fits the budget is returned as the only element.
+func (p *preparedAssets) chunks(opts *ChunkingOptions) []*preparedAssets {
+	if opts == nil || opts.Strategy == ChunkNone {
+		return []*preparedAssets{p}
+	}
+	var total int
+	for _, msg := range p.messages() {
+		for _, part := range msg.Parts {
+			if part.Type == "text" {
+				total += EstimateTokensFromText(part.Text)
+			}
+		}
+	}
+	if total <= opts.chunkTokens() {
+		return []*preparedAssets{p}
+	}
+
+	var views []*preparedAssets
+	for ai, messages := range p.perAsset {
+		for mi, msg := range messages {
+			for pi, part := range msg.Parts {
+				if part.Type != "text" {
+					continue
+				}
+				for _, chunk := range ChunkText(part.Text, *opts) {
+					views = append(views, p.withOnlyText(ai, mi, pi, chunk))
+				}
+			}
+		}
+	}
+	if len(views) == 0 {
+		return []*preparedAssets{p}
+	}
+	return views
+}
+
+// withOnlyText copies the snapshot keeping media parts and replacing the text part
+// at (asset, message, part) with text; all other text parts are dropped.
+func (p *preparedAssets) withOnlyText(asset, message, part int, text string) *preparedAssets {
+	view := p.view(make([][]*Message, len(p.perAsset)))
+	for ai, messages := range p.perAsset {
+		for mi, msg := range messages {
+			var parts []*Part
+			for pi, pt := range msg.Parts {
+				switch {
+				case ai == asset && mi == message && pi == part:
+					parts = append(parts, NewTextPart(text))
+				case pt.Type != "text":
+					parts = append(parts, pt)
+				}
+			}
+			if len(parts) > 0 {
+				view.perAsset[ai] = append(view.perAsset[ai], &Message{Role: msg.Role, Parts: parts})
+			}
+		}
+	}
+	return view
+}
+
+// withAssetTexts copies the snapshot keeping media parts and giving each asset
+// the joined texts[asset] as its only text; assets without an entry lose their text.
+func (p *preparedAssets) withAssetTexts(texts map[int][]string) *preparedAssets {
+	view := p.view(make([][]*Message, len(p.perAsset)))
+	for ai, messages := range p.perAsset {
+		placed := false
+		for _, msg := range messages {
+			var parts []*Part
+			for _, pt := range msg.Parts {
+				switch {
+				case pt.Type != "text":
+					parts = append(parts, pt)
+				case !placed && len(texts[ai]) > 0:
+					parts = append(parts, NewTextPart(strings.Join(texts[ai], "\n\n")))
+					placed = true
+				}
+			}
+			if len(parts) > 0 {
+				view.perAsset[ai] = append(view.perAsset[ai], &Message{Role: msg.Role, Parts: parts})
+			}
+		}
+	}
+	return view
+}
+
+// mergeChunkFragments combines per-chunk JSON fragments for keys into one fragment
+func (x *Unstructor[T]) mergeChunkFragments(ctx context.Context, keys []string, model string, fragments [][]byte, opts Options) ([]byte, error) {
+	payloads := make([]map[string]any, 0, len(fragments))
+	for i, raw := range fragments {
+		var payload map[string]any
+		if err := json.Unmarshal(SanitizeJSONResponse(raw), &payload); err != nil {
+			return nil, fmt.Errorf("chunk %d: %w", i, err)
+		}
+		payloads = append(payloads, payload)
+	}
+
+	merged := map[string]any{}
+	candidates := map[string][]any{}
+	var reconcile []string
+	for _, key := range keys {
+		var values []any
+		for _, payload := range payloads {
+			if v, ok := traverse(payload, key); ok {
+				values = append(values, v)
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+
+		switch opts.Chunking.ruleFor(key) {
+		case MergeMajorityVote:
+			setPath(merged, key, majorityValue(values))
+		case MergeConcatDedupe:
+			setPath(merged, key, concatDedupe(values))
+		case MergeReconcile:
+			candidates[key] = values
+			reconcile = append(reconcile, key)
+		default:
+			setPath(merged, key, firstNonEmpty(values))
+		}
+	}
+
+	if len(reconcile) > 0 {
+		resolved, err := x.reconcileValues(ctx, reconcile, candidates, model, opts)
+		if err != nil {
+			return nil, err
+		}
+		for _, key := range reconcile {
+			if v, ok := traverse(resolved, key); ok {
+				setPath(merged, key, v)
+			} else {
+				setPath(merged, key, firstNonEmpty(candidates[key]))
+			}
+		}
+	}
+
+	x.log.Debug("Merged chunk fragments", "chunks", len(fragments), "keys", keys, "reconciled", reconcile)
+	return json.Marshal(merged)
+}
+
+// reconcileValues asks the model to pick final values for keys from their per-chunk candidates
+func (x *Unstructor[T]) reconcileValues(ctx context.Context, keys []string, candidates map[string][]any, model string, opts Options) (map[string]any, error) {
+	tpl := defaultReconcilePrompt
+	if label := opts.Chunking.ReconcilePrompt; label != "" {
+		label, version, err := resolvePromptVersion(x.prompts, label, opts)
+		if err != nil {
+			return nil, fmt.Errorf("reconcile prompt: %w", err)
+		}
+		if tpl, err = x.prompts.GetPrompt(label, version); err != nil {
+			return nil, fmt.Errorf("reconcile prompt %q: %w", label, err)
+		}
+	}
+
+	var b strings.Builder
+	for _, key := range keys {
+		data, err := json.Marshal(candidates[key])
+		if err != nil {
+			return nil, fmt.Errorf("reconcile %s: %w", key, err)
+		}
+		fmt.Fprintf(&b, "- %s: %s\n", key, data)
+	}
+	prompt := strings.ReplaceAll(tpl, "{{.Keys}}", strings.Join(keys, ","))
+	prompt = strings.ReplaceAll(prompt, "{{.Candidates}}", b.String())
+
+	var raw []byte
+	err := retryable(func() error {
+		var genErr error
+		ctx, cancel := attemptContext(ctx, opts)
+		defer cancel()
+		raw, genErr = x.invoker.Generate(ctx, Model(model), prompt, nil)
+		return genErr
+	}, opts.MaxRetries, opts.Backoff, x.log)
+	if err != nil {
+		return nil, fmt.Errorf("reconcile: %w", err)
+	}
+
+	var resolved map[string]any
+	if err := json.Unmarshal(SanitizeJSONResponse(raw), &resolved); err != nil {
+		return nil, fmt.Errorf("reconcile: %w", err)
+	}
+	return resolved, nil
+}
+
+// isEmptyValue reports whether a decoded JSON value carries no information
+func isEmptyValue(v any) bool {
+	switch t := v.(type) {
+	case nil:
+		return true
+	case string:
+		return strings.TrimSpace(t) == ""
+	case []any:
+		return len(t) == 0
+	case map[string]any:
+		return len(t) == 0
+	}
+	return false
+}
+
+func firstNonEmpty(values []any) any {
+	for _, v := range values {
+		if !isEmptyValue(v) {
+			return v
+		}
+	}
+	return values[0]
+}
+
+func majorityValue(values []any) any {
+	counts := map[string]int{}
+	var order []string
+	byKey := map[string]any{}
+	for _, v := range values {
+		if isEmptyValue(v) {
+			continue
+		}
+		k := canonicalJSON(v)
+		if _, seen := counts[k]; !seen {
+			order = append(order, k)
+			byKey[k] = v
+		}
+		counts[k]++
+	}
+	if len(order) == 0 {
+		return values[0]
+	}
+	best := order[0]
+	for _, k := range order[1:] {
+		if counts[k] > counts[best] {
+			best = k
+		}
+	}
+	return byKey[best]
+}
+
+func concatDedupe(values []any) any {
+	var out []any
+	seen := map[string]bool{}
+	isArray := false
+	for _, v := range values {
+		items, ok := v.([]any)
+		if !ok {
+			continue
+		}
+		isArray = true
+		for _, item := range items {
+			k := canonicalJSON(item)
+			if seen[k] {
+				continue
+			}
+			seen[k] = true
+			out = append(out, item)
+		}
+	}
+	if !isArray {
+		return firstNonEmpty(values)
+	}
+	if out == nil {
+		out = []any{}
+	}
+	return out
+}
+
+// canonicalJSON encodes v with sorted object keys for equality checks
+func canonicalJSON(v any) string {
+	b, _ := json.Marshal(v) // decoded JSON always re-encodes
+	return string(b)
+}
+
+// setPath stores v under a dotted key, creating intermediate objects
+func setPath(m map[string]any, path string, v any) {
+	parts := strings.Split(path, ".")
+	cur := m
+	for _, p := range parts[:len(parts)-1] {
+		next, ok := cur[p].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			cur[p] = next
+		}
+		cur = next
+	}
+	cur[parts[len(parts)-1]] = v
+}
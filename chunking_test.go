@@ -0,0 +1,149 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestChunkText(t *testing.T) {
+	t.Run("fits", func(t *testing.T) {
+		assert.Equal(t, []string{"short"}, ChunkText("short", ChunkingOptions{Strategy: ChunkByTokens, ChunkTokens: 10}))
+	})
+
+	t.Run("tokens with overlap", func(t *testing.T) {
+		text := strings.Repeat("word ", 40) // 200 chars ≈ 50 tokens
+		chunks := ChunkText(text, ChunkingOptions{Strategy: ChunkByTokens, ChunkTokens: 10, Overlap: 2})
+		require.Greater(t, len(chunks), 4)
+		for _, c := range chunks {
+			assert.LessOrEqual(t, EstimateTokensFromText(c), 10)
+			assert.NotContains(t, c, "wor ")
+		}
+		// Overlap repeats the tail of a chunk at the start of the next one
+		assert.True(t, strings.HasSuffix(chunks[0], "word"))
+		assert.Greater(t, len(strings.Join(chunks, " ")), len(strings.TrimSpace(text)))
+	})
+
+	t.Run("paragraphs and headings", func(t *testing.T) {
+		text := "# Intro\nfirst paragraph here\n\nsecond paragraph here\n# Terms\nthird paragraph here"
+		chunks := ChunkText(text, ChunkingOptions{Strategy: ChunkByParagraphs, ChunkTokens: 8})
+		assert.Equal(t, []string{"# Intro\nfirst paragraph here", "second paragraph here", "# Terms\nthird paragraph here"}, chunks)
+
+		chunks = ChunkText(text, ChunkingOptions{Strategy: ChunkByParagraphs, ChunkTokens: 14, Overlap: 1})
+		assert.Equal(t, []string{
+			"# Intro\nfirst paragraph here\n\nsecond paragraph here",
+			"second paragraph here\n\n# Terms\nthird paragraph here",
+		}, chunks)
+	})
+
+	t.Run("pages", func(t *testing.T) {
+		text := "page one text\fpage two text\fpage three text"
+		chunks := ChunkText(text, ChunkingOptions{Strategy: ChunkByPages, ChunkTokens: 5})
+		assert.Equal(t, []string{"page one text", "page two text", "page three text"}, chunks)
+	})
+
+	t.Run("multi-byte text", func(t *testing.T) {
+		cjk := strings.Repeat("請求書の合計金額は税込みで計算されます。", 40)
+		cyrillic := strings.Repeat("счёт оплачен полностью ", 40)
+		for _, text := range []string{cjk, cyrillic, cjk + "\n\n" + cyrillic} {
+			for _, strategy := range []ChunkStrategy{ChunkByTokens, ChunkByParagraphs, ChunkByPages} {
+				chunks := ChunkText(text, ChunkingOptions{Strategy: strategy, ChunkTokens: 7, Overlap: 2})
+				require.Greater(t, len(chunks), 1)
+				for _, c := range chunks {
+					assert.True(t, utf8.ValidString(c), "chunk %q", c)
+				}
+			}
+			assert.True(t, utf8.ValidString(truncateTokens(text, 5)))
+		}
+	})
+}
+
+func TestMergeRules(t *testing.T) {
+	values := []any{"", "ACME", "Acme Inc", "Acme Inc"}
+	assert.Equal(t, "ACME", firstNonEmpty(values))
+	assert.Equal(t, "Acme Inc", majorityValue(values))
+	assert.Equal(t, []any{"a", "b", "c"}, concatDedupe([]any{[]any{"a", "b"}, []any{"b", "c"}}))
+	assert.Equal(t, "x", concatDedupe([]any{nil, "x"}))
+}
+
+// chunkPrompts exposes the document to the invoker through the rendered prompt
+type chunkPrompts struct{}
+
+func (chunkPrompts) GetPrompt(tag string, version int) (string, error) {
+	return "reconcile {{.Keys}}\n{{.Candidates}}", nil
+}
+
+func (chunkPrompts) GetPromptWithContext(tag string, version int, keys []string, document string) (string, error) {
+	return document, nil
+}
+
+// chunkInvoker answers each chunk with the values found in it
+type chunkInvoker struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (c *chunkInvoker) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	c.mu.Lock()
+	c.prompts = append(c.prompts, prompt)
+	c.mu.Unlock()
+
+	if strings.HasPrefix(prompt, "reconcile") {
+		return []byte(`{"total": 42}`), nil
+	}
+	out := map[string]any{"vendor": "", "tags": []string{}}
+	for _, line := range strings.Split(prompt, "\n") {
+		if v, ok := strings.CutPrefix(line, "vendor:"); ok {
+			out["vendor"] = v
+		}
+		if v, ok := strings.CutPrefix(line, "tag:"); ok {
+			out["tags"] = []string{v}
+		}
+		if v, ok := strings.CutPrefix(line, "total:"); ok {
+			out["total"] = len(v)
+		}
+	}
+	return json.Marshal(out)
+}
+
+func TestUnstruct_Chunking(t *testing.T) {
+	type invoice struct {
+		Vendor string   `json:"vendor" unstruct:"invoice"`
+		Tags   []string `json:"tags" unstruct:"invoice"`
+		Total  int      `json:"total" unstruct:"invoice"`
+	}
+	doc := "vendor:Acme\ntag:a\ntotal:x\n\nvendor:Acme\ntag:b\n\nvendor:Other\ntag:a\ntotal:xx"
+
+	inv := &chunkInvoker{}
+	ext := &Unstructor[invoice]{invoker: inv, prompts: chunkPrompts{}, log: slog.Default()}
+	out, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset(doc)},
+		WithModel("test-model"),
+		WithChunking(ChunkByParagraphs, 8, 0),
+		WithMergeRule(MergeMajorityVote),
+		WithFieldMergeRule("tags", MergeConcatDedupe),
+		WithFieldMergeRule("total", MergeReconcile),
+		WithReconcilePrompt("reconcile"),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Acme", out.Vendor)
+	assert.Equal(t, []string{"a", "b"}, out.Tags)
+	assert.Equal(t, 42, out.Total)
+	require.Len(t, inv.prompts, 4) // three chunks and one reconcile call
+	assert.Contains(t, inv.prompts[3], "- total: [1,2]")
+
+	t.Run("dry run counts chunk calls", func(t *testing.T) {
+		stats, err := ext.DryRun(context.Background(), []Asset{NewTextAsset(doc)},
+			WithModel("test-model"), WithChunking(ChunkByParagraphs, 8, 0))
+		require.NoError(t, err)
+		assert.Equal(t, 3, stats.PromptCalls)
+		assert.Equal(t, 3, stats.GroupDetails[0].Chunks)
+	})
+}
@@ -0,0 +1,571 @@
+package unstruct
+
+import (
+	"encoding"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Converter converts a value decoded from a model response to a field's type.
+// v is a string, json.Number, bool, []any or map[string]any; nulls never reach
+// converters.
+type Converter func(v any) (any, error)
+
+// WithConverter makes fn convert response values for every field of type V,
+// also behind pointers and in slices and maps. It takes precedence over the
+// built-in coercion.
+func WithConverter[V any](fn func(v any) (V, error)) func(*Options) {
+	return func(o *Options) {
+		if o.Converters == nil {
+			o.Converters = make(map[reflect.Type]Converter)
+		}
+		o.Converters[reflect.TypeFor[V]()] = func(v any) (any, error) { return fn(v) }
+	}
+}
+
+// WithDateLayouts adds time layouts to try, before DateLayouts, when a
+// response string is stored in a time.Time field
+func WithDateLayouts(layouts ...string) func(*Options) {
+	return func(o *Options) { o.DateLayouts = append(o.DateLayouts, layouts...) }
+}
+
+// DateLayouts are the layouts tried, in order, for time.Time fields. Slashed
+// dates are read month first, dotted ones day first.
+var DateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	time.DateOnly,
+	"2006/01/02",
+	"02.01.2006",
+	"01/02/2006",
+	"2 January 2006",
+	"January 2, 2006",
+	"2 Jan 2006",
+	"Jan 2, 2006",
+	"02-Jan-2006",
+	time.RFC1123Z,
+	time.RFC1123,
+}
+
+// CoercionError reports a response value that could not be stored in its
+// field. The field keeps its previous value.
+type CoercionError struct {
+	Key   string `json:"key"`   // JSON path, e.g. "items[1].qty"
+	Value any    `json:"value"` // value as returned by the model
+	Type  string `json:"type"`  // Go type of the field
+	Err   error  `json:"-"`
+}
+
+func (e CoercionError) Error() string {
+	return fmt.Sprintf("unstruct: %s: cannot use %v as %s: %v", e.Key, e.Value, e.Type, e.Err)
+}
+
+func (e CoercionError) Unwrap() error { return e.Err }
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+)
+
+// coercer stores decoded response values in fields, converting scalars
+// leniently, and collects the values it could not convert
+type coercer struct {
+	converters map[reflect.Type]Converter
+	layouts    []string
+	errs       []CoercionError
+}
+
+func newCoercer(opts *Options) *coercer {
+	c := &coercer{layouts: DateLayouts}
+	if opts != nil {
+		c.converters = opts.Converters
+		c.layouts = append(append([]string(nil), opts.DateLayouts...), DateLayouts...)
+	}
+	return c
+}
+
+// set stores v in dst, recording a CoercionError for key when it cannot.
+// Structs and maps are merged into, so that fields set by other prompt groups
+// are kept; nulls, and blank strings for fields that are not text, leave dst
+// as it is.
+func (c *coercer) set(dst reflect.Value, v any, key string) {
+	if v == nil {
+		return
+	}
+	if _, ok := c.converters[dst.Type()]; !ok && blankScalar(dst.Type(), v) {
+		return
+	}
+	if err := c.setValue(dst, v, key); err != nil {
+		c.errs = append(c.errs, CoercionError{Key: key, Value: v, Type: dst.Type().String(), Err: err})
+	}
+}
+
+func (c *coercer) setValue(dst reflect.Value, v any, key string) error {
+	t := dst.Type()
+	if conv, ok := c.converters[t]; ok {
+		out, err := conv(v)
+		if err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(out)
+		if !rv.IsValid() || !rv.Type().AssignableTo(t) {
+			return fmt.Errorf("converter returned %T", out)
+		}
+		dst.Set(rv)
+		return nil
+	}
+
+	switch {
+	case t.Kind() == reflect.Pointer:
+		if dst.IsNil() {
+			elem := reflect.New(t.Elem())
+			if err := c.setValue(elem.Elem(), v, key); err != nil {
+				return err
+			}
+			dst.Set(elem)
+			return nil
+		}
+		return c.setValue(dst.Elem(), v, key)
+	case t == timeType:
+		return c.setTime(dst, v)
+	case t == durationType:
+		if s, ok := v.(string); ok {
+			d, err := time.ParseDuration(strings.TrimSpace(s))
+			if err != nil {
+				return err
+			}
+			dst.SetInt(int64(d))
+			return nil
+		}
+	}
+
+	p := reflect.PointerTo(t)
+	if p.Implements(jsonUnmarshalerType) {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		if err := dst.Addr().Interface().(json.Unmarshaler).UnmarshalJSON(b); err == nil {
+			return nil
+		} else if !p.Implements(textUnmarshalerType) {
+			return err
+		}
+	}
+	if p.Implements(textUnmarshalerType) {
+		s, ok := scalarText(v)
+		if !ok {
+			return fmt.Errorf("want a string, got %s", jsonKind(v))
+		}
+		u := dst.Addr().Interface().(encoding.TextUnmarshaler)
+		err := u.UnmarshalText([]byte(s))
+		if n, ok := normalizeNumber(s); err != nil && ok && n != s {
+			// Decimal types such as big.Rat take plain numbers only
+			err = u.UnmarshalText([]byte(n))
+		}
+		return err
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		s, ok := scalarText(v)
+		if !ok {
+			return fmt.Errorf("want a string, got %s", jsonKind(v))
+		}
+		dst.SetString(s)
+	case reflect.Bool:
+		b, err := parseBool(v)
+		if err != nil {
+			return err
+		}
+		dst.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := parseNumber(v)
+		if err != nil {
+			return err
+		}
+		i, err := strconv.ParseInt(n, 10, 64)
+		if err != nil {
+			if i, err = integral(n); err != nil {
+				return err
+			}
+		}
+		if dst.OverflowInt(i) {
+			return fmt.Errorf("%d overflows %s", i, t)
+		}
+		dst.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		n, err := parseNumber(v)
+		if err != nil {
+			return err
+		}
+		u, err := strconv.ParseUint(n, 10, 64)
+		if err != nil {
+			i, ierr := integral(n)
+			if ierr != nil {
+				return ierr
+			}
+			if i < 0 {
+				return fmt.Errorf("%d is negative", i)
+			}
+			u = uint64(i)
+		}
+		if dst.OverflowUint(u) {
+			return fmt.Errorf("%d overflows %s", u, t)
+		}
+		dst.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		n, err := parseNumber(v)
+		if err != nil {
+			return err
+		}
+		f, err := strconv.ParseFloat(n, 64)
+		if err != nil {
+			return err
+		}
+		if dst.OverflowFloat(f) {
+			return fmt.Errorf("%g overflows %s", f, t)
+		}
+		dst.SetFloat(f)
+	case reflect.Struct:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("want an object, got %s", jsonKind(v))
+		}
+		c.setStruct(dst, m, key)
+	case reflect.Map:
+		m, ok := v.(map[string]any)
+		if !ok {
+			return fmt.Errorf("want an object, got %s", jsonKind(v))
+		}
+		return c.setMap(dst, m, key)
+	case reflect.Slice, reflect.Array:
+		if s, ok := v.(string); ok && t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			b, _ := json.Marshal(s) // base64, as encoding/json expects
+			return json.Unmarshal(b, dst.Addr().Interface())
+		}
+		items, ok := v.([]any)
+		if !ok {
+			// A single value where a list is expected is a list of one
+			if _, isObject := v.(map[string]any); isObject || t.Kind() == reflect.Array {
+				return fmt.Errorf("want an array, got %s", jsonKind(v))
+			}
+			items = []any{v}
+		}
+		c.setList(dst, items, key)
+	case reflect.Interface:
+		// Plain JSON values, with float64 numbers as encoding/json decodes them
+		b, err := json.Marshal(v)
+		if err != nil {
+			return err
+		}
+		var plain any
+		if err := json.Unmarshal(b, &plain); err != nil {
+			return err
+		}
+		rv := reflect.ValueOf(plain)
+		if !rv.Type().AssignableTo(t) {
+			return fmt.Errorf("%s does not implement %s", rv.Type(), t)
+		}
+		dst.Set(rv)
+	default:
+		return fmt.Errorf("unsupported field type %s", t)
+	}
+	return nil
+}
+
+// setStruct sets the fields of dst present in m, matching keys like
+// encoding/json: exactly, or else case-insensitively
+func (c *coercer) setStruct(dst reflect.Value, m map[string]any, key string) {
+	for _, sf := range jsonFields(dst.Type()) {
+		v, ok := m[sf.key]
+		if !ok {
+			for k, mv := range m {
+				if strings.EqualFold(k, sf.key) {
+					v, ok = mv, true
+					break
+				}
+			}
+		}
+		if !ok || v == nil {
+			continue
+		}
+		field, ok := fieldByIndex(dst, sf.Index)
+		if !ok || !field.CanSet() {
+			continue
+		}
+		c.set(field, v, joinKey(key, sf.key))
+	}
+}
+
+func (c *coercer) setMap(dst reflect.Value, m map[string]any, key string) error {
+	t := dst.Type()
+	if dst.IsNil() && len(m) == 0 {
+		dst.Set(reflect.MakeMap(t))
+	}
+	for k, v := range m {
+		mk, err := mapKey(t.Key(), k)
+		if err != nil {
+			return err
+		}
+		elem := reflect.New(t.Elem()).Elem()
+		if existing := dst.MapIndex(mk); existing.IsValid() {
+			elem.Set(existing)
+		}
+		before := len(c.errs)
+		c.set(elem, v, fmt.Sprintf("%s[%s]", key, k))
+		if len(c.errs) == before || v == nil {
+			// A nil map stays nil unless an entry converts
+			if dst.IsNil() {
+				dst.Set(reflect.MakeMapWithSize(t, len(m)))
+			}
+			dst.SetMapIndex(mk, elem)
+		}
+	}
+	return nil
+}
+
+// setList decodes items into the elements of dst like encoding/json: existing
+// elements are patched in place, so fragments of one list merge, a slice grows
+// or shrinks to len(items) and the rest of an array is zeroed. Elements that
+// cannot be converted keep their value.
+func (c *coercer) setList(dst reflect.Value, items []any, key string) {
+	if dst.Kind() == reflect.Slice {
+		// A fresh backing array keeps slices shared with other values untouched
+		s := reflect.MakeSlice(dst.Type(), len(items), len(items))
+		reflect.Copy(s, dst)
+		dst.Set(s)
+	} else {
+		for i := len(items); i < dst.Len(); i++ {
+			dst.Index(i).SetZero()
+		}
+	}
+	for i, v := range items {
+		if i >= dst.Len() {
+			break
+		}
+		c.set(dst.Index(i), v, fmt.Sprintf("%s[%d]", key, i))
+	}
+}
+
+func (c *coercer) setTime(dst reflect.Value, v any) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("want a date string, got %s", jsonKind(v))
+	}
+	s = strings.TrimSpace(s)
+	for _, layout := range c.layouts {
+		if ts, err := time.Parse(layout, s); err == nil {
+			dst.Set(reflect.ValueOf(ts))
+			return nil
+		}
+	}
+	return fmt.Errorf("unrecognised date %q", s)
+}
+
+// mapKey converts a JSON object key to a map key of type t
+func mapKey(t reflect.Type, k string) (reflect.Value, error) {
+	key := reflect.New(t).Elem()
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return key, key.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(k))
+	}
+	switch t.Kind() {
+	case reflect.String:
+		key.SetString(k)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(k, 10, 64)
+		if err != nil || key.OverflowInt(i) {
+			return key, fmt.Errorf("invalid %s map key %q", t, k)
+		}
+		key.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u, err := strconv.ParseUint(k, 10, 64)
+		if err != nil || key.OverflowUint(u) {
+			return key, fmt.Errorf("invalid %s map key %q", t, k)
+		}
+		key.SetUint(u)
+	default:
+		return key, fmt.Errorf("unsupported map key type %s", t)
+	}
+	return key, nil
+}
+
+// scalarText returns the text of a string, number or boolean
+func scalarText(v any) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+// parseBool reads booleans, 0 and 1, and yes/no words
+// blankScalar reports whether v is a blank string for a boolean, numeric or
+// time field; models write those for values they did not find
+func blankScalar(t reflect.Type, v any) bool {
+	s, ok := v.(string)
+	if !ok || strings.TrimSpace(s) != "" {
+		return false
+	}
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Bool, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return t == timeType
+}
+
+func parseBool(v any) (bool, error) {
+	s, ok := scalarText(v)
+	if !ok {
+		return false, fmt.Errorf("want a boolean, got %s", jsonKind(v))
+	}
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "true", "t", "yes", "y", "on", "1", "checked", "x":
+		return true, nil
+	case "false", "f", "no", "n", "off", "0", "unchecked":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean %q", s)
+}
+
+// parseNumber normalises a number written as JSON or as text such as "42",
+// "1,234.50", "1.234,50", "$12.00", "EUR 9,99" or "(5.00)" to strconv syntax.
+// A single separator followed by three digits is read as a thousands
+// separator when it is a comma, unless it follows a lone 0, and as a decimal
+// point when it is a dot.
+func parseNumber(v any) (string, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return v.String(), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case string:
+		n, ok := normalizeNumber(v)
+		if !ok {
+			return "", fmt.Errorf("invalid number %q", v)
+		}
+		return n, nil
+	}
+	return "", fmt.Errorf("want a number, got %s", jsonKind(v))
+}
+
+func normalizeNumber(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative, s = true, s[1:len(s)-1]
+	}
+
+	// Drop currency codes and symbols, and spaces or apostrophes used to group digits
+	s = trimCurrencyCode(s)
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case unicode.Is(unicode.Sc, r), unicode.IsSpace(r), r == '\'', r == '’', r == '_':
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s = b.String()
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "+") {
+		negative = negative != (s[0] == '-')
+		s = s[1:]
+	}
+	if s == "" {
+		return "", false
+	}
+
+	comma, dot := strings.LastIndex(s, ","), strings.LastIndex(s, ".")
+	switch {
+	case comma >= 0 && dot >= 0:
+		// The later separator is the decimal one
+		if comma > dot {
+			s = strings.ReplaceAll(s, ".", "")
+			s = strings.Replace(s, ",", ".", 1)
+		} else {
+			s = strings.ReplaceAll(s, ",", "")
+		}
+	case comma >= 0:
+		// A leading 0 is never a thousands group, so 0,123 is a decimal
+		if strings.Count(s, ",") > 1 || len(s)-comma-1 == 3 && !strings.HasPrefix(s, "0,") {
+			s = strings.ReplaceAll(s, ",", "")
+		} else {
+			s = strings.Replace(s, ",", ".", 1)
+		}
+	case strings.Count(s, ".") > 1:
+		s = strings.ReplaceAll(s, ".", "")
+	}
+	if strings.ContainsAny(s, ",") || strings.Count(s, ".") > 1 {
+		return "", false
+	}
+	for _, r := range s {
+		if (r < '0' || r > '9') && r != '.' && r != 'e' && r != 'E' && r != '-' && r != '+' {
+			return "", false
+		}
+	}
+	if negative {
+		s = "-" + s
+	}
+	return s, true
+}
+
+// trimCurrencyCode drops a three-letter code such as USD before or after s
+func trimCurrencyCode(s string) string {
+	isCode := func(code string) bool {
+		for _, r := range code {
+			if r < 'A' || r > 'Z' {
+				return false
+			}
+		}
+		return true
+	}
+	if len(s) > 3 && isCode(s[:3]) && !unicode.IsLetter(rune(s[3])) {
+		s = s[3:]
+	} else if n := len(s); n > 3 && isCode(s[n-3:]) && !unicode.IsLetter(rune(s[n-4])) {
+		s = s[:n-3]
+	}
+	return strings.TrimSpace(s)
+}
+
+// integral parses n as a whole number that may be written with a fraction or
+// exponent, such as "12.0" or "1e3"
+func integral(n string) (int64, error) {
+	f, err := strconv.ParseFloat(n, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f != float64(int64(f)) {
+		return 0, fmt.Errorf("%s is not a whole number", n)
+	}
+	return int64(f), nil
+}
+
+// jsonKind names the JSON type of a decoded value for messages
+func jsonKind(v any) string {
+	switch v.(type) {
+	case string:
+		return "a string"
+	case json.Number, float64:
+		return "a number"
+	case bool:
+		return "a boolean"
+	case []any:
+		return "an array"
+	case map[string]any:
+		return "an object"
+	}
+	return fmt.Sprintf("%T", v)
+}
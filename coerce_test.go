@@ -0,0 +1,283 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type coerceLevel int
+
+func (l *coerceLevel) UnmarshalText(b []byte) error {
+	switch strings.ToLower(string(b)) {
+	case "low":
+		*l = 1
+	case "high":
+		*l = 2
+	default:
+		return errors.New("unknown level")
+	}
+	return nil
+}
+
+type coerceInvoice struct {
+	Count    int            `json:"count"`
+	Total    float64        `json:"total"`
+	Net      float32        `json:"net"`
+	Pages    uint8          `json:"pages"`
+	Paid     bool           `json:"paid"`
+	Issued   time.Time      `json:"issued"`
+	Due      *time.Time     `json:"due"`
+	Terms    time.Duration  `json:"terms"`
+	Level    coerceLevel    `json:"level"`
+	Ratio    *big.Rat       `json:"ratio"`
+	Code     string         `json:"code"`
+	Tags     []string       `json:"tags"`
+	Qty      []int          `json:"qty"`
+	Rates    map[string]int `json:"rates"`
+	Customer struct {
+		Name string `json:"name"`
+		VIP  bool   `json:"vip"`
+	} `json:"customer"`
+}
+
+func TestPatchStruct_Coercion(t *testing.T) {
+	sch, err := schemaOf[coerceInvoice]()
+	require.NoError(t, err)
+
+	var got coerceInvoice
+	c := newCoercer(nil)
+	require.NoError(t, patchStruct(&got, []byte(`{
+		"count": "1,234",
+		"total": "$1,234.50",
+		"net": "1.234,50 €",
+		"pages": 12.0,
+		"paid": "Yes",
+		"issued": "15.03.2024",
+		"due": "March 31, 2024",
+		"terms": "720h",
+		"level": "High",
+		"ratio": "EUR 0.25",
+		"code": 42,
+		"tags": "urgent",
+		"qty": ["1", 2, "3.0"],
+		"rates": {"EUR": "100", "USD": 90},
+		"customer": {"Name": "ACME", "vip": "n"}
+	}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+
+	due := time.Date(2024, 3, 31, 0, 0, 0, 0, time.UTC)
+	expected := coerceInvoice{
+		Count:  1234,
+		Total:  1234.5,
+		Net:    1234.5,
+		Pages:  12,
+		Paid:   true,
+		Issued: time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC),
+		Due:    &due,
+		Terms:  30 * 24 * time.Hour,
+		Level:  2,
+		Ratio:  big.NewRat(1, 4),
+		Code:   "42",
+		Tags:   []string{"urgent"},
+		Qty:    []int{1, 2, 3},
+		Rates:  map[string]int{"EUR": 100, "USD": 90},
+	}
+	expected.Customer.Name = "ACME"
+	assert.Equal(t, expected, got)
+}
+
+func TestPatchStruct_CoercionErrors(t *testing.T) {
+	sch, err := schemaOf[coerceInvoice]()
+	require.NoError(t, err)
+
+	var got coerceInvoice
+	got.Code = "kept"
+	c := newCoercer(nil)
+	require.NoError(t, patchStruct(&got, []byte(`{
+		"count": "12.5",
+		"pages": 300,
+		"paid": "maybe",
+		"issued": "someday",
+		"level": "medium",
+		"code": {"a": 1},
+		"qty": [1, "two"],
+		"customer": {"vip": "sure"},
+		"total": null
+	}`), sch.json2field, c))
+
+	var keys []string
+	for _, e := range c.errs {
+		keys = append(keys, e.Key)
+	}
+	assert.ElementsMatch(t, []string{"code", "count", "customer.vip", "issued", "level", "paid", "pages", "qty[1]"}, keys)
+	assert.Equal(t, "kept", got.Code, "fields keep their value")
+	assert.Equal(t, []int{1, 0}, got.Qty)
+
+	var pages *CoercionError
+	for i := range c.errs {
+		if c.errs[i].Key == "pages" {
+			pages = &c.errs[i]
+		}
+	}
+	require.NotNil(t, pages)
+	assert.Equal(t, "uint8", pages.Type)
+	assert.EqualError(t, pages, "unstruct: pages: cannot use 300 as uint8: 300 overflows uint8")
+}
+
+func TestNormalizeNumber(t *testing.T) {
+	for in, want := range map[string]string{
+		"42":          "42",
+		" -7 ":        "-7",
+		"1,234":       "1234",
+		"1,234,567":   "1234567",
+		"12,5":        "12.5",
+		"1.234":       "1.234",
+		"1.234.567":   "1234567",
+		"1,234.50":    "1234.50",
+		"1.234,50":    "1234.50",
+		"1 234,50":    "1234.50",
+		"1'234.50":    "1234.50",
+		"$12.00":      "12.00",
+		"-$12.00":     "-12.00",
+		"(5.00)":      "-5.00",
+		"€ 9,99":      "9.99",
+		"USD 1,000":   "1000",
+		"1,000.00EUR": "1000.00",
+		"1e3":         "1e3",
+		"0,123":       "0.123",
+		"-0,123":      "-0.123",
+		"€ 0,50":      "0.50",
+	} {
+		got, ok := normalizeNumber(in)
+		if assert.True(t, ok, in) {
+			assert.Equal(t, want, got, in)
+		}
+	}
+	for _, in := range []string{"", "abc", "12 apples", "1,2,3.4.5", "$"} {
+		_, ok := normalizeNumber(in)
+		assert.False(t, ok, in)
+	}
+}
+
+func TestWithConverterAndDateLayouts(t *testing.T) {
+	type cents int64
+	type doc struct {
+		Price  cents            `json:"price"`
+		Prices []cents          `json:"prices"`
+		Date   time.Time        `json:"date"`
+		ByDay  map[string]cents `json:"byDay"`
+	}
+
+	var opts Options
+	WithConverter(func(v any) (cents, error) {
+		n, err := parseNumber(v)
+		if err != nil {
+			return 0, err
+		}
+		f, _, err := big.ParseFloat(n, 10, 64, big.ToNearestEven)
+		if err != nil {
+			return 0, err
+		}
+		c, _ := new(big.Float).Mul(f, big.NewFloat(100)).Int64()
+		return cents(c), nil
+	})(&opts)
+	WithDateLayouts("2006.01.02")(&opts)
+	assert.Contains(t, opts.Converters, reflect.TypeFor[cents]())
+
+	sch, err := schemaOf[doc]()
+	require.NoError(t, err)
+	var got doc
+	c := newCoercer(&opts)
+	require.NoError(t, patchStruct(&got, []byte(`{
+		"price": "$12.34", "prices": [1, "0.5"], "date": "2024.02.01", "byDay": {"mon": "1"}
+	}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+	assert.Equal(t, doc{
+		Price:  1234,
+		Prices: []cents{100, 50},
+		Date:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		ByDay:  map[string]cents{"mon": 100},
+	}, got)
+}
+
+// staticInvoker answers every prompt with the same response
+type staticInvoker string
+
+func (s staticInvoker) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	return []byte(s), nil
+}
+
+func TestUnstructWithResult_CoercionErrors(t *testing.T) {
+	type doc struct {
+		Total float64   `json:"total" unstruct:"invoice"`
+		Date  time.Time `json:"date" unstruct:"invoice"`
+	}
+	ext := &Unstructor[doc]{
+		invoker: staticInvoker(`{"total": "1.234,00 €", "date": "tomorrow"}`),
+		prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}"},
+		log:     slog.Default(),
+	}
+
+	res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset("total")}, WithModel("test-model"))
+	require.NoError(t, err)
+	assert.Equal(t, 1234.0, res.Value.Total)
+	assert.True(t, res.Value.Date.IsZero())
+	require.Len(t, res.Metadata.CoercionErrors, 1)
+	assert.Equal(t, "date", res.Metadata.CoercionErrors[0].Key)
+	assert.Equal(t, "tomorrow", res.Metadata.CoercionErrors[0].Value)
+	assert.Equal(t, "time.Time", res.Metadata.CoercionErrors[0].Type)
+
+	var err0 error = res.Metadata.CoercionErrors[0]
+	assert.ErrorContains(t, err0, "unstruct: date: cannot use tomorrow as time.Time")
+}
+
+func TestPatchStruct_BlankScalars(t *testing.T) {
+	type doc struct {
+		Paid  *bool      `json:"paid"`
+		Total float64    `json:"total"`
+		Due   *time.Time `json:"due"`
+		Note  string     `json:"note"`
+	}
+	sch, err := schemaOf[doc]()
+	require.NoError(t, err)
+
+	got := doc{Total: 5, Note: "old"}
+	c := newCoercer(nil)
+	require.NoError(t, patchStruct(&got, []byte(`{"paid": "", "total": " ", "due": "", "note": ""}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+	assert.Equal(t, doc{Total: 5}, got, "blank strings are absent for scalars and empty for text")
+}
+
+func TestPatchStruct_ListFragmentsMerge(t *testing.T) {
+	type Line struct {
+		Amount int    `json:"amount" unstruct:"prompt/fin"`
+		Desc   string `json:"desc" unstruct:"prompt/basic"`
+	}
+	type doc struct {
+		Lines []Line   `json:"lines"`
+		Sizes [3]int   `json:"sizes" unstruct:"prompt/basic"`
+		Tags  []string `json:"tags" unstruct:"prompt/basic"`
+	}
+	sch, err := schemaOf[doc]()
+	require.NoError(t, err)
+
+	got := doc{Sizes: [3]int{7, 8, 9}, Tags: []string{"a", "b", "c"}}
+	tags := got.Tags
+	c := newCoercer(nil)
+	require.NoError(t, patchStruct(&got, []byte(`{"lines": [{"amount": 1}, {"amount": 2}]}`), sch.json2field, c))
+	require.NoError(t, patchStruct(&got, []byte(`{"lines": [{"desc": "a"}, {"desc": "b"}], "sizes": [1], "tags": ["x"]}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+	assert.Equal(t, []Line{{1, "a"}, {2, "b"}}, got.Lines)
+	assert.Equal(t, [3]int{1, 0, 0}, got.Sizes, "the rest of an array is zeroed")
+	assert.Equal(t, []string{"x"}, got.Tags, "a slice shrinks to the response")
+	assert.Equal(t, []string{"a", "b", "c"}, tags, "the old backing array is not written")
+}
@@ -173,7 +173,12 @@
 //   - unstruct:"model/gemini-1.5-pro" - Use default prompt with specific model
 //   - unstruct:"prompt/financial/model/gemini-1.5-pro" - Custom prompt and model
 //   - unstruct:"prompt/contact/model/gemini-1.5-pro?temperature=0.2&topK=40" - With parameters
-//   - No tag - ERROR: All fields must specify a prompt or use WithFallbackPrompt()
+//   - No tag - WithFallbackPrompt() if set, otherwise a prompt generated from the field's
+//     Go type and its desc, format, unit, enum and example tags (or ?description=, ?format=,
+//     ?unit=, ?enum=, ?example=)
+//
+// Field hints can also be set with WithFieldHints. Templates receive them as the
+// Fields variable, and Explain lists them under each prompt call.
 //
 // The URL-style syntax supports complex model names and query parameters:
 //
@@ -193,6 +198,20 @@
 //	    } `unstruct:"prompt/contact/model/gemini-1.5-pro"`
 //	} `unstruct:"prompt/basic/model/gemini-1.5-flash"` // Default for all nested fields
 //
+// Embedded structs are flattened the way encoding/json does it: their fields are
+// promoted into the parent and inherit the embedded field's tag.
+// Pointers, slices, arrays and maps of structs are walked into as well, and
+// pointers are allocated only when there is data for them. Types that decode
+// themselves, such as time.Time, big.Rat and json.RawMessage, are leaves.
+//
+// Tags are parsed leniently during extraction. Validate checks them strictly and
+// reports every problem with its field path and offset, which makes it a good fit
+// for unit tests:
+//
+//	if err := unstruct.Validate[Organisation](); err != nil {
+//	    t.Fatal(err)
+//	}
+//
 // # Field Grouping and Batching
 //
 // Fields with the same prompt are automatically batched into a single API call
@@ -210,6 +229,20 @@
 //	    Currency string `unstruct:"prompt/financial/model/gemini-1.5-pro"`
 //	}
 //
+// Named groups set a prompt and model plus parameters, asset labels, retries and
+// a timeout for every field that references them with unstruct:"group/name". A
+// field's tag wins over its group, the group over the enclosing field, and that
+// over Options; ResolveFieldConfigs shows the result for each field.
+//
+// WithExtractionConfig applies an ExtractionConfig read from YAML or JSON with
+// LoadExtractionConfig. Its field entries, keyed by JSON path or Go Type.Field,
+// win over struct tags, and keys that match no field make extraction fail.
+//
+// Response values are coerced to field types leniently: numbers written as text
+// with separators or currency, yes/no booleans, dates in any of DateLayouts and
+// encoding.TextUnmarshaler types. Values that cannot be converted are reported
+// in ResultMetadata.CoercionErrors; WithConverter adds conversions for a type.
+//
 // # Configuration Options
 //
 // The package provides various configuration options for fine-tuning extraction:
@@ -241,20 +274,16 @@
 //
 // # Error Handling
 //
-// Fields without unstruct tags require explicit handling:
-//
-//	type BadStruct struct {
-//	    Name string `json:"name" unstruct:"prompt/basic"`
-//	    Age  int    `json:"age"` // ERROR: no prompt specified
-//	}
+// Fields without a prompt get one generated from their metadata, so simple
+// structs need no template files at all:
 //
-//	// This will fail
-//	result, err := u.Unstruct(ctx, assets)
-//	if err != nil {
-//	    // Error: field 'Age' has no prompt specified
+//	type Invoice struct {
+//	    Number string `json:"number" desc:"Invoice number as printed" example:"INV-001"`
+//	    Status string `json:"status" enum:"paid,open,overdue"`
+//	    Total  string `json:"total" unstruct:"prompt/totals"` // tuned template
 //	}
 //
-//	// This will succeed with explicit fallback
+//	// Or route every untagged field to one template instead
 //	result, err := u.Unstruct(ctx, assets,
 //	    unstruct.WithFallbackPrompt("extract-all"))
 //
@@ -0,0 +1,140 @@
+package unstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DefaultExampleTokenBudget limits the size of the examples added to one prompt
+// group when ExampleOptions.TokenBudget is zero.
+const DefaultExampleTokenBudget = 1000
+
+// examplesPlaceholder is replaced with the formatted examples in basic templates
+const examplesPlaceholder = "{{.Examples}}"
+
+// ExampleMode selects how examples reach the model
+type ExampleMode int
+
+const (
+	ExamplesAsTurns    ExampleMode = iota // user/model conversation turns before the document
+	ExamplesAsVariable                    // the examples template variable, or {{.Examples}} in basic templates; turns for providers that only implement ContextualPromptProvider
+)
+
+// Example is a worked input and the JSON expected from it
+type Example struct {
+	Input  string         // document snippet
+	Output map[string]any // expected values keyed like the struct's JSON; only the group's keys are used
+}
+
+// PromptExample is an example reduced to one prompt group's keys
+type PromptExample struct {
+	Input  string
+	Output string // JSON object with the group's keys
+}
+
+// ExampleLibrary stores examples per prompt label. It is safe for concurrent use.
+type ExampleLibrary struct {
+	mu       sync.RWMutex
+	examples map[string][]Example
+}
+
+// NewExampleLibrary creates an empty example library
+func NewExampleLibrary() *ExampleLibrary {
+	return &ExampleLibrary{examples: make(map[string][]Example)}
+}
+
+// Add registers examples for a prompt label
+func (l *ExampleLibrary) Add(prompt string, examples ...Example) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.examples[prompt] = append(l.examples[prompt], examples...)
+}
+
+// Select returns the examples for prompt most similar to document, reduced to keys,
+// that fit into budget tokens. Examples without any of the keys are skipped.
+func (l *ExampleLibrary) Select(prompt string, keys []string, document string, budget int) []PromptExample {
+	l.mu.RLock()
+	candidates := append([]Example(nil), l.examples[prompt]...)
+	l.mu.RUnlock()
+	if len(candidates) == 0 {
+		return nil
+	}
+	if budget <= 0 {
+		budget = DefaultExampleTokenBudget
+	}
+
+	var (
+		reduced []PromptExample
+		inputs  []string
+	)
+	for _, ex := range candidates {
+		out := map[string]any{}
+		for _, key := range keys {
+			if v, ok := traverse(ex.Output, key); ok {
+				setPath(out, key, v)
+			}
+		}
+		if len(out) == 0 {
+			continue
+		}
+		data, err := json.Marshal(out)
+		if err != nil {
+			continue // outputs hold decoded JSON values
+		}
+		inputs = append(inputs, ex.Input)
+		reduced = append(reduced, PromptExample{Input: ex.Input, Output: string(data)})
+	}
+
+	// Rank by similarity to the document, then fill the budget greedily
+	query := document + " " + retrievalQuery(prompt, keys)
+	var selected []PromptExample
+	var used int
+	for _, i := range rankByScore(NewBM25Retriever().scores(query, inputs)) {
+		ex := reduced[i]
+		cost := EstimateTokensFromText(ex.Input) + EstimateTokensFromText(ex.Output)
+		if used+cost > budget {
+			continue
+		}
+		used += cost
+		selected = append(selected, ex)
+	}
+	return selected
+}
+
+// ExampleOptions attaches an example library to extraction
+type ExampleOptions struct {
+	Library     *ExampleLibrary
+	Mode        ExampleMode
+	TokenBudget int // per prompt group; 0 → DefaultExampleTokenBudget
+}
+
+// formatExamples renders examples as plain text for templates
+func formatExamples(examples []PromptExample) string {
+	var b strings.Builder
+	for i, ex := range examples {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		fmt.Fprintf(&b, "Example %d:\nInput:\n%s\nOutput:\n%s", i+1, ex.Input, ex.Output)
+	}
+	return b.String()
+}
+
+// exampleTurns renders examples as user/model conversation turns
+func exampleTurns(examples []PromptExample) []*Message {
+	var turns []*Message
+	for _, ex := range examples {
+		turns = append(turns, NewExampleTurns(ex.Output, NewTextPart(ex.Input))...)
+	}
+	return turns
+}
+
+// selectFor picks the examples for one prompt group; nil options select none
+func (o *ExampleOptions) selectFor(label string, keys []string, document string) []PromptExample {
+	if o == nil || o.Library == nil {
+		return nil
+	}
+	return o.Library.Select(label, keys, document, o.TokenBudget)
+}
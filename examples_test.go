@@ -0,0 +1,207 @@
+package unstruct
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func invoiceExamples() *ExampleLibrary {
+	lib := NewExampleLibrary()
+	lib.Add("invoice",
+		Example{Input: "Shipping label for parcel 7", Output: map[string]any{"tracking": "7"}},
+		Example{Input: "Invoice from Acme, total 10 EUR", Output: map[string]any{"total": 10, "vendor": "Acme"}},
+		Example{Input: "Receipt total 5 USD", Output: map[string]any{"total": 5}},
+	)
+	return lib
+}
+
+func TestExampleLibrary_Select(t *testing.T) {
+	lib := invoiceExamples()
+
+	selected := lib.Select("invoice", []string{"total"}, "Invoice from Globex, total 99 EUR", 0)
+	require.Len(t, selected, 2)
+	assert.Equal(t, "Invoice from Acme, total 10 EUR", selected[0].Input)
+	assert.JSONEq(t, `{"total": 10}`, selected[0].Output)
+	assert.JSONEq(t, `{"total": 5}`, selected[1].Output)
+
+	// The budget keeps only what fits, preferring the most similar example
+	budget := EstimateTokensFromText(selected[0].Input) + EstimateTokensFromText(selected[0].Output)
+	limited := lib.Select("invoice", []string{"total"}, "Invoice from Globex, total 99 EUR", budget)
+	require.Len(t, limited, 1)
+	assert.Equal(t, selected[0], limited[0])
+
+	assert.Empty(t, lib.Select("contract", []string{"total"}, "anything", 0))
+}
+
+func TestFormatExamples(t *testing.T) {
+	out := formatExamples([]PromptExample{{Input: "a", Output: `{"x":1}`}, {Input: "b", Output: `{"x":2}`}})
+	assert.Equal(t, "Example 1:\nInput:\na\nOutput:\n{\"x\":1}\n\nExample 2:\nInput:\nb\nOutput:\n{\"x\":2}", out)
+}
+
+// conversationInvoker records the messages of conversation calls
+type conversationInvoker struct {
+	mu       sync.Mutex
+	messages [][]*Message
+	prompts  []string
+}
+
+func (c *conversationInvoker) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.prompts = append(c.prompts, prompt)
+	return []byte(`{"total": 1}`), nil
+}
+
+func (c *conversationInvoker) GenerateMessages(ctx context.Context, model Model, messages []*Message, parameters map[string]string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.messages = append(c.messages, messages)
+	return []byte(`{"total": 1}`), nil
+}
+
+func TestUnstruct_ExamplesAsTurns(t *testing.T) {
+	type invoice struct {
+		Total int `json:"total" unstruct:"invoice"`
+	}
+	inv := &conversationInvoker{}
+	ext := &Unstructor[invoice]{invoker: inv, prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}."}, log: slog.Default()}
+
+	_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+		WithModel("test-model"),
+		WithExamples(invoiceExamples(), ExamplesAsTurns, 0),
+	)
+	require.NoError(t, err)
+	require.Len(t, inv.messages, 1)
+
+	var roles []string
+	for _, msg := range inv.messages[0] {
+		roles = append(roles, msg.Role)
+	}
+	assert.Equal(t, []string{RoleSystem, RoleUser, RoleModel, RoleUser, RoleModel, RoleUser}, roles)
+	assert.Equal(t, "Extract total.", inv.messages[0][0].Parts[0].Text)
+	assert.JSONEq(t, `{"total": 10}`, inv.messages[0][2].Parts[0].Text)
+	assert.Equal(t, "Invoice total 99 EUR", inv.messages[0][5].Parts[0].Text)
+}
+
+func TestUnstruct_ExamplesAsVariable(t *testing.T) {
+	type invoice struct {
+		Total int `json:"total" unstruct:"invoice"`
+	}
+
+	t.Run("basic provider", func(t *testing.T) {
+		inv := &conversationInvoker{}
+		prompts := SimplePromptProvider{"invoice": "Extract {{.Keys}}.\n{{.Examples}}"}
+		ext := &Unstructor[invoice]{invoker: inv, prompts: prompts, log: slog.Default()}
+
+		_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+			WithModel("test-model"),
+			WithExamples(invoiceExamples(), ExamplesAsVariable, 0),
+		)
+		require.NoError(t, err)
+		require.Len(t, inv.prompts, 1)
+		assert.Empty(t, inv.messages)
+		assert.True(t, strings.HasPrefix(inv.prompts[0], "Extract total.\nExample 1:\nInput:\nInvoice from Acme"))
+	})
+
+	t.Run("basic provider without placeholder", func(t *testing.T) {
+		inv := &conversationInvoker{}
+		ext := &Unstructor[invoice]{invoker: inv, prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}."}, log: slog.Default()}
+
+		_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+			WithModel("test-model"),
+			WithExamples(invoiceExamples(), ExamplesAsVariable, 0),
+		)
+		require.NoError(t, err)
+		require.Len(t, inv.prompts, 1)
+		assert.True(t, strings.HasPrefix(inv.prompts[0], "Example 1:"), "examples are prepended")
+		assert.True(t, strings.HasSuffix(inv.prompts[0], "Extract total."))
+	})
+
+	t.Run("stick provider", func(t *testing.T) {
+		prompts, err := NewStickPromptProvider(WithTemplates(map[string]string{
+			"invoice": "Extract {{ KeyList }}.{% if Examples %}\n{{ Examples }}{% endif %}",
+		}))
+		require.NoError(t, err)
+		inv := &conversationInvoker{}
+		ext := &Unstructor[invoice]{invoker: inv, prompts: prompts, log: slog.Default()}
+
+		_, err = ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+			WithModel("test-model"),
+			WithExamples(invoiceExamples(), ExamplesAsVariable, 0),
+		)
+		require.NoError(t, err)
+		require.Len(t, inv.prompts, 1)
+		assert.Contains(t, inv.prompts[0], "Output:\n{\"total\":10}")
+
+		// Without examples the template renders as before
+		inv.prompts = nil
+		_, err = ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")}, WithModel("test-model"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"Extract total."}, inv.prompts)
+	})
+
+	t.Run("context-only provider", func(t *testing.T) {
+		inv := &conversationInvoker{}
+		ext := &Unstructor[invoice]{invoker: inv, prompts: contextOnlyPrompts{}, log: slog.Default()}
+
+		_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+			WithModel("test-model"),
+			WithExamples(invoiceExamples(), ExamplesAsVariable, 0),
+		)
+		require.NoError(t, err)
+		require.Len(t, inv.messages, 1, "examples fall back to conversation turns")
+		assert.Equal(t, "Extract total.", inv.messages[0][0].Parts[0].Text)
+		assert.JSONEq(t, `{"total": 10}`, inv.messages[0][2].Parts[0].Text)
+	})
+}
+
+// contextOnlyPrompts implements ContextualPromptProvider but not AssetAwarePromptProvider
+type contextOnlyPrompts struct{}
+
+func (contextOnlyPrompts) GetPrompt(tag string, version int) (string, error) {
+	return "Extract {{.Keys}}.", nil
+}
+
+func (contextOnlyPrompts) GetPromptWithContext(tag string, version int, keys []string, document string) (string, error) {
+	return "Extract " + strings.Join(keys, ",") + ".", nil
+}
+
+func TestUnstruct_ExamplesWithPlainInvoker(t *testing.T) {
+	type invoice struct {
+		Total int `json:"total" unstruct:"invoice"`
+	}
+	inv := &chunkInvoker{}
+	ext := &Unstructor[invoice]{invoker: inv, prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}."}, log: slog.Default()}
+
+	_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 99 EUR")},
+		WithModel("test-model"),
+		WithExamples(invoiceExamples(), ExamplesAsTurns, 0),
+	)
+	require.NoError(t, err)
+	require.Len(t, inv.prompts, 1)
+	assert.True(t, strings.HasPrefix(inv.prompts[0], "Example 1:"))
+	assert.True(t, strings.HasSuffix(inv.prompts[0], "Extract total."))
+}
+
+func TestUnstruct_ParametersWithPlainInvoker(t *testing.T) {
+	type invoice struct {
+		Total int `json:"total" unstruct:"invoice?temperature=0.2"`
+	}
+	var logs bytes.Buffer
+	log := slog.New(slog.NewTextHandler(&logs, nil))
+	ext := &Unstructor[invoice]{invoker: staticInvoker(`{"total": 1}`), prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}."}, log: log}
+
+	out, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("Invoice total 1 EUR")}, WithModel("test-model"))
+	require.NoError(t, err)
+	assert.Equal(t, 1, out.Total)
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), "does not support generation parameters")
+	assert.Contains(t, logs.String(), "temperature")
+}
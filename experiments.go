@@ -0,0 +1,100 @@
+package unstruct
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+)
+
+// ErrNoDocumentID is returned for experiments on a call whose assets carry no
+// text or media to derive a document id from; use WithDocumentID
+var ErrNoDocumentID = errors.New("no content to derive a document id from")
+
+// ExperimentVariant is one arm of a prompt experiment
+type ExperimentVariant struct {
+	Name    string // recorded in GroupResult.Variant
+	Version int    // template version; 0 → the version the prompt would use otherwise
+	Model   string // model override; "" → the group's model
+	Weight  int    // relative share of documents; all zero → equal shares
+}
+
+// assignVariant picks a variant for documentID. The same prompt and document
+// always get the same variant, and shares follow the weights.
+func assignVariant(prompt, documentID string, variants []ExperimentVariant) (ExperimentVariant, error) {
+	if len(variants) == 0 {
+		return ExperimentVariant{}, fmt.Errorf("experiment %q has no variants", prompt)
+	}
+	var total uint64
+	for _, v := range variants {
+		if v.Weight < 0 {
+			return ExperimentVariant{}, fmt.Errorf("experiment %q: variant %q has negative weight", prompt, v.Name)
+		}
+		total += uint64(v.Weight)
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(prompt + "\x00" + documentID))
+	if total == 0 {
+		return variants[h.Sum64()%uint64(len(variants))], nil
+	}
+	bucket := h.Sum64() % total
+	for _, v := range variants {
+		if bucket < uint64(v.Weight) {
+			return v, nil
+		}
+		bucket -= uint64(v.Weight)
+	}
+	return variants[len(variants)-1], nil // unreachable: bucket < total
+}
+
+// applyExperiment assigns the experiment variant for label, if any, and returns
+// the label and model to use and the variant served. A version pinned in the
+// label wins over the variant's version; the variant is then not served at all
+// and "" is returned, so that metadata never names a variant that did not run.
+func applyExperiment(label, model string, opts Options) (string, string, string, error) {
+	name, pinned := splitPromptVersion(label)
+	variants, ok := opts.Experiments[name]
+	if !ok {
+		return label, model, "", nil
+	}
+	v, err := assignVariant(name, opts.DocumentID, variants)
+	if err != nil {
+		return label, model, "", err
+	}
+	if v.Version > 0 {
+		if pinned != LatestPromptVersion {
+			return label, model, "", nil
+		}
+		label = fmt.Sprintf("%s@%d", name, v.Version)
+	}
+	if v.Model != "" {
+		model = v.Model
+	}
+	return label, model, v.Name, nil
+}
+
+// documentID identifies the call's document for experiment assignment when
+// WithDocumentID is not used: a hash of its text and of the bytes or file URI
+// and MIME type of every media part. A call with neither has no identity.
+func (p *preparedAssets) documentID() (string, error) {
+	document := p.promptContext(nil).Document
+	h := sha256.New()
+	h.Write([]byte(document))
+	media := false
+	for _, msg := range p.messages() {
+		for _, part := range msg.Parts {
+			if len(part.Data) == 0 && part.FileURI == "" {
+				continue // text is part of the document
+			}
+			media = true
+			fmt.Fprintf(h, "\x00%s\x00%s\x00%d\x00", part.MimeType, part.FileURI, len(part.Data))
+			h.Write(part.Data)
+		}
+	}
+	if document == "" && !media {
+		return "", ErrNoDocumentID
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8]), nil
+}
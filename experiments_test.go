@@ -0,0 +1,163 @@
+package unstruct
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAssignVariant(t *testing.T) {
+	variants := []ExperimentVariant{
+		{Name: "control", Weight: 3},
+		{Name: "candidate", Weight: 1},
+		{Name: "off", Weight: 0},
+	}
+
+	counts := map[string]int{}
+	for i := 0; i < 4000; i++ {
+		id := fmt.Sprintf("doc-%d", i)
+		v, err := assignVariant("invoice", id, variants)
+		require.NoError(t, err)
+		again, err := assignVariant("invoice", id, variants)
+		require.NoError(t, err)
+		assert.Equal(t, v, again)
+		counts[v.Name]++
+	}
+	assert.InDelta(t, 3000, counts["control"], 200)
+	assert.InDelta(t, 1000, counts["candidate"], 200)
+	assert.Zero(t, counts["off"])
+
+	_, err := assignVariant("invoice", "doc", nil)
+	assert.ErrorContains(t, err, "no variants")
+	_, err = assignVariant("invoice", "doc", []ExperimentVariant{{Name: "bad", Weight: -1}})
+	assert.ErrorContains(t, err, "negative weight")
+}
+
+func TestUnstruct_Experiment(t *testing.T) {
+	type doc struct {
+		Total  string `json:"total" unstruct:"prompt/invoice"`
+		Vendor string `json:"vendor" unstruct:"prompt/vendor"`
+	}
+	prompts, err := NewStickPromptProvider(WithTemplates(map[string]string{
+		"invoice@v1": "invoice v1",
+		"invoice@v2": "invoice v2",
+		"vendor":     "vendor",
+	}))
+	require.NoError(t, err)
+	inv := &chunkInvoker{}
+	ext := &Unstructor[doc]{invoker: inv, prompts: prompts, log: slog.Default()}
+
+	// Find a document id for each variant, then check the call follows it
+	variants := []ExperimentVariant{
+		{Name: "control", Version: 1, Weight: 1},
+		{Name: "candidate", Version: 2, Model: "candidate-model", Weight: 1},
+	}
+	for _, want := range variants {
+		var id string
+		for i := 0; ; i++ {
+			id = fmt.Sprintf("doc-%d", i)
+			if v, _ := assignVariant("invoice", id, variants); v.Name == want.Name {
+				break
+			}
+		}
+
+		inv.prompts = nil
+		res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset("text")},
+			WithModel("test-model"),
+			WithExperiment("invoice", variants...),
+			WithDocumentID(id),
+		)
+		require.NoError(t, err)
+		assert.Contains(t, inv.prompts, fmt.Sprintf("invoice v%d", want.Version))
+
+		group, ok := res.Metadata.Group("total")
+		require.True(t, ok)
+		assert.Equal(t, want.Name, group.Variant)
+		assert.Equal(t, want.Version, group.Version)
+		if want.Model != "" {
+			assert.Equal(t, want.Model, group.Model)
+		} else {
+			assert.Equal(t, "test-model", group.Model)
+		}
+
+		vendor, ok := res.Metadata.Group("vendor")
+		require.True(t, ok)
+		assert.Empty(t, vendor.Variant)
+
+		stats, err := ext.DryRun(context.Background(), []Asset{NewTextAsset("text")},
+			WithModel("test-model"),
+			WithExperiment("invoice", variants...),
+			WithDocumentID(id),
+		)
+		require.NoError(t, err)
+		for _, g := range stats.GroupDetails {
+			if g.PromptName == "invoice" {
+				assert.Equal(t, want.Name, g.Variant)
+				assert.Equal(t, want.Version, g.Version)
+			}
+		}
+	}
+}
+
+func TestUnstruct_ExperimentWithoutDocumentID(t *testing.T) {
+	type doc struct {
+		Total string `json:"total" unstruct:"prompt/invoice"`
+	}
+	ext := newTestingUnstructor[doc](SimplePromptProvider{"invoice": "x"})
+	variants := []ExperimentVariant{{Name: "a", Weight: 1}, {Name: "b", Weight: 1}}
+
+	run := func(text string) string {
+		res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset(text)},
+			WithModel("test-model"), WithExperiment("invoice", variants...))
+		require.NoError(t, err)
+		return res.Metadata.Groups[0].Variant
+	}
+	first := run("same document")
+	assert.NotEmpty(t, first)
+	assert.Equal(t, first, run("same document"))
+}
+
+func TestPreparedAssets_DocumentID(t *testing.T) {
+	id := func(assets ...Asset) (string, error) {
+		prepared, err := prepareAssets(context.Background(), assets, slog.Default())
+		require.NoError(t, err)
+		return prepared.documentID()
+	}
+
+	first, err := id(NewMultiModalAsset("", NewImagePart([]byte{1, 2, 3}, "image/png")))
+	require.NoError(t, err)
+	again, err := id(NewMultiModalAsset("", NewImagePart([]byte{1, 2, 3}, "image/png")))
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+
+	other, err := id(NewMultiModalAsset("", NewImagePart([]byte{4, 5, 6}, "image/png")))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, other, "media-only documents are told apart by their bytes")
+	file, err := id(NewMultiModalAsset("", NewFilePart("files/abc", "application/pdf")))
+	require.NoError(t, err)
+	assert.NotEqual(t, first, file)
+
+	empty := &preparedAssets{perAsset: [][]*Message{nil}, labels: [][]string{nil}, names: []string{""}}
+	_, err = empty.documentID()
+	assert.ErrorIs(t, err, ErrNoDocumentID)
+}
+
+func TestApplyExperiment_PinnedVersion(t *testing.T) {
+	opts := Options{DocumentID: "doc", Experiments: map[string][]ExperimentVariant{
+		"invoice": {{Name: "candidate", Version: 2, Model: "candidate-model"}},
+		"vendor":  {{Name: "fast", Model: "fast-model"}},
+	}}
+
+	label, model, variant, err := applyExperiment("invoice@1", "test-model", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"invoice@1", "test-model", ""}, []string{label, model, variant},
+		"a pinned version means the variant is not served")
+
+	label, model, variant, err = applyExperiment("vendor@1", "test-model", opts)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"vendor@1", "fast-model", "fast"}, []string{label, model, variant})
+}
@@ -0,0 +1,178 @@
+package unstruct
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ExtractionConfig sets prompts, models and parameters outside the code, so they
+// can change without recompiling. It is read from YAML or JSON:
+//
+//	model: gemini-1.5-flash
+//	groups:
+//	  people:
+//	    prompt: person
+//	    model: gemini-2.0-flash
+//	    parameters: {temperature: 0.2}
+//	    timeout: 30s
+//	fields:
+//	  invoice.total:            # JSON path
+//	    prompt: totals
+//	    parameters: {temperature: 0.1}
+//	    unit: EUR
+//	  Invoice.Vendor:           # or Go Type.Field
+//	    group: people
+//
+// Field entries win over struct tags; see WithExtractionConfig.
+type ExtractionConfig struct {
+	Model          string                   `yaml:"model,omitempty"`
+	FallbackPrompt string                   `yaml:"fallbackPrompt,omitempty"`
+	Groups         map[string]GroupConfig   `yaml:"groups,omitempty"`
+	Fields         map[string]FieldOverride `yaml:"fields,omitempty"`
+	PromptVersions map[string]int           `yaml:"promptVersions,omitempty"`
+	Assets         map[string][]string      `yaml:"assets,omitempty"` // prompt label → asset labels, like WithAssetsFor
+}
+
+// GroupConfig is a named group in an ExtractionConfig, see GroupDefinition
+type GroupConfig struct {
+	Prompt     string            `yaml:"prompt,omitempty"`
+	Model      string            `yaml:"model,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+	Assets     []string          `yaml:"assets,omitempty"`
+	MaxRetries int               `yaml:"maxRetries,omitempty"`
+	Backoff    time.Duration     `yaml:"backoff,omitempty"` // e.g. 500ms
+	Timeout    time.Duration     `yaml:"timeout,omitempty"` // e.g. 30s
+}
+
+// FieldOverride replaces what a field's unstruct tag sets. Prompt and Group are
+// exclusive; parameters are merged over the tag's per key, and hints over the
+// field's desc, format, unit, enum and example tags.
+type FieldOverride struct {
+	Prompt     string            `yaml:"prompt,omitempty"`
+	Group      string            `yaml:"group,omitempty"`
+	Model      string            `yaml:"model,omitempty"`
+	Parameters map[string]string `yaml:"parameters,omitempty"`
+	FieldHint  `yaml:",inline"`
+}
+
+// tagParts expresses the override the way a tag would
+func (o FieldOverride) tagParts() tagParts {
+	tp := tagParts{prompt: o.Prompt, model: o.Model}
+	if o.Group != "" {
+		tp.prompt = "group:" + o.Group
+	}
+	return tp
+}
+
+// ParseExtractionConfig reads a YAML or JSON config. Unknown keys are errors so
+// that typos do not go unnoticed.
+func ParseExtractionConfig(data []byte) (*ExtractionConfig, error) {
+	var cfg ExtractionConfig
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("extraction config: %w", err)
+	}
+	for key, field := range cfg.Fields {
+		if field.Prompt != "" && field.Group != "" {
+			return nil, fmt.Errorf("extraction config: field %q: prompt and group are exclusive", key)
+		}
+	}
+	return &cfg, nil
+}
+
+// LoadExtractionConfig reads the config file name from fsys
+func LoadExtractionConfig(fsys fs.FS, name string) (*ExtractionConfig, error) {
+	data, err := fs.ReadFile(fsys, name)
+	if err != nil {
+		return nil, fmt.Errorf("extraction config: %w", err)
+	}
+	return ParseExtractionConfig(data)
+}
+
+// WithExtractionConfig applies cfg: its model, fallback prompt, prompt versions
+// and asset routing replace the corresponding options, its groups are added to
+// WithGroup definitions, and its field entries win over struct tags. Field keys
+// must name fields of the extracted type, otherwise extraction fails; use
+// Validate in tests to catch that early.
+func WithExtractionConfig(cfg *ExtractionConfig) func(*Options) {
+	return func(o *Options) {
+		if cfg == nil {
+			return
+		}
+		if cfg.Model != "" {
+			o.Model = cfg.Model
+		}
+		if cfg.FallbackPrompt != "" {
+			o.FallbackPrompt = cfg.FallbackPrompt
+		}
+		for name, g := range cfg.Groups {
+			WithGroup(name, g.Prompt, g.Model,
+				WithGroupParameters(g.Parameters),
+				WithGroupAssets(g.Assets...),
+				WithGroupRetry(g.MaxRetries, g.Backoff),
+				WithGroupTimeout(g.Timeout),
+			)(o)
+		}
+		for prompt, version := range cfg.PromptVersions {
+			WithPromptVersionFor(prompt, version)(o)
+		}
+		for prompt, labels := range cfg.Assets {
+			WithAssetsFor(prompt, labels...)(o)
+		}
+		if len(cfg.Fields) > 0 {
+			if o.FieldOverrides == nil {
+				o.FieldOverrides = make(map[string]FieldOverride, len(cfg.Fields))
+			}
+			maps.Copy(o.FieldOverrides, cfg.Fields)
+		}
+	}
+}
+
+// overrideKeys returns the FieldOverrides keys naming field f of t at fullKey:
+// the Go Type.Field key first, then the JSON path, which is applied last
+func (o *Options) overrideKeys(t reflect.Type, f reflect.StructField, fullKey string) []string {
+	if o == nil || len(o.FieldOverrides) == 0 {
+		return nil
+	}
+	var keys []string
+	if t.Name() != "" {
+		if goKey := t.Name() + "." + f.Name; goKey != fullKey {
+			if _, ok := o.FieldOverrides[goKey]; ok {
+				keys = append(keys, goKey)
+			}
+		}
+	}
+	if _, ok := o.FieldOverrides[fullKey]; ok {
+		keys = append(keys, fullKey)
+	}
+	return keys
+}
+
+// unknownOverrides reports FieldOverrides keys that matched no field of rt
+func unknownOverrides(opts *Options, matched map[string]bool, rt reflect.Type) error {
+	if opts == nil {
+		return nil
+	}
+	var unknown []string
+	for key := range opts.FieldOverrides {
+		if !matched[key] {
+			unknown = append(unknown, fmt.Sprintf("%q", key))
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+	slices.Sort(unknown)
+	return fmt.Errorf("extraction config: no field %s in %s", strings.Join(unknown, ", "), rt.Name())
+}
@@ -0,0 +1,149 @@
+package unstruct
+
+import (
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type configInvoice struct {
+	Number string         `json:"number" unstruct:"prompt/basic/model/gemini-1.5-flash?temperature=0.5&topK=5"`
+	Total  float64        `json:"total" unstruct:"prompt/basic"`
+	Vendor configContact  `json:"vendor" unstruct:"prompt/vendor"`
+	Notes  string         `json:"notes" unstruct:"prompt/basic"`
+	Lines  []configAmount `json:"lines" unstruct:"prompt/lines"`
+}
+
+type configContact struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+type configAmount struct {
+	Amount float64 `json:"amount"`
+}
+
+const invoiceConfigYAML = `
+model: gemini-2.0-flash
+groups:
+  people:
+    prompt: person
+    model: gemini-1.5-pro
+    parameters: {temperature: 0.2}
+    maxRetries: 2
+    timeout: 30s
+promptVersions:
+  basic: 2
+fields:
+  number:
+    prompt: numbers
+    parameters: {temperature: 0.1}
+  configInvoice.Vendor:
+    group: people
+  total:
+    unit: EUR
+    description: Grand total
+  lines.amount:
+    model: gemini-1.5-pro
+`
+
+func TestParseExtractionConfig(t *testing.T) {
+	cfg, err := ParseExtractionConfig([]byte(invoiceConfigYAML))
+	require.NoError(t, err)
+	assert.Equal(t, "gemini-2.0-flash", cfg.Model)
+	assert.Equal(t, GroupConfig{
+		Prompt:     "person",
+		Model:      "gemini-1.5-pro",
+		Parameters: map[string]string{"temperature": "0.2"},
+		MaxRetries: 2,
+		Timeout:    30 * time.Second,
+	}, cfg.Groups["people"])
+	assert.Equal(t, FieldHint{Description: "Grand total", Unit: "EUR"}, cfg.Fields["total"].FieldHint)
+
+	// JSON is read the same way
+	fromJSON, err := ParseExtractionConfig([]byte(`{"fields": {"number": {"prompt": "numbers", "parameters": {"temperature": 0.1}}}}`))
+	require.NoError(t, err)
+	assert.Equal(t, cfg.Fields["number"], fromJSON.Fields["number"])
+
+	_, err = ParseExtractionConfig([]byte("fields:\n  number:\n    promt: numbers\n"))
+	assert.ErrorContains(t, err, "field promt not found")
+
+	_, err = ParseExtractionConfig([]byte("fields:\n  number:\n    prompt: numbers\n    group: people\n"))
+	assert.ErrorContains(t, err, `field "number": prompt and group are exclusive`)
+
+	empty, err := ParseExtractionConfig(nil)
+	require.NoError(t, err)
+	assert.Empty(t, empty.Fields)
+}
+
+func TestWithExtractionConfig(t *testing.T) {
+	cfg, err := LoadExtractionConfig(fstest.MapFS{"unstruct.yaml": {Data: []byte(invoiceConfigYAML)}}, "unstruct.yaml")
+	require.NoError(t, err)
+
+	var opts Options
+	WithExtractionConfig(cfg)(&opts)
+	assert.Equal(t, "gemini-2.0-flash", opts.Model)
+	assert.Equal(t, 2, opts.PromptVersions["basic"])
+	assert.Equal(t, 30*time.Second, opts.Groups["people"].Timeout)
+
+	configs, err := ResolveFieldConfigs[configInvoice](WithExtractionConfig(cfg))
+	require.NoError(t, err)
+	byKey := map[string]FieldConfig{}
+	for _, c := range configs {
+		byKey[c.Key] = c
+	}
+
+	// Config wins over the tag, parameters merge per key
+	number := byKey["number"]
+	assert.Equal(t, "numbers", number.Prompt)
+	assert.Equal(t, "gemini-1.5-flash", number.Model)
+	assert.Equal(t, map[string]string{"temperature": "0.1", "topK": "5"}, number.Parameters)
+	assert.Equal(t, SourceConfig, number.Sources["prompt"])
+	assert.Equal(t, SourceConfig, number.Sources["?temperature"])
+	assert.Equal(t, SourceTag, number.Sources["?topK"])
+
+	// A Go Type.Field key moves the nested struct into a group
+	email := byKey["vendor.email"]
+	assert.Equal(t, "person", email.Prompt)
+	assert.Equal(t, "people", email.Group)
+	assert.Equal(t, "gemini-1.5-pro", email.Model)
+	assert.Equal(t, 2, email.MaxRetries)
+
+	assert.Equal(t, "gemini-1.5-pro", byKey["lines.amount"].Model)
+	assert.Equal(t, "gemini-2.0-flash", byKey["notes"].Model)
+
+	sch, err := schemaOfWithOptions[configInvoice](&opts, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "EUR", sch.json2field["total"].hints.Unit)
+}
+
+func TestWithExtractionConfig_UnknownFields(t *testing.T) {
+	cfg, err := ParseExtractionConfig([]byte(`
+fields:
+  totl: {prompt: totals}
+  Invoice.Number: {prompt: numbers}
+  number: {parameters: {temprature: "0.1"}}
+  notes: {group: missing}
+`))
+	require.NoError(t, err)
+
+	_, err = ResolveFieldConfigs[configInvoice](WithExtractionConfig(cfg))
+	assert.EqualError(t, err, `extraction config: no field "Invoice.Number", "totl" in configInvoice`)
+
+	err = Validate[configInvoice](WithExtractionConfig(cfg))
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	var got []string
+	for _, e := range verr.Errors {
+		got = append(got, e.Error())
+	}
+	assert.Equal(t, []string{
+		`configInvoice.Number (number): config "number": unknown parameter "temprature", want one of assets, description, enum, example, format, maxOutputTokens, maxTokens, temperature, topK, topP, unit`,
+		`configInvoice.Notes (notes): config "notes": group "missing" is not defined`,
+		`config: no field "Invoice.Number" in configInvoice`,
+		`config: no field "totl" in configInvoice`,
+	}, got)
+}
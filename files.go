@@ -0,0 +1,124 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Files API lifecycle defaults
+const (
+	DefaultFileActivationTimeout = 5 * time.Minute
+	DefaultFilePollInterval      = 2 * time.Second
+)
+
+// ErrFileNotActive is returned when an uploaded file fails processing or
+// does not become ACTIVE before the activation timeout.
+var ErrFileNotActive = errors.New("uploaded file is not active")
+
+// Cleaner is implemented by assets that hold remote resources, such as
+// uploaded files, which should be released once extraction has finished.
+type Cleaner interface {
+	Cleanup(ctx context.Context) error
+}
+
+// waitForFileActive polls the Files API until the file leaves the PROCESSING state.
+// It returns the refreshed file, or ErrFileNotActive when processing fails or times out.
+func waitForFileActive(ctx context.Context, client *genai.Client, file *genai.File, timeout, interval time.Duration, log *slog.Logger) (*genai.File, error) {
+	if file.State == genai.FileStateActive {
+		return file, nil
+	}
+	if timeout <= 0 {
+		timeout = DefaultFileActivationTimeout
+	}
+	if interval <= 0 {
+		interval = DefaultFilePollInterval
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		switch file.State {
+		case genai.FileStateActive:
+			log.Debug("File is active", "name", file.Name, "uri", file.URI)
+			return file, nil
+		case genai.FileStateFailed:
+			if file.Error != nil {
+				return nil, fmt.Errorf("%w: %s failed processing: %s", ErrFileNotActive, file.Name, file.Error.Message)
+			}
+			return nil, fmt.Errorf("%w: %s failed processing", ErrFileNotActive, file.Name)
+		}
+
+		if !time.Now().Before(deadline) {
+			return nil, fmt.Errorf("%w: %s still %s after %s", ErrFileNotActive, file.Name, file.State, timeout)
+		}
+
+		log.Debug("Waiting for file to become active", "name", file.Name, "state", file.State, "interval", interval)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		refreshed, err := client.Files.Get(ctx, file.Name, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get file %s: %w", file.Name, err)
+		}
+		file = refreshed
+	}
+}
+
+// deleteUploadedFile removes a file from the Files API.
+// Files that are already gone are not treated as an error.
+func deleteUploadedFile(ctx context.Context, client *genai.Client, file *genai.File) error {
+	if client == nil || file == nil || file.Name == "" {
+		return nil
+	}
+	if _, err := client.Files.Delete(ctx, file.Name, nil); err != nil {
+		if fileNotFound(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to delete file %s: %w", file.Name, err)
+	}
+	return nil
+}
+
+// fileNotFound reports whether err says that a Files API file does not exist
+func fileNotFound(err error) bool {
+	var apiErr genai.APIError
+	return errors.As(err, &apiErr) && apiErr.Code == http.StatusNotFound
+}
+
+// fileExpired reports whether an uploaded file is past its Files API expiry
+// or outside the retention window measured from uploadedAt.
+func fileExpired(file *genai.File, uploadedAt time.Time, retentionDays int, now time.Time) bool {
+	if file == nil {
+		return false
+	}
+	if !file.ExpirationTime.IsZero() && !now.Before(file.ExpirationTime) {
+		return true
+	}
+	if retentionDays > 0 && !uploadedAt.IsZero() {
+		return !now.Before(uploadedAt.Add(time.Duration(retentionDays) * 24 * time.Hour))
+	}
+	return false
+}
+
+// cleanupAssets releases remote resources held by assets implementing Cleaner.
+// Failures are logged rather than returned so they never mask the extraction result.
+func cleanupAssets(ctx context.Context, assets []Asset, log *slog.Logger) {
+	ctx = context.WithoutCancel(ctx)
+	for i, asset := range assets {
+		c, ok := asset.(Cleaner)
+		if !ok {
+			continue
+		}
+		if err := c.Cleanup(ctx); err != nil {
+			log.Warn("Asset cleanup failed", "index", i, "asset_type", fmt.Sprintf("%T", asset), "error", err)
+		}
+	}
+}
@@ -0,0 +1,339 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+// fakeFilesAPI emulates the subset of the Gemini Files API used by FileAsset
+type fakeFilesAPI struct {
+	mu          sync.Mutex
+	uploads     int
+	gets        int
+	deleted     []string
+	pendingGets int    // number of Get calls that still report PROCESSING
+	finalState  string // state reported once pendingGets is exhausted
+	server      *httptest.Server
+}
+
+func newFakeFilesAPI(t *testing.T) (*fakeFilesAPI, *genai.Client) {
+	t.Helper()
+	f := &fakeFilesAPI{finalState: "ACTIVE"}
+	f.server = httptest.NewServer(http.HandlerFunc(f.handle))
+	t.Cleanup(f.server.Close)
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: f.server.URL},
+	})
+	require.NoError(t, err)
+	return f, client
+}
+
+func (f *fakeFilesAPI) handle(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	w.Header().Set("Content-Type", "application/json")
+	switch {
+	case r.Method == http.MethodPost && r.URL.Path == "/upload/v1beta/files":
+		f.uploads++
+		w.Header().Set("X-Goog-Upload-URL", fmt.Sprintf("%s/session/%d", f.server.URL, f.uploads))
+		_, _ = w.Write([]byte("{}"))
+	case r.Method == http.MethodPost && strings.HasPrefix(r.URL.Path, "/session/"):
+		id := strings.TrimPrefix(r.URL.Path, "/session/")
+		state := "PROCESSING"
+		if f.pendingGets == 0 {
+			state = f.finalState
+		}
+		w.Header().Set("X-Goog-Upload-Status", "final")
+		_ = json.NewEncoder(w).Encode(map[string]any{"file": f.file(id, state)})
+	case r.Method == http.MethodGet && strings.HasPrefix(r.URL.Path, "/v1beta/files/"):
+		f.gets++
+		if slices.Contains(f.deleted, "files/"+strings.TrimPrefix(r.URL.Path, "/v1beta/files/")) {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"error": {"code": 404, "message": "file not found", "status": "NOT_FOUND"}}`))
+			return
+		}
+		state := f.finalState
+		if f.pendingGets > 0 {
+			f.pendingGets--
+			state = "PROCESSING"
+		}
+		_ = json.NewEncoder(w).Encode(f.file(strings.TrimPrefix(r.URL.Path, "/v1beta/files/"), state))
+	case r.Method == http.MethodDelete && strings.HasPrefix(r.URL.Path, "/v1beta/files/"):
+		f.deleted = append(f.deleted, "files/"+strings.TrimPrefix(r.URL.Path, "/v1beta/files/"))
+		_, _ = w.Write([]byte("{}"))
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+func (f *fakeFilesAPI) file(id, state string) map[string]any {
+	m := map[string]any{
+		"name":     "files/" + id,
+		"uri":      f.server.URL + "/v1beta/files/" + id,
+		"mimeType": "text/plain",
+		"state":    state,
+	}
+	if state == "FAILED" {
+		m["error"] = map[string]any{"message": "unsupported document"}
+	}
+	return m
+}
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestFileAsset_WaitsForActive(t *testing.T) {
+	api, client := newFakeFilesAPI(t)
+	api.pendingGets = 2
+
+	asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"),
+		WithMimeType("text/plain"), WithPollInterval(time.Millisecond))
+
+	messages, err := asset.CreateMessages(context.Background(), slog.Default())
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	assert.Equal(t, "file", messages[0].Parts[0].Type)
+	assert.Equal(t, 3, api.gets)
+	assert.Equal(t, genai.FileStateActive, asset.uploadedFile.State)
+}
+
+func TestFileAsset_ActivationFailure(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("failed state", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		api.finalState = "FAILED"
+		asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"), WithPollInterval(time.Millisecond))
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		assert.ErrorIs(t, err, ErrFileNotActive)
+		assert.Contains(t, err.Error(), "unsupported document")
+	})
+
+	t.Run("timeout", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		api.pendingGets = 1000
+		asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"),
+			WithPollInterval(time.Millisecond), WithActivationTimeout(20*time.Millisecond))
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		assert.ErrorIs(t, err, ErrFileNotActive)
+	})
+}
+
+func TestFileAsset_Cleanup(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("auto cleanup deletes", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"), WithAutoCleanup(true))
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		require.NoError(t, asset.Cleanup(ctx))
+		assert.Equal(t, []string{"files/1"}, api.deleted)
+		assert.Nil(t, asset.uploadedFile)
+	})
+
+	t.Run("kept without auto cleanup", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"), WithRetentionDays(1))
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		require.NoError(t, asset.Cleanup(ctx))
+		assert.Empty(t, api.deleted)
+	})
+
+	t.Run("retention elapsed", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"), WithRetentionDays(1))
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		asset.uploadedAt = time.Now().Add(-25 * time.Hour)
+
+		// The expired upload is replaced on the next use
+		_, err = asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		assert.Equal(t, 2, api.uploads)
+		assert.Equal(t, []string{"files/1"}, api.deleted)
+
+		asset.uploadedAt = time.Now().Add(-25 * time.Hour)
+		require.NoError(t, asset.Cleanup(ctx))
+		assert.Equal(t, []string{"files/1", "files/2"}, api.deleted)
+	})
+}
+
+func TestBatchFileAsset_Cleanup(t *testing.T) {
+	ctx := context.Background()
+	api, client := newFakeFilesAPI(t)
+
+	asset := NewBatchFileAsset(client, []string{
+		writeTempFile(t, "a.txt", "a"),
+		writeTempFile(t, "b.txt", "b"),
+	}, WithBatchAutoCleanup(true))
+
+	_, err := asset.CreateMessages(ctx, slog.Default())
+	require.NoError(t, err)
+	require.NoError(t, asset.Cleanup(ctx))
+	assert.ElementsMatch(t, []string{"files/1", "files/2"}, api.deleted)
+	for _, fa := range asset.files {
+		assert.Nil(t, fa.uploadedFile)
+	}
+}
+
+func TestBatchFileAsset_Results(t *testing.T) {
+	ctx := context.Background()
+	missing := filepath.Join(t.TempDir(), "missing.txt")
+
+	t.Run("tolerates failures", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		good := writeTempFile(t, "a.txt", "a")
+		asset := NewBatchFileAsset(client, []string{good, missing}, WithBatchConcurrency(2))
+
+		messages, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		assert.Len(t, messages, 1)
+		assert.Equal(t, 1, api.uploads)
+
+		results := asset.Results()
+		require.Len(t, results, 2)
+		assert.Equal(t, BatchFileUploaded, results[0].Status)
+		assert.NotEmpty(t, results[0].URI)
+		assert.Equal(t, BatchFileFailed, results[1].Status)
+		assert.Equal(t, missing, results[1].Path)
+		assert.Error(t, results[1].Err)
+	})
+
+	t.Run("max failures", func(t *testing.T) {
+		_, client := newFakeFilesAPI(t)
+		asset := NewBatchFileAsset(client, []string{writeTempFile(t, "a.txt", "a"), missing}, WithBatchMaxFailures(1))
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+
+		asset.FilePaths = append(asset.FilePaths, missing+"2")
+		_, err = asset.CreateMessages(ctx, slog.Default())
+		var batchErr *BatchUploadError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Contains(t, err.Error(), "2 of 3 files failed")
+		assert.Len(t, batchErr.Unwrap(), 2)
+	})
+
+	t.Run("fail fast", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		paths := []string{missing}
+		for i := 0; i < 5; i++ {
+			paths = append(paths, writeTempFile(t, fmt.Sprintf("%d.txt", i), fmt.Sprint(i)))
+		}
+		asset := NewBatchFileAsset(client, paths, WithBatchConcurrency(1), WithBatchFailFast())
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		var batchErr *BatchUploadError
+		require.ErrorAs(t, err, &batchErr)
+		assert.Equal(t, 0, api.uploads)
+		for _, r := range batchErr.Results[1:] {
+			assert.Equal(t, BatchFileSkipped, r.Status)
+		}
+	})
+
+	t.Run("resumes", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		late := filepath.Join(t.TempDir(), "late.txt")
+		asset := NewBatchFileAsset(client, []string{writeTempFile(t, "a.txt", "a"), late})
+
+		_, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		require.NoError(t, os.WriteFile(late, []byte("late"), 0o600))
+
+		messages, err := asset.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		assert.Len(t, messages, 2)
+		assert.Equal(t, 2, api.uploads)
+
+		results := asset.Results()
+		assert.True(t, results[0].Reused)
+		assert.False(t, results[1].Reused)
+		assert.Equal(t, BatchFileUploaded, results[1].Status)
+	})
+
+	t.Run("reused from upload cache", func(t *testing.T) {
+		api, client := newFakeFilesAPI(t)
+		cache := NewMemoryUploadCache()
+		shared := writeTempFile(t, "shared.txt", "shared")
+
+		first := NewBatchFileAsset(client, []string{shared}, WithBatchUploadCache(cache))
+		_, err := first.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		assert.False(t, first.Results()[0].Reused)
+
+		second := NewBatchFileAsset(client, []string{shared, writeTempFile(t, "new.txt", "new")}, WithBatchUploadCache(cache))
+		_, err = second.CreateMessages(ctx, slog.Default())
+		require.NoError(t, err)
+		assert.Equal(t, 2, api.uploads)
+		results := second.Results()
+		assert.True(t, results[0].Reused, "a cache hit is a reuse")
+		assert.False(t, results[1].Reused)
+	})
+}
+
+func TestAbortedByBatch(t *testing.T) {
+	ctx := context.Background()
+	aborted, abort := context.WithCancel(ctx)
+	abort()
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+
+	assert.True(t, abortedByBatch(fmt.Errorf("upload: %w", context.Canceled), aborted, ctx))
+	assert.False(t, abortedByBatch(errors.New("permission denied"), aborted, ctx), "own failures after an abort are failures")
+	assert.False(t, abortedByBatch(context.Canceled, ctx, ctx), "not aborted")
+	assert.False(t, abortedByBatch(context.Canceled, aborted, cancelled), "the caller cancelled")
+}
+
+func TestUnstruct_CleansUpAssets(t *testing.T) {
+	api, client := newFakeFilesAPI(t)
+	type doc struct {
+		Name string `json:"name" unstruct:"basic"`
+	}
+	ext := newTestingUnstructor[doc](mockPrompts{})
+
+	asset := NewFileAsset(client, writeTempFile(t, "doc.txt", "hello"), WithAutoCleanup(true))
+	_, err := ext.Unstruct(context.Background(), []Asset{asset}, WithModel("test-model"))
+	require.NoError(t, err)
+
+	assert.NotEmpty(t, api.deleted)
+	assert.Nil(t, asset.uploadedFile)
+}
+
+func TestFileExpired(t *testing.T) {
+	now := time.Now()
+	assert.False(t, fileExpired(nil, now, 1, now))
+	assert.False(t, fileExpired(&genai.File{}, now, 0, now))
+	assert.True(t, fileExpired(&genai.File{ExpirationTime: now.Add(-time.Minute)}, now, 0, now))
+	assert.True(t, fileExpired(&genai.File{}, now.Add(-48*time.Hour), 1, now))
+	assert.False(t, fileExpired(&genai.File{}, now.Add(-time.Hour), 1, now))
+}
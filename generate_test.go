@@ -0,0 +1,89 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+func TestBuildContents_Roles(t *testing.T) {
+	messages := []*Message{
+		NewSystemMessage(NewTextPart("You extract invoices.")),
+	}
+	messages = append(messages, NewExampleTurns(`{"total": 10}`, NewTextPart("Total: 10 EUR"))...)
+	messages = append(messages,
+		&Message{Role: RoleAssistant, Parts: []*Part{NewTextPart("noted")}},
+		NewSystemMessage(NewTextPart("Answer in JSON.")),
+		NewUserMessage(NewTextPart("Total: 99 EUR")),
+	)
+
+	contents, system, err := buildContents(messages, slog.Default())
+	require.NoError(t, err)
+
+	require.NotNil(t, system)
+	require.Len(t, system.Parts, 2)
+	assert.Equal(t, "You extract invoices.", system.Parts[0].Text)
+	assert.Equal(t, "Answer in JSON.", system.Parts[1].Text)
+
+	var roles []string
+	for _, c := range contents {
+		roles = append(roles, c.Role)
+	}
+	assert.Equal(t, []string{genai.RoleUser, genai.RoleModel, genai.RoleModel, genai.RoleUser}, roles)
+	assert.Equal(t, `{"total": 10}`, contents[1].Parts[0].Text)
+
+	_, _, err = buildContents([]*Message{{Role: "tool", Parts: []*Part{NewTextPart("x")}}}, slog.Default())
+	assert.ErrorContains(t, err, `unsupported message role "tool"`)
+}
+
+func TestGenerateBytes_SendsSystemInstruction(t *testing.T) {
+	type generateRequest struct {
+		Contents          []*genai.Content `json:"contents"`
+		SystemInstruction *genai.Content   `json:"systemInstruction"`
+	}
+	// The handler runs on the server's goroutine, so the request is checked here
+	requests := make(chan generateRequest, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request generateRequest
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests <- request
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"candidates": []any{map[string]any{
+				"content": map[string]any{"role": "model", "parts": []any{map[string]any{"text": `{"ok": true}`}}},
+			}},
+		})
+	}))
+	defer server.Close()
+
+	client, err := genai.NewClient(context.Background(), &genai.ClientConfig{
+		APIKey:      "test-key",
+		Backend:     genai.BackendGeminiAPI,
+		HTTPOptions: genai.HTTPOptions{BaseURL: server.URL},
+	})
+	require.NoError(t, err)
+
+	out, err := GenerateBytes(context.Background(), client, slog.Default(),
+		WithModelName("test-model"),
+		WithMessages(
+			NewSystemMessage(NewTextPart("instructions")),
+			NewUserMessage(NewTextPart("document")),
+		),
+	)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ok": true}`, string(out))
+
+	request := <-requests
+	require.NotNil(t, request.SystemInstruction)
+	assert.Equal(t, "instructions", request.SystemInstruction.Parts[0].Text)
+	require.Len(t, request.Contents, 1)
+	assert.Equal(t, genai.RoleUser, request.Contents[0].Role)
+	assert.Equal(t, "document", request.Contents[0].Parts[0].Text)
+}
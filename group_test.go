@@ -1,7 +1,12 @@
 package unstruct
 
 import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -147,3 +152,149 @@ func TestGroupTagParsing(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveFieldConfigs(t *testing.T) {
+	type contact struct {
+		Email string `json:"email"`
+		Phone string `json:"phone" unstruct:"?temperature=0.9"`
+	}
+	type person struct {
+		Name    string  `json:"name" unstruct:"group/people"`
+		Title   string  `json:"title" unstruct:"group/people/model/gemini-1.5-pro?topK=5"`
+		Contact contact `json:"contact" unstruct:"group/people"`
+		Notes   string  `json:"notes" unstruct:"notes"`
+	}
+
+	configs, err := ResolveFieldConfigs[person](
+		WithModel("gemini-1.5-flash"),
+		WithRetry(1, time.Millisecond),
+		WithGroup("people", "person", "gemini-2.0-flash",
+			WithGroupParameters(map[string]string{"temperature": "0.2", "topK": "10"}),
+			WithGroupAssets("cv"),
+			WithGroupRetry(3, time.Second),
+			WithGroupTimeout(5*time.Second),
+		),
+	)
+	require.NoError(t, err)
+	require.Len(t, configs, 5)
+
+	name := configs[0]
+	assert.Equal(t, FieldConfig{
+		Key:        "name",
+		Prompt:     "person",
+		Group:      "people",
+		Model:      "gemini-2.0-flash",
+		Parameters: map[string]string{"temperature": "0.2", "topK": "10", "assets": "cv"},
+		MaxRetries: 3,
+		Backoff:    time.Second,
+		Timeout:    5 * time.Second,
+		Sources: map[string]string{
+			"prompt": SourceGroup, "model": SourceGroup, "retry": SourceGroup, "timeout": SourceGroup,
+			"?temperature": SourceGroup, "?topK": SourceGroup, "?assets": SourceGroup,
+		},
+	}, name)
+
+	// The field's own tag wins over the group
+	title := configs[1]
+	assert.Equal(t, "title", title.Key)
+	assert.Equal(t, "gemini-1.5-pro", title.Model)
+	assert.Equal(t, SourceTag, title.Sources["model"])
+	assert.Equal(t, map[string]string{"temperature": "0.2", "topK": "5", "assets": "cv"}, title.Parameters)
+	assert.Equal(t, SourceTag, title.Sources["?topK"])
+
+	// Nested fields inherit the group's settings and may override parameters
+	email, phone := configs[2], configs[3]
+	assert.Equal(t, "contact.email", email.Key)
+	assert.Equal(t, "people", email.Group)
+	assert.Equal(t, "person", email.Prompt)
+	assert.Equal(t, SourceParent, email.Sources["prompt"])
+	assert.Equal(t, SourceParent, email.Sources["?temperature"])
+	assert.Equal(t, 5*time.Second, email.Timeout)
+	assert.Equal(t, "0.9", phone.Parameters["temperature"])
+	assert.Equal(t, SourceTag, phone.Sources["?temperature"])
+	assert.Equal(t, "10", phone.Parameters["topK"])
+
+	// Without a group, Options apply
+	notes := configs[4]
+	assert.Equal(t, "notes", notes.Prompt)
+	assert.Empty(t, notes.Group)
+	assert.Equal(t, "gemini-1.5-flash", notes.Model)
+	assert.Equal(t, SourceOptions, notes.Sources["model"])
+	assert.Equal(t, 1, notes.MaxRetries)
+	assert.Nil(t, notes.Parameters)
+}
+
+// flakyInvoker fails the first failures calls and waits for delay on each call,
+// or on the first slow calls when slow is set
+type flakyInvoker struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+	slow     int
+	delay    time.Duration
+}
+
+func (f *flakyInvoker) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	f.mu.Lock()
+	f.calls++
+	fail := f.calls <= f.failures
+	delay := f.delay
+	if f.slow > 0 && f.calls > f.slow {
+		delay = 0
+	}
+	f.mu.Unlock()
+
+	select {
+	case <-time.After(delay):
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fail {
+		return nil, errors.New("temporary failure")
+	}
+	return []byte(`{"name": "Ada"}`), nil
+}
+
+func TestUnstruct_GroupRetryAndTimeout(t *testing.T) {
+	type person struct {
+		Name string `json:"name" unstruct:"group/people"`
+	}
+	assets := []Asset{NewTextAsset("Ada")}
+
+	inv := &flakyInvoker{failures: 2}
+	ext := &Unstructor[person]{invoker: inv, prompts: SimplePromptProvider{"person": "Extract {{.Keys}}"}, log: slog.Default()}
+	res, err := ext.Unstruct(context.Background(), assets, WithModel("test-model"),
+		WithGroup("people", "person", "", WithGroupRetry(2, time.Millisecond)))
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", res.Name)
+	assert.Equal(t, 3, inv.calls)
+
+	inv = &flakyInvoker{delay: time.Second}
+	ext.invoker = inv
+	_, err = ext.Unstruct(context.Background(), assets, WithModel("test-model"),
+		WithGroup("people", "person", "", WithGroupTimeout(10*time.Millisecond)))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// The timeout applies to each attempt, so a retry gets the full duration
+	inv = &flakyInvoker{slow: 1, delay: time.Second}
+	ext.invoker = inv
+	res, err = ext.Unstruct(context.Background(), assets, WithModel("test-model"),
+		WithGroup("people", "person", "", WithGroupTimeout(50*time.Millisecond), WithGroupRetry(1, time.Millisecond)))
+	require.NoError(t, err)
+	assert.Equal(t, "Ada", res.Name)
+	assert.Equal(t, 2, inv.calls)
+}
+
+func TestValidate_GroupParameters(t *testing.T) {
+	type person struct {
+		Name string `json:"name" unstruct:"group/people"`
+	}
+	err := Validate[person](WithGroup("people", "person", "",
+		WithGroupParameters(map[string]string{"temperature": "3", "TopP": "0.5"})))
+
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 2)
+	assert.Equal(t, `group/people: unknown parameter "TopP", did you mean "topP"?`, verr.Errors[0].Error())
+	assert.Equal(t, `group/people: temperature must be a number between 0 and 1, got "3"`, verr.Errors[1].Error())
+}
@@ -0,0 +1,244 @@
+package unstruct
+
+import (
+	"context"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// GroupOption configures a GroupDefinition passed to WithGroup
+type GroupOption func(*GroupDefinition)
+
+// WithGroupParameters sets generation parameters, such as temperature or topK,
+// for every field of the group. A field's own tag parameters win per key.
+func WithGroupParameters(parameters map[string]string) GroupOption {
+	return func(g *GroupDefinition) {
+		if g.Parameters == nil {
+			g.Parameters = make(map[string]string, len(parameters))
+		}
+		for k, v := range parameters {
+			g.Parameters[k] = v
+		}
+	}
+}
+
+// WithGroupAssets routes only the assets with these labels to the group
+func WithGroupAssets(labels ...string) GroupOption {
+	return func(g *GroupDefinition) { g.Assets = labels }
+}
+
+// WithGroupRetry overrides WithRetry for the group's prompt calls
+func WithGroupRetry(max int, backoff time.Duration) GroupOption {
+	return func(g *GroupDefinition) {
+		g.MaxRetries = max
+		g.Backoff = backoff
+	}
+}
+
+// WithGroupTimeout limits each model call of the group. Every retry and every
+// chunk gets the full duration.
+func WithGroupTimeout(d time.Duration) GroupOption {
+	return func(g *GroupDefinition) { g.Timeout = d }
+}
+
+// Sources of a resolved setting, see FieldConfig.Sources
+const (
+	SourceTag     = "tag"     // the field's own unstruct tag
+	SourceGroup   = "group"   // the named group the field's tag references
+	SourceParent  = "parent"  // inherited from the enclosing struct field
+	SourceConfig  = "config"  // WithExtractionConfig, which wins over the tag
+	SourceOptions = "options" // Options: WithModel, WithModelFor, WithRetry, ...
+)
+
+// FieldConfig is the resolved extraction configuration of one field
+type FieldConfig struct {
+	Key        string            // JSON key path, e.g. "invoice.total"
+	Prompt     string            // prompt label; "" → fallback or generated prompt
+	Group      string            // named group the field belongs to, if any
+	Model      string            // "" when neither the field nor Options set one
+	Parameters map[string]string // generation parameters and ?assets=
+	MaxRetries int
+	Backoff    time.Duration
+	Timeout    time.Duration // per model call; Options.Timeout still bounds the whole extraction
+	// Sources names where each setting came from: SourceConfig, SourceTag,
+	// SourceGroup, SourceParent or SourceOptions. Keys are "prompt", "model", "retry",
+	// "timeout" and "?name" for each parameter.
+	Sources map[string]string
+}
+
+// ResolveFieldConfigs reports the configuration every field of T is extracted
+// with, in declaration order. Settings are taken from WithExtractionConfig first,
+// then the field's tag, then the group either references, then inherited from the
+// enclosing field, and finally from Options. Options.FieldModels overrides the
+// model of a field.
+func ResolveFieldConfigs[T any](optFns ...func(*Options)) ([]FieldConfig, error) {
+	var opts Options
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+	sch, err := schemaOfWithOptions[T](&opts, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []FieldConfig
+	for pk, keys := range sch.group2keys {
+		for _, key := range keys {
+			spec := sch.json2field[key]
+			fc := FieldConfig{
+				Key:        key,
+				Prompt:     pk.prompt,
+				Group:      pk.group,
+				Model:      spec.model,
+				Parameters: maps.Clone(spec.parameters),
+				MaxRetries: opts.MaxRetries,
+				Backoff:    opts.Backoff,
+				Sources:    maps.Clone(spec.sources),
+			}
+			if fc.Sources == nil {
+				fc.Sources = make(map[string]string)
+			}
+			if fc.Model == "" && opts.Model != "" {
+				fc.Model = opts.Model
+				fc.Sources["model"] = SourceOptions
+			}
+			fc.Sources["retry"] = SourceOptions
+			if def, ok := opts.Groups[pk.group]; ok {
+				if def.MaxRetries > 0 || def.Backoff > 0 {
+					fc.Sources["retry"] = SourceGroup
+				}
+				if def.MaxRetries > 0 {
+					fc.MaxRetries = def.MaxRetries
+				}
+				if def.Backoff > 0 {
+					fc.Backoff = def.Backoff
+				}
+				if def.Timeout > 0 {
+					fc.Timeout = def.Timeout
+					fc.Sources["timeout"] = SourceGroup
+				}
+			}
+			out = append(out, fc)
+		}
+	}
+
+	slices.SortFunc(out, func(a, b FieldConfig) int {
+		return slices.Compare(sch.json2field[a.Key].index, sch.json2field[b.Key].index)
+	})
+	return out, nil
+}
+
+// inherited is the configuration a field resolves and passes to nested fields
+type inherited struct {
+	prompt     string
+	group      string
+	model      string
+	parameters map[string]string
+	sources    map[string]string // see FieldConfig.Sources
+}
+
+// child starts the configuration of a nested field from its parent's
+func (p inherited) child() inherited {
+	c := inherited{
+		prompt:     p.prompt,
+		group:      p.group,
+		model:      p.model,
+		parameters: maps.Clone(p.parameters),
+		sources:    make(map[string]string, len(p.sources)),
+	}
+	for k := range p.sources {
+		c.sources[k] = SourceParent
+	}
+	return c
+}
+
+// apply sets what tp, the group it references and parameters define, recording
+// source for the prompt, model and each parameter. parameters exclude field hints.
+func (c *inherited) apply(tp tagParts, parameters map[string]string, source string, opts *Options) {
+	if name, ok := strings.CutPrefix(tp.prompt, "group:"); ok {
+		c.prompt, c.group = tp.prompt, name // left unresolved when the group is unknown
+		c.sources["prompt"] = source
+		if def, ok := opts.group(name); ok {
+			c.prompt = def.Prompt
+			c.sources["prompt"] = SourceGroup
+			if def.Model != "" {
+				c.model = def.Model
+				c.sources["model"] = SourceGroup
+			}
+			for k, v := range def.Parameters {
+				c.setParameter(k, v, SourceGroup)
+			}
+			if len(def.Assets) > 0 {
+				c.setParameter(assetsParam, strings.Join(def.Assets, ","), SourceGroup)
+			}
+		}
+	} else if tp.prompt != "" {
+		c.prompt, c.group = tp.prompt, ""
+		c.sources["prompt"] = source
+	}
+
+	if tp.model != "" {
+		c.model = tp.model
+		c.sources["model"] = source
+	}
+	for k, v := range parameters {
+		c.setParameter(k, v, source)
+	}
+}
+
+func (c *inherited) setParameter(k, v, source string) {
+	if c.parameters == nil {
+		c.parameters = make(map[string]string)
+	}
+	c.parameters[k] = v
+	c.sources["?"+k] = source
+}
+
+// group returns the named group definition, if any
+func (o *Options) group(name string) (GroupDefinition, bool) {
+	if o == nil {
+		return GroupDefinition{}, false
+	}
+	def, ok := o.Groups[name]
+	return def, ok
+}
+
+// fieldModel returns the WithModelFor override for field f of t
+func (o *Options) fieldModel(t reflect.Type, f reflect.StructField) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+	model, ok := o.FieldModels[t.Name()+"."+f.Name]
+	return model, ok
+}
+
+// groupCall applies a named group's retry policy and timeout to opts for one
+// prompt call
+func groupCall(group string, opts Options) Options {
+	def, ok := opts.Groups[group]
+	if !ok {
+		return opts
+	}
+	if def.MaxRetries > 0 {
+		opts.MaxRetries = def.MaxRetries
+	}
+	if def.Backoff > 0 {
+		opts.Backoff = def.Backoff
+	}
+	if def.Timeout > 0 {
+		opts.attemptTimeout = def.Timeout
+	}
+	return opts
+}
+
+// attemptContext bounds one model call by the group's timeout. The returned
+// cancel function must be called.
+func attemptContext(ctx context.Context, opts Options) (context.Context, context.CancelFunc) {
+	if opts.attemptTimeout > 0 {
+		return context.WithTimeout(ctx, opts.attemptTimeout)
+	}
+	return ctx, func() {}
+}
@@ -0,0 +1,400 @@
+package unstruct
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	_ "image/gif" // register GIF decoder
+	"image/jpeg"
+	"image/png"
+	"math"
+	"strings"
+)
+
+// defaultJPEGQuality is used when an image must be re-encoded as JPEG
+// but ImagePreprocessing.JPEGQuality is not set
+const defaultJPEGQuality = 90
+
+// DefaultMaxImagePixels is the decoded size limit used when
+// ImagePreprocessing.MaxPixels is not set, 8192×8192 pixels
+const DefaultMaxImagePixels = 8192 * 8192
+
+// ErrImageTooLarge is returned when an image to preprocess has more pixels than
+// allowed. The size is read from the header, before any pixel is decoded.
+var ErrImageTooLarge = errors.New("image too large")
+
+// ImagePreprocessing configures optional transformations applied to image
+// data before it is sent to the model. The zero value leaves images untouched.
+type ImagePreprocessing struct {
+	MaxDimension int          // longest side in pixels after resizing; 0 → keep size
+	AutoOrient   bool         // apply EXIF orientation and drop the tag
+	Grayscale    bool         // convert to 8-bit grayscale
+	JPEGQuality  int          // 1-100; > 0 forces JPEG re-encoding at this quality
+	Tiling       *ImageTiling // split very large images into overlapping crops
+	MaxPixels    int          // width×height limit for decoding; 0 → DefaultMaxImagePixels
+}
+
+// ImageTiling splits images whose longest side exceeds Threshold into
+// TileSize×TileSize crops that overlap by Overlap pixels.
+// Each tile is then resized according to MaxDimension.
+type ImageTiling struct {
+	Threshold int
+	TileSize  int
+	Overlap   int
+}
+
+// isZero reports whether the configuration leaves images untouched
+func (p ImagePreprocessing) isZero() bool {
+	return p.MaxDimension <= 0 && !p.AutoOrient && !p.Grayscale && p.JPEGQuality <= 0 && p.Tiling == nil
+}
+
+func (p ImagePreprocessing) validate() error {
+	if p.MaxDimension < 0 {
+		return fmt.Errorf("max dimension %d must not be negative", p.MaxDimension)
+	}
+	if p.MaxPixels < 0 {
+		return fmt.Errorf("max pixels %d must not be negative", p.MaxPixels)
+	}
+	if p.JPEGQuality < 0 || p.JPEGQuality > 100 {
+		return fmt.Errorf("JPEG quality %d must be between 1 and 100", p.JPEGQuality)
+	}
+	if t := p.Tiling; t != nil {
+		if t.TileSize <= 0 {
+			return fmt.Errorf("tile size %d must be greater than 0", t.TileSize)
+		}
+		if t.Overlap < 0 || t.Overlap >= t.TileSize {
+			return fmt.Errorf("tile overlap %d must be between 0 and tile size %d", t.Overlap, t.TileSize)
+		}
+	}
+	return nil
+}
+
+// PreprocessImage applies the configured transformations to encoded image data
+// and returns one or more image parts. Data that is not a decodable JPEG, PNG
+// or GIF image is returned unchanged as a single part. Images with more than
+// MaxPixels pixels are rejected with ErrImageTooLarge before decoding.
+func PreprocessImage(data []byte, mimeType string, p ImagePreprocessing) ([]*Part, error) {
+	if err := p.validate(); err != nil {
+		return nil, fmt.Errorf("image preprocessing: %w", err)
+	}
+	if p.isZero() || !strings.HasPrefix(mimeType, "image/") {
+		return []*Part{NewImagePart(data, mimeType)}, nil
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if errors.Is(err, image.ErrFormat) {
+		return []*Part{NewImagePart(data, mimeType)}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+	limit := p.MaxPixels
+	if limit == 0 {
+		limit = DefaultMaxImagePixels
+	}
+	if pixels := int64(cfg.Width) * int64(cfg.Height); pixels > int64(limit) {
+		return nil, fmt.Errorf("%w: %d×%d exceeds %d pixels", ErrImageTooLarge, cfg.Width, cfg.Height, limit)
+	}
+
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("decode image: %w", err)
+	}
+
+	orientation := 1
+	if p.AutoOrient && format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+
+	bounds := src.Bounds()
+	longest := max(bounds.Dx(), bounds.Dy())
+	needsTiling := p.Tiling != nil && longest > p.Tiling.Threshold
+	needsResize := p.MaxDimension > 0 && longest > p.MaxDimension
+	if orientation == 1 && !needsTiling && !needsResize && !p.Grayscale && p.JPEGQuality <= 0 {
+		return []*Part{NewImagePart(data, mimeType)}, nil
+	}
+
+	img := toRGBA(src)
+	img = applyOrientation(img, orientation)
+
+	crops := []*image.RGBA{img}
+	if needsTiling {
+		crops = tileImage(img, *p.Tiling)
+	}
+
+	parts := make([]*Part, 0, len(crops))
+	for _, crop := range crops {
+		out := resizeToFit(crop, p.MaxDimension)
+		encoded, outMIME, err := encodeImage(out, format, p)
+		if err != nil {
+			return nil, err
+		}
+		parts = append(parts, NewImagePart(encoded, outMIME))
+	}
+	return parts, nil
+}
+
+// encodeImage writes PNG for lossless sources unless JPEG quality is forced
+func encodeImage(img *image.RGBA, format string, p ImagePreprocessing) ([]byte, string, error) {
+	var out image.Image = img
+	if p.Grayscale {
+		gray := image.NewGray(img.Bounds())
+		draw.Draw(gray, gray.Bounds(), img, img.Bounds().Min, draw.Src)
+		out = gray
+	}
+
+	var buf bytes.Buffer
+	if p.JPEGQuality <= 0 && format != "jpeg" {
+		if err := png.Encode(&buf, out); err != nil {
+			return nil, "", fmt.Errorf("encode png: %w", err)
+		}
+		return buf.Bytes(), "image/png", nil
+	}
+
+	quality := p.JPEGQuality
+	if quality <= 0 {
+		quality = defaultJPEGQuality
+	}
+	if err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: quality}); err != nil {
+		return nil, "", fmt.Errorf("encode jpeg: %w", err)
+	}
+	return buf.Bytes(), "image/jpeg", nil
+}
+
+func toRGBA(src image.Image) *image.RGBA {
+	if rgba, ok := src.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	b := src.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(dst, dst.Bounds(), src, b.Min, draw.Src)
+	return dst
+}
+
+// tileImage cuts img into overlapping crops in row-major order
+func tileImage(img *image.RGBA, t ImageTiling) []*image.RGBA {
+	xs := tileStarts(img.Rect.Dx(), t.TileSize, t.Overlap)
+	ys := tileStarts(img.Rect.Dy(), t.TileSize, t.Overlap)
+	tiles := make([]*image.RGBA, 0, len(xs)*len(ys))
+	for _, y := range ys {
+		for _, x := range xs {
+			r := image.Rect(x, y, min(x+t.TileSize, img.Rect.Dx()), min(y+t.TileSize, img.Rect.Dy()))
+			tiles = append(tiles, toRGBA(img.SubImage(r)))
+		}
+	}
+	return tiles
+}
+
+// tileStarts returns crop offsets along one axis; the last tile is aligned to the edge
+func tileStarts(length, size, overlap int) []int {
+	if length <= size {
+		return []int{0}
+	}
+	step := size - overlap
+	var starts []int
+	for s := 0; ; s += step {
+		if s+size >= length {
+			starts = append(starts, length-size)
+			return starts
+		}
+		starts = append(starts, s)
+	}
+}
+
+// resizeToFit scales img down so that its longest side is at most maxDim
+func resizeToFit(img *image.RGBA, maxDim int) *image.RGBA {
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	if maxDim <= 0 || max(w, h) <= maxDim {
+		return img
+	}
+	scale := float64(maxDim) / float64(max(w, h))
+	dw := max(1, int(math.Round(float64(w)*scale)))
+	dh := max(1, int(math.Round(float64(h)*scale)))
+	return resample(img, dw, dh)
+}
+
+// resample performs a separable triangle-filter resize whose support grows
+// with the downscale factor, which behaves like area averaging
+func resample(src *image.RGBA, dw, dh int) *image.RGBA {
+	sw, sh := src.Rect.Dx(), src.Rect.Dy()
+
+	// Horizontal pass: sw×sh → dw×sh
+	tmp := image.NewRGBA(image.Rect(0, 0, dw, sh))
+	xw := filterWeights(dw, sw)
+	for y := 0; y < sh; y++ {
+		srow := src.Pix[y*src.Stride:]
+		drow := tmp.Pix[y*tmp.Stride:]
+		for x, fw := range xw {
+			var acc [4]float32
+			for k, w := range fw.weights {
+				o := (fw.start + k) * 4
+				acc[0] += w * float32(srow[o])
+				acc[1] += w * float32(srow[o+1])
+				acc[2] += w * float32(srow[o+2])
+				acc[3] += w * float32(srow[o+3])
+			}
+			storePixel(drow[x*4:], acc)
+		}
+	}
+
+	// Vertical pass: dw×sh → dw×dh
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	yw := filterWeights(dh, sh)
+	for y, fw := range yw {
+		drow := dst.Pix[y*dst.Stride:]
+		for x := 0; x < dw; x++ {
+			var acc [4]float32
+			for k, w := range fw.weights {
+				o := (fw.start+k)*tmp.Stride + x*4
+				acc[0] += w * float32(tmp.Pix[o])
+				acc[1] += w * float32(tmp.Pix[o+1])
+				acc[2] += w * float32(tmp.Pix[o+2])
+				acc[3] += w * float32(tmp.Pix[o+3])
+			}
+			storePixel(drow[x*4:], acc)
+		}
+	}
+	return dst
+}
+
+type filterWeight struct {
+	start   int
+	weights []float32
+}
+
+func filterWeights(dstLen, srcLen int) []filterWeight {
+	scale := float64(srcLen) / float64(dstLen)
+	support := max(scale, 1)
+	out := make([]filterWeight, dstLen)
+	for i := range out {
+		center := (float64(i) + 0.5) * scale
+		start := max(0, int(math.Floor(center-support)))
+		end := min(srcLen, int(math.Ceil(center+support)))
+
+		var sum float64
+		ws := make([]float64, end-start)
+		for j := start; j < end; j++ {
+			w := 1 - math.Abs((float64(j)+0.5-center)/support)
+			if w > 0 {
+				ws[j-start] = w
+				sum += w
+			}
+		}
+		fw := filterWeight{start: start, weights: make([]float32, len(ws))}
+		for k, w := range ws {
+			if sum > 0 {
+				fw.weights[k] = float32(w / sum)
+			}
+		}
+		out[i] = fw
+	}
+	return out
+}
+
+func storePixel(dst []uint8, acc [4]float32) {
+	for c := 0; c < 4; c++ {
+		dst[c] = uint8(math.Round(float64(min(max(acc[c], 0), 255))))
+	}
+}
+
+// applyOrientation transforms img according to an EXIF orientation value (1-8)
+func applyOrientation(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch orientation {
+			case 2: // mirror horizontal
+				sx, sy = w-1-x, y
+			case 3: // rotate 180
+				sx, sy = w-1-x, h-1-y
+			case 4: // mirror vertical
+				sx, sy = x, h-1-y
+			case 5: // transpose
+				sx, sy = y, x
+			case 6: // rotate 90 CW
+				sx, sy = y, h-1-x
+			case 7: // transverse
+				sx, sy = w-1-y, h-1-x
+			case 8: // rotate 90 CCW
+				sx, sy = w-1-y, x
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], img.Pix[sy*img.Stride+sx*4:])
+		}
+	}
+	return dst
+}
+
+// exifOrientation returns the EXIF orientation tag of a JPEG, or 1 when absent
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // start of scan / end of image
+			return 1
+		}
+		size := int(binary.BigEndian.Uint16(data[i+2:]))
+		if size < 2 || i+2+size > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+size]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + size
+	}
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	// Compare before converting so offsets above MaxInt32 stay out of range
+	// on 32-bit platforms
+	offset := order.Uint32(tiff[4:])
+	if uint64(offset)+2 > uint64(len(tiff)) {
+		return 1
+	}
+	ifd := int(offset)
+	count := int(order.Uint16(tiff[ifd:]))
+	for e := 0; e < count; e++ {
+		off := ifd + 2 + e*12
+		if off+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[off:]) == 0x0112 {
+			if v := int(order.Uint16(tiff[off+8:])); v >= 1 && v <= 8 {
+				return v
+			}
+			return 1
+		}
+	}
+	return 1
+}
@@ -0,0 +1,192 @@
+package unstruct
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func encodeTestPNG(t *testing.T, w, h int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: 200, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
+
+// encodeTestJPEG returns a JPEG carrying an EXIF orientation tag
+func encodeTestJPEG(t *testing.T, w, h int, orientation uint16) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)), nil))
+	data := buf.Bytes()
+
+	// TIFF header + IFD0 with a single orientation entry (little endian)
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3) // SHORT
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	payload := append([]byte("Exif\x00\x00"), tiff...)
+	segment := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	segment = append(segment, payload...)
+
+	out := append([]byte{}, data[:2]...)
+	out = append(out, segment...)
+	return append(out, data[2:]...)
+}
+
+func decodeConfig(t *testing.T, p *Part) image.Config {
+	t.Helper()
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(p.Data))
+	require.NoError(t, err)
+	return cfg
+}
+
+func TestPreprocessImage_Resize(t *testing.T) {
+	data := encodeTestPNG(t, 400, 200)
+
+	parts, err := PreprocessImage(data, "image/png", ImagePreprocessing{MaxDimension: 100})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "image/png", parts[0].MimeType)
+
+	cfg := decodeConfig(t, parts[0])
+	assert.Equal(t, 100, cfg.Width)
+	assert.Equal(t, 50, cfg.Height)
+}
+
+func TestPreprocessImage_Untouched(t *testing.T) {
+	data := encodeTestPNG(t, 50, 50)
+
+	parts, err := PreprocessImage(data, "image/png", ImagePreprocessing{MaxDimension: 100})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, data, parts[0].Data)
+
+	pdf := []byte("%PDF-1.4")
+	parts, err = PreprocessImage(pdf, "application/pdf", ImagePreprocessing{Grayscale: true})
+	require.NoError(t, err)
+	assert.Equal(t, pdf, parts[0].Data)
+}
+
+func TestPreprocessImage_GrayscaleJPEG(t *testing.T) {
+	data := encodeTestPNG(t, 40, 40)
+
+	parts, err := PreprocessImage(data, "image/png", ImagePreprocessing{Grayscale: true, JPEGQuality: 60})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+	assert.Equal(t, "image/jpeg", parts[0].MimeType)
+	assert.Equal(t, color.GrayModel, decodeConfig(t, parts[0]).ColorModel)
+}
+
+func TestPreprocessImage_AutoOrient(t *testing.T) {
+	data := encodeTestJPEG(t, 80, 40, 6)
+	assert.Equal(t, 6, exifOrientation(data))
+
+	parts, err := PreprocessImage(data, "image/jpeg", ImagePreprocessing{AutoOrient: true})
+	require.NoError(t, err)
+	require.Len(t, parts, 1)
+
+	cfg := decodeConfig(t, parts[0])
+	assert.Equal(t, 40, cfg.Width)
+	assert.Equal(t, 80, cfg.Height)
+	assert.Equal(t, 1, exifOrientation(parts[0].Data))
+}
+
+func TestApplyOrientation(t *testing.T) {
+	// 2×1 image: red, blue
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.Set(0, 0, color.RGBA{R: 255, A: 255})
+	img.Set(1, 0, color.RGBA{B: 255, A: 255})
+
+	cw := applyOrientation(img, 6)
+	assert.Equal(t, image.Rect(0, 0, 1, 2), cw.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, cw.RGBAAt(0, 0))
+
+	ccw := applyOrientation(img, 8)
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, ccw.RGBAAt(0, 0))
+
+	mirrored := applyOrientation(img, 2)
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, mirrored.RGBAAt(0, 0))
+}
+
+func TestPreprocessImage_Tiling(t *testing.T) {
+	data := encodeTestPNG(t, 250, 100)
+
+	parts, err := PreprocessImage(data, "image/png", ImagePreprocessing{
+		Tiling: &ImageTiling{Threshold: 200, TileSize: 100, Overlap: 20},
+	})
+	require.NoError(t, err)
+	// x offsets 0, 80, 150; a single row
+	require.Len(t, parts, 3)
+	for _, p := range parts {
+		cfg := decodeConfig(t, p)
+		assert.Equal(t, 100, cfg.Width)
+		assert.Equal(t, 100, cfg.Height)
+	}
+}
+
+func TestPreprocessImage_MaxPixels(t *testing.T) {
+	data := encodeTestPNG(t, 200, 100)
+
+	_, err := PreprocessImage(data, "image/png", ImagePreprocessing{MaxDimension: 50, MaxPixels: 10000})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+
+	parts, err := PreprocessImage(data, "image/png", ImagePreprocessing{MaxDimension: 50, MaxPixels: 20000})
+	require.NoError(t, err)
+	assert.Equal(t, 50, decodeConfig(t, parts[0]).Width)
+
+	// The header alone is enough to reject an oversized image
+	header := append([]byte{}, data[:33]...) // signature and IHDR chunk
+	binary.BigEndian.PutUint32(header[16:], 100000)
+	binary.BigEndian.PutUint32(header[20:], 100000)
+	binary.BigEndian.PutUint32(header[29:], crc32.ChecksumIEEE(header[12:29]))
+	_, err = PreprocessImage(header, "image/png", ImagePreprocessing{Grayscale: true})
+	assert.ErrorIs(t, err, ErrImageTooLarge)
+}
+
+func TestTiffOrientation_OffsetOutOfRange(t *testing.T) {
+	tiff := []byte("II*\x00\xff\xff\xff\xff\x01\x00")
+	assert.Equal(t, 1, tiffOrientation(tiff))
+}
+
+func TestPreprocessImage_InvalidConfig(t *testing.T) {
+	_, err := PreprocessImage(nil, "image/png", ImagePreprocessing{JPEGQuality: 101})
+	assert.Error(t, err)
+
+	_, err = PreprocessImage(nil, "image/png", ImagePreprocessing{Tiling: &ImageTiling{TileSize: 10, Overlap: 10}})
+	assert.Error(t, err)
+}
+
+func TestDataAsset_Preprocess(t *testing.T) {
+	asset := NewDataAsset(encodeTestPNG(t, 300, 300), "image/png",
+		WithImagePreprocessing(ImagePreprocessing{MaxDimension: 150}))
+
+	messages, err := asset.CreateMessages(context.Background(), slog.Default())
+	require.NoError(t, err)
+	require.Len(t, messages, 1)
+	require.Len(t, messages[0].Parts, 1)
+	assert.Equal(t, "image", messages[0].Parts[0].Type)
+	assert.Equal(t, 150, decodeConfig(t, messages[0].Parts[0]).Width)
+}
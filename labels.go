@@ -0,0 +1,108 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+)
+
+// assetsParam is the tag query parameter that routes labelled assets to a prompt group,
+// e.g. unstruct:"prompt/invoice?assets=invoice,photo"
+const assetsParam = "assets"
+
+// estimatedMediaTokens approximates the input tokens of one image or file part
+const estimatedMediaTokens = 258
+
+// ErrNoAssetsSelected is returned when an asset selection matches none of the assets.
+var ErrNoAssetsSelected = errors.New("no assets match selection")
+
+// LabeledAsset attaches routing labels (roles) to an asset. Prompt groups that
+// select assets by label only receive the assets carrying one of those labels;
+// groups without a selection receive every asset.
+type LabeledAsset struct {
+	Asset
+	Labels []string
+}
+
+// NewLabeledAsset wraps asset with the given labels
+func NewLabeledAsset(asset Asset, labels ...string) *LabeledAsset {
+	return &LabeledAsset{Asset: asset, Labels: labels}
+}
+
+// Cleanup releases the wrapped asset's remote resources, if it holds any
+func (a *LabeledAsset) Cleanup(ctx context.Context) error {
+	if c, ok := a.Asset.(Cleaner); ok {
+		return c.Cleanup(ctx)
+	}
+	return nil
+}
+
+// assetLabels returns the labels of asset, or nil when it is not labelled
+func assetLabels(asset Asset) []string {
+	if la, ok := asset.(*LabeledAsset); ok {
+		return la.Labels
+	}
+	return nil
+}
+
+// assetSelection resolves the labels a prompt group asks for and returns the
+// parameters without the routing parameter. The tag's assets parameter takes
+// precedence over WithAssetsFor.
+func assetSelection(label string, parameters map[string]string, opts Options) ([]string, map[string]string) {
+	var selected []string
+	if raw, ok := parameters[assetsParam]; ok {
+		for _, l := range strings.Split(raw, ",") {
+			if l = strings.TrimSpace(l); l != "" {
+				selected = append(selected, l)
+			}
+		}
+		parameters = maps.Clone(parameters)
+		delete(parameters, assetsParam)
+	} else if labels, ok := opts.PromptAssets[label]; ok {
+		selected = labels
+	}
+	return selected, parameters
+}
+
+// selectAssets returns the part of the snapshot routed to a group selecting labels.
+// An empty selection keeps every asset. Assets that failed to prepare are never
+// selected.
+func (p *preparedAssets) selectAssets(labels []string, log *slog.Logger) (*preparedAssets, error) {
+	if len(labels) == 0 {
+		return p, nil
+	}
+	// Unselected assets keep their position with no messages so indices stay stable
+	selected := p.view(make([][]*Message, len(p.perAsset)))
+	var count int
+	for i, messages := range p.perAsset {
+		if p.hasFailed(i) || !slices.ContainsFunc(p.labels[i], func(l string) bool { return slices.Contains(labels, l) }) {
+			continue
+		}
+		selected.perAsset[i] = messages
+		count++
+	}
+	log.Debug("Selected assets", "labels", labels, "selected", count, "total", len(p.perAsset))
+	if count == 0 {
+		return nil, fmt.Errorf("%w %v", ErrNoAssetsSelected, labels)
+	}
+	return selected, nil
+}
+
+// estimateTokens approximates the input tokens the snapshot adds to a prompt
+func (p *preparedAssets) estimateTokens() int {
+	var tokens int
+	for _, msg := range p.messages() {
+		for _, part := range msg.Parts {
+			if part.Type == "text" {
+				tokens += EstimateTokensFromText(part.Text)
+			} else {
+				tokens += estimatedMediaTokens
+			}
+		}
+	}
+	return tokens
+}
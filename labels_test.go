@@ -0,0 +1,106 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// mediaRecorder records the media MIME types each prompt receives
+type mediaRecorder struct {
+	mu    sync.Mutex
+	media map[string][]string // prompt → MIME types
+}
+
+func (r *mediaRecorder) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.media == nil {
+		r.media = make(map[string][]string)
+	}
+	for _, p := range media {
+		r.media[prompt] = append(r.media[prompt], p.MimeType)
+	}
+	return []byte(`{}`), nil
+}
+
+type routedDoc struct {
+	Total  string `json:"total" unstruct:"prompt/basic?assets=invoice"`
+	Status string `json:"status" unstruct:"coords"`
+}
+
+func routedAssets() []Asset {
+	return []Asset{
+		NewLabeledAsset(NewDataAsset([]byte{1}, "image/png"), "invoice", "photo"),
+		NewLabeledAsset(NewDataAsset([]byte{2}, "image/jpeg"), "contract"),
+		NewDataAsset([]byte{3}, "image/gif"),
+	}
+}
+
+func TestUnstruct_AssetSelection(t *testing.T) {
+	rec := &mediaRecorder{}
+	ext := &Unstructor[routedDoc]{invoker: rec, prompts: mockPrompts{}, log: slog.Default()}
+
+	_, err := ext.Unstruct(context.Background(), routedAssets(), WithModel("test-model"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"image/png"}, rec.media["Extract total from the text as JSON."])
+	assert.Equal(t, []string{"image/png", "image/jpeg", "image/gif"}, rec.media["Find status coordinates in the text as JSON."])
+
+	t.Run("option", func(t *testing.T) {
+		rec := &mediaRecorder{}
+		ext := &Unstructor[routedDoc]{invoker: rec, prompts: mockPrompts{}, log: slog.Default()}
+		_, err := ext.Unstruct(context.Background(), routedAssets(), WithModel("test-model"), WithAssetsFor("coords", "contract"))
+		require.NoError(t, err)
+		assert.Equal(t, []string{"image/jpeg"}, rec.media["Find status coordinates in the text as JSON."])
+	})
+
+	t.Run("no match", func(t *testing.T) {
+		_, err := ext.Unstruct(context.Background(), routedAssets(), WithModel("test-model"), WithAssetsFor("coords", "receipt"))
+		assert.ErrorIs(t, err, ErrNoAssetsSelected)
+	})
+}
+
+func TestDryRun_AssetSelectionReducesTokens(t *testing.T) {
+	ext := newTestingUnstructor[routedDoc](mockPrompts{})
+
+	stats, err := ext.DryRun(context.Background(), routedAssets(), WithModel("test-model"))
+	require.NoError(t, err)
+
+	tokens := map[string]int{}
+	for _, g := range stats.GroupDetails {
+		tokens[g.PromptName] = g.InputTokens
+	}
+	assert.Equal(t, EstimateTokensFromText("Extract total from the text as JSON.")+estimatedMediaTokens, tokens["basic"])
+	assert.Equal(t, EstimateTokensFromText("Find status coordinates in the text as JSON.")+3*estimatedMediaTokens, tokens["coords"])
+}
+
+func TestDryRun_AssetSelectionSkipsFailedAssets(t *testing.T) {
+	ext := newTestingUnstructor[routedDoc](mockPrompts{})
+	assets := []Asset{
+		NewLabeledAsset(&countingAsset{err: errors.New("unreadable")}, "invoice"),
+		NewLabeledAsset(NewDataAsset([]byte{2}, "image/jpeg"), "contract"),
+	}
+
+	_, err := ext.DryRun(context.Background(), assets, WithModel("test-model"))
+	assert.ErrorIs(t, err, ErrNoAssetsSelected, "a failed asset is not a selected one")
+
+	prepared, _ := prepareAssets(context.Background(), assets, slog.Default())
+	selected, err := prepared.selectAssets([]string{"invoice", "contract"}, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, estimatedMediaTokens, selected.estimateTokens())
+}
+
+func TestAssetSelection(t *testing.T) {
+	labels, params := assetSelection("invoice", map[string]string{"assets": "invoice, photo", "temperature": "0.1"}, Options{})
+	assert.Equal(t, []string{"invoice", "photo"}, labels)
+	assert.Equal(t, map[string]string{"temperature": "0.1"}, params)
+
+	labels, _ = assetSelection("invoice", nil, Options{PromptAssets: map[string][]string{"invoice": {"scan"}}})
+	assert.Equal(t, []string{"scan"}, labels)
+}
@@ -311,12 +311,16 @@ type ExecutionStats struct {
 
 // GroupExecution represents statistics for a single prompt group execution.
 type GroupExecution struct {
-	PromptName   string   `json:"promptName"`   // Name/key of the prompt
-	Model        string   `json:"model"`        // Model used for this group
-	Fields       []string `json:"fields"`       // Fields processed by this group
-	InputTokens  int      `json:"inputTokens"`  // Estimated input tokens
-	OutputTokens int      `json:"outputTokens"` // Estimated output tokens
-	ParentPath   string   `json:"parentPath"`   // Parent path for nested structures
+	PromptName   string        `json:"promptName"`           // Name/key of the prompt
+	Version      int           `json:"version"`              // Template version the prompt resolves to
+	Variant      string        `json:"variant,omitempty"`    // Experiment variant the document is assigned to
+	Model        string        `json:"model"`                // Model used for this group
+	Fields       []string      `json:"fields"`               // Fields processed by this group
+	FieldHints   []PromptField `json:"fieldHints,omitempty"` // Descriptions and expected values of hinted fields
+	InputTokens  int           `json:"inputTokens"`          // Estimated input tokens
+	OutputTokens int           `json:"outputTokens"`         // Estimated output tokens
+	ParentPath   string        `json:"parentPath"`           // Parent path for nested structures
+	Chunks       int           `json:"chunks"`               // Prompt calls for this group (one per document chunk)
 }
 
 // PlanNodeType defines the type of operation a node represents.
@@ -335,8 +339,10 @@ const (
 type PlanNode struct {
 	Type         PlanNodeType           `json:"type"`                   // e.g. "SchemaAnalysis", "PromptCall", ...
 	PromptName   string                 `json:"promptName,omitempty"`   // Name/identifier of the prompt (if applicable)
+	Version      int                    `json:"version,omitempty"`      // Template version of the prompt (if applicable)
 	Model        string                 `json:"model,omitempty"`        // LLM model used (if applicable)
 	Fields       []string               `json:"fields,omitempty"`       // Fields covered/extracted at this node
+	FieldHints   []PromptField          `json:"fieldHints,omitempty"`   // Descriptions and expected values of hinted fields
 	InputTokens  int                    `json:"inputTokens,omitempty"`  // Estimated input size in tokens for this node
 	OutputTokens int                    `json:"outputTokens,omitempty"` // Estimated output size in tokens for this node
 	EstCost      float64                `json:"estCost"`                // Estimated *abstract* cost units for this node (includes children)
@@ -508,8 +514,10 @@ func (pb *PlanBuilder) buildPlanFromDryRun(options ExplainOptions) (*PlanNode, e
 		promptNode := &PlanNode{
 			Type:         PromptCallType,
 			PromptName:   groupExec.PromptName,
+			Version:      groupExec.Version,
 			Model:        groupExec.Model,
 			Fields:       groupExec.Fields,
+			FieldHints:   groupExec.FieldHints,
 			InputTokens:  groupExec.InputTokens,
 			OutputTokens: groupExec.OutputTokens,
 			Children:     make([]*PlanNode, 0),
@@ -41,6 +41,11 @@ func (pb *PlanBuilder) formatNodeAsText(node *PlanNode, prefix string, isLast bo
 		}
 	}
 
+	// Field hints are listed under the node, before its children
+	for _, f := range node.FieldHints {
+		fmt.Fprintf(sb, "%s· %s\n", childPrefix, formatFieldHint(f))
+	}
+
 	for i, child := range node.Children {
 		isLastChild := i == len(node.Children)-1
 		pb.formatNodeAsText(child, childPrefix, isLastChild, sb)
@@ -57,6 +62,10 @@ func (pb *PlanBuilder) formatNodeInfo(node *PlanNode) string {
 
 	var details []string
 
+	if node.Version > 0 {
+		details = append(details, fmt.Sprintf("version=%d", node.Version))
+	}
+
 	if node.Model != "" {
 		details = append(details, fmt.Sprintf("model=%s", node.Model))
 	}
@@ -90,3 +99,30 @@ func (pb *PlanBuilder) formatNodeInfo(node *PlanNode) string {
 
 	return strings.Join(parts, " ")
 }
+
+// formatFieldHint describes a hinted field on one line, e.g.
+// total: Grand total (unit=EUR, format=0.00)
+func formatFieldHint(f PromptField) string {
+	line := f.Key
+	if f.Description != "" {
+		line += ": " + f.Description
+	}
+
+	var details []string
+	if f.Format != "" {
+		details = append(details, "format="+f.Format)
+	}
+	if f.Unit != "" {
+		details = append(details, "unit="+f.Unit)
+	}
+	if len(f.Enum) > 0 {
+		details = append(details, "enum="+strings.Join(f.Enum, "|"))
+	}
+	if f.Example != "" {
+		details = append(details, "example="+f.Example)
+	}
+	if len(details) > 0 {
+		line += fmt.Sprintf(" (%s)", strings.Join(details, ", "))
+	}
+	return line
+}
@@ -0,0 +1,105 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+)
+
+// AssetError reports an asset that could not be turned into messages
+type AssetError struct {
+	Index int   // position of the asset in the call's asset list
+	Asset Asset // the failing asset
+	Err   error
+}
+
+func (e *AssetError) Error() string {
+	return fmt.Sprintf("asset %d (%T): %v", e.Index, e.Asset, e.Err)
+}
+
+func (e *AssetError) Unwrap() error { return e.Err }
+
+// preparedAssets is the snapshot of messages produced from a call's assets.
+// It is built once per Unstruct call and shared read-only by every prompt group.
+type preparedAssets struct {
+	perAsset [][]*Message // messages per asset, in input order; nil for failed assets
+	labels   [][]string   // routing labels per asset
+	names    []string     // display names per asset; "" when unknown
+	failed   []bool       // true for assets whose preparation failed
+}
+
+// view returns a snapshot with other messages for the same assets
+func (p *preparedAssets) view(perAsset [][]*Message) *preparedAssets {
+	return &preparedAssets{perAsset: perAsset, labels: p.labels, names: p.names, failed: p.failed}
+}
+
+// hasFailed reports whether asset i could not be prepared
+func (p *preparedAssets) hasFailed(i int) bool {
+	return i < len(p.failed) && p.failed[i]
+}
+
+// prepareAssets materialises every asset concurrently, exactly once. Failures are
+// collected as *AssetError values and joined; the snapshot still holds the messages
+// of the assets that succeeded so lenient callers such as DryRun can continue.
+func prepareAssets(ctx context.Context, assets []Asset, log *slog.Logger) (*preparedAssets, error) {
+	prepared := &preparedAssets{
+		perAsset: make([][]*Message, len(assets)),
+		labels:   make([][]string, len(assets)),
+		names:    make([]string, len(assets)),
+		failed:   make([]bool, len(assets)),
+	}
+	errs := make([]error, len(assets))
+
+	var wg sync.WaitGroup
+	for i, asset := range assets {
+		prepared.labels[i] = assetLabels(asset)
+		prepared.names[i] = assetDisplayName(asset)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			messages, err := asset.CreateMessages(ctx, log)
+			if err != nil {
+				errs[i] = &AssetError{Index: i, Asset: asset, Err: err}
+				prepared.failed[i] = true
+				return
+			}
+			prepared.perAsset[i] = cloneMessages(messages)
+		}()
+	}
+	wg.Wait()
+
+	err := errors.Join(errs...)
+	log.Debug("Prepared assets", "assets", len(assets), "messages", len(prepared.messages()), "error", err)
+	return prepared, err
+}
+
+// messages returns all prepared messages in asset order
+func (p *preparedAssets) messages() []*Message {
+	var all []*Message
+	for _, messages := range p.perAsset {
+		all = append(all, messages...)
+	}
+	return all
+}
+
+// cloneMessages copies messages and parts so assets cannot change the snapshot afterwards
+func cloneMessages(messages []*Message) []*Message {
+	out := make([]*Message, 0, len(messages))
+	for _, msg := range messages {
+		if msg == nil {
+			continue
+		}
+		parts := make([]*Part, 0, len(msg.Parts))
+		for _, part := range msg.Parts {
+			if part == nil {
+				continue
+			}
+			p := *part
+			parts = append(parts, &p)
+		}
+		out = append(out, &Message{Role: msg.Role, Parts: parts})
+	}
+	return out
+}
@@ -0,0 +1,87 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// countingAsset records how often it is materialised
+type countingAsset struct {
+	calls atomic.Int32
+	text  string
+	err   error
+}
+
+func (a *countingAsset) CreateMessages(ctx context.Context, log *slog.Logger) ([]*Message, error) {
+	a.calls.Add(1)
+	if a.err != nil {
+		return nil, a.err
+	}
+	return []*Message{NewUserMessage(NewTextPart(a.text))}, nil
+}
+
+func TestPrepareAssets(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("keeps asset order", func(t *testing.T) {
+		prepared, err := prepareAssets(ctx, []Asset{
+			&countingAsset{text: "first"},
+			&countingAsset{text: "second"},
+		}, slog.Default())
+		require.NoError(t, err)
+
+		messages := prepared.messages()
+		require.Len(t, messages, 2)
+		assert.Equal(t, "first", messages[0].Parts[0].Text)
+		assert.Equal(t, "second", messages[1].Parts[0].Text)
+		assert.Equal(t, "--- asset 0: text/plain ---\nfirst\n\n--- asset 1: text/plain ---\nsecond", prepared.promptContext(nil).Document)
+	})
+
+	t.Run("aggregates errors", func(t *testing.T) {
+		errA, errB := errors.New("a broke"), errors.New("b broke")
+		prepared, err := prepareAssets(ctx, []Asset{
+			&countingAsset{err: errA},
+			&countingAsset{text: "ok"},
+			&countingAsset{err: errB},
+		}, slog.Default())
+
+		assert.ErrorIs(t, err, errA)
+		assert.ErrorIs(t, err, errB)
+		var assetErr *AssetError
+		require.ErrorAs(t, err, &assetErr)
+		assert.Equal(t, 0, assetErr.Index)
+		assert.Equal(t, "ok", prepared.promptContext(nil).Document)
+	})
+
+	t.Run("snapshot is detached from the asset", func(t *testing.T) {
+		media := NewImagePart([]byte{1}, "image/png")
+		asset := &MultiModalAsset{Text: "caption", Media: []*Part{media}}
+		prepared, err := prepareAssets(ctx, []Asset{asset}, slog.Default())
+		require.NoError(t, err)
+
+		media.MimeType = "image/jpeg"
+		assert.Equal(t, "image/png", prepared.messages()[0].Parts[1].MimeType)
+	})
+}
+
+func TestUnstruct_MaterialisesAssetsOnce(t *testing.T) {
+	ext := newTestingUnstructor[TestProject](mockPrompts{})
+	asset := &countingAsset{text: "Project Alpha with code ABC-123"}
+
+	_, err := ext.Unstruct(context.Background(), []Asset{asset}, WithModel("test-model"))
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), asset.calls.Load())
+
+	failing := &countingAsset{err: errors.New("unreachable")}
+	_, err = ext.Unstruct(context.Background(), []Asset{asset, failing}, WithModel("test-model"))
+	var assetErr *AssetError
+	require.ErrorAs(t, err, &assetErr)
+	assert.Equal(t, 1, assetErr.Index)
+	assert.Equal(t, int32(1), failing.calls.Load())
+}
@@ -0,0 +1,111 @@
+package unstruct
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// PromptAsset describes one asset to prompt templates
+type PromptAsset struct {
+	Index       int      // position in the call's asset list
+	Text        string   // all text parts of the asset, joined by blank lines
+	MimeType    string   // "text/plain" for text, otherwise the first media part's type
+	DisplayName string   // file name or URL when known
+	Labels      []string // routing labels from NewLabeledAsset
+}
+
+// PromptContext is everything a template can use to render a prompt group.
+// Keys are the dotted JSON keys as the schema names them, so the amounts of a
+// slice at items and of a map at prices read items.amount and prices.amount.
+// Replies must nest them as arrays and keyed objects; templates that describe
+// the reply shape should use Fields, whose keys read items[].amount and
+// prices.<key>.amount.
+type PromptContext struct {
+	Keys     []string
+	Fields   []PromptField // one entry per key, in order, with its type and hints
+	Document string        // text of all assets in order, separated by asset headers when there are several
+	Assets   []PromptAsset // assets routed to the group, in order
+	Examples string        // formatted few-shot examples when ExamplesAsVariable is used
+}
+
+// assetDisplayName returns a human-readable name for assets that have one
+func assetDisplayName(asset Asset) string {
+	switch a := asset.(type) {
+	case *LabeledAsset:
+		return assetDisplayName(a.Asset)
+	case *FileAsset:
+		if a.DisplayName != "" {
+			return a.DisplayName
+		}
+		return filepath.Base(a.Path)
+	case *URLAsset:
+		return a.URL
+	}
+	return ""
+}
+
+// promptAssets describes the assets of the snapshot that carry any content
+func (p *preparedAssets) promptAssets() []PromptAsset {
+	var out []PromptAsset
+	for i, messages := range p.perAsset {
+		if len(messages) == 0 {
+			continue
+		}
+		pa := PromptAsset{Index: i, DisplayName: p.names[i], Labels: p.labels[i]}
+		var texts []string
+		for _, msg := range messages {
+			for _, part := range msg.Parts {
+				switch {
+				case part.Type == "text":
+					if part.Text != "" {
+						texts = append(texts, part.Text)
+					}
+				case pa.MimeType == "":
+					pa.MimeType = part.MimeType
+				}
+			}
+		}
+		pa.Text = strings.Join(texts, "\n\n")
+		if pa.MimeType == "" {
+			pa.MimeType = "text/plain"
+		}
+		out = append(out, pa)
+	}
+	return out
+}
+
+// promptContext builds the template context for keys over the snapshot
+func (p *preparedAssets) promptContext(keys []string) PromptContext {
+	assets := p.promptAssets()
+	return PromptContext{Keys: keys, Document: joinDocuments(assets), Assets: assets}
+}
+
+// joinDocuments concatenates asset texts. A single text is returned as is; several
+// are each preceded by a header naming the asset so templates can tell them apart.
+func joinDocuments(assets []PromptAsset) string {
+	var withText []PromptAsset
+	for _, a := range assets {
+		if a.Text != "" {
+			withText = append(withText, a)
+		}
+	}
+	if len(withText) == 1 {
+		return withText[0].Text
+	}
+
+	var b strings.Builder
+	for i, a := range withText {
+		if i > 0 {
+			b.WriteString("\n\n")
+		}
+		name := a.DisplayName
+		if name == "" {
+			name = a.MimeType
+		} else {
+			name = fmt.Sprintf("%s (%s)", name, a.MimeType)
+		}
+		fmt.Fprintf(&b, "--- asset %d: %s ---\n%s", a.Index, name, a.Text)
+	}
+	return b.String()
+}
@@ -0,0 +1,57 @@
+package unstruct
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPreparedAssets_PromptContext(t *testing.T) {
+	prepared, err := prepareAssets(context.Background(), []Asset{
+		NewLabeledAsset(NewTextAsset("invoice text"), "invoice"),
+		NewDataAsset([]byte{1}, "image/png"),
+		NewTextAsset("terms text"),
+	}, slog.Default())
+	require.NoError(t, err)
+	prepared.names[2] = "terms.txt"
+
+	pc := prepared.promptContext([]string{"total"})
+	require.Len(t, pc.Assets, 3)
+	assert.Equal(t, PromptAsset{Index: 0, Text: "invoice text", MimeType: "text/plain", Labels: []string{"invoice"}}, pc.Assets[0])
+	assert.Equal(t, "image/png", pc.Assets[1].MimeType)
+	assert.Empty(t, pc.Assets[1].Text)
+	assert.Equal(t, "terms.txt", pc.Assets[2].DisplayName)
+
+	assert.Contains(t, pc.Document, "--- asset 0: text/plain ---\ninvoice text")
+	assert.Contains(t, pc.Document, "--- asset 2: terms.txt (text/plain) ---\nterms text")
+	assert.NotContains(t, pc.Document, "asset 1")
+}
+
+func TestAssetDisplayName(t *testing.T) {
+	assert.Equal(t, "scan.pdf", assetDisplayName(NewLabeledAsset(&FileAsset{Path: "/tmp/scan.pdf"}, "invoice")))
+	assert.Equal(t, "Scan", assetDisplayName(&FileAsset{Path: "/tmp/scan.pdf", DisplayName: "Scan"}))
+	assert.Equal(t, "https://example.com", assetDisplayName(&URLAsset{URL: "https://example.com"}))
+	assert.Empty(t, assetDisplayName(NewTextAsset("x")))
+}
+
+func TestJoinDocuments_SingleTextUnchanged(t *testing.T) {
+	assert.Equal(t, "only", joinDocuments([]PromptAsset{{Text: "only"}, {MimeType: "image/png"}}))
+	assert.Empty(t, joinDocuments(nil))
+}
+
+func TestUnstruct_ContextualTemplateSeesAllTextAssets(t *testing.T) {
+	type doc struct {
+		Total string `json:"total" unstruct:"invoice"`
+	}
+	inv := &chunkInvoker{}
+	ext := &Unstructor[doc]{invoker: inv, prompts: chunkPrompts{}, log: slog.Default()}
+
+	_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("first"), NewTextAsset("second")}, WithModel("test-model"))
+	require.NoError(t, err)
+	require.Len(t, inv.prompts, 1)
+	assert.Contains(t, inv.prompts[0], "first")
+	assert.Contains(t, inv.prompts[0], "second")
+}
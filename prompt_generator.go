@@ -0,0 +1,252 @@
+package unstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math/big"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Unstruct tag parameters that describe a field; they never reach the model config
+const (
+	descriptionParam = "description"
+	formatParam      = "format"
+	unitParam        = "unit"
+	enumParam        = "enum"
+	exampleParam     = "example"
+)
+
+// FieldHint describes a field to prompts: what it means and which values are
+// expected. Hints come from the desc, format, unit, enum and example struct tags,
+// the matching unstruct parameters, or WithFieldHints.
+type FieldHint struct {
+	Description string   `json:"description,omitempty"`
+	Format      string   `json:"format,omitempty"` // expected format, e.g. "YYYY-MM-DD"
+	Unit        string   `json:"unit,omitempty"`   // unit of measure, e.g. "EUR" or "kg"
+	Enum        []string `json:"enum,omitempty"`   // allowed values
+	Example     string   `json:"example,omitempty"`
+}
+
+// IsZero reports whether the hint says nothing about the field
+func (h FieldHint) IsZero() bool {
+	return h.Description == "" && h.Format == "" && h.Unit == "" && len(h.Enum) == 0 && h.Example == ""
+}
+
+// merge returns h with the non-empty attributes of o applied over it
+func (h FieldHint) merge(o FieldHint) FieldHint {
+	if o.Description != "" {
+		h.Description = o.Description
+	}
+	if o.Format != "" {
+		h.Format = o.Format
+	}
+	if o.Unit != "" {
+		h.Unit = o.Unit
+	}
+	if len(o.Enum) > 0 {
+		h.Enum = o.Enum
+	}
+	if o.Example != "" {
+		h.Example = o.Example
+	}
+	return h
+}
+
+// PromptField describes one requested key to templates
+type PromptField struct {
+	Key  string `json:"key"`  // dotted JSON path with [] after arrays and <key> for map entries, e.g. "items[].sku"
+	Type string `json:"type"` // JSON type as described to the model, e.g. "integer" or "array of string"
+	FieldHint
+}
+
+// promptFields describes keys in order from their schema metadata
+func promptFields(keys []string, fields map[string]fieldSpec) []PromptField {
+	out := make([]PromptField, 0, len(keys))
+	for _, key := range keys {
+		spec := fields[key]
+		out = append(out, PromptField{Key: describeKey(key, fields), Type: describeType(spec.typ), FieldHint: spec.hints})
+	}
+	return out
+}
+
+// mapKeyPlaceholder stands for the keys of a map in described field keys
+const mapKeyPlaceholder = "<key>"
+
+// describeKey spells out the arrays and map entries on the path of key, so that
+// the sku of every element of a slice of structs at items reads items[].sku and
+// the amount of every entry of a map of structs at prices reads prices.<key>.amount
+func describeKey(key string, fields map[string]fieldSpec) string {
+	parts := strings.Split(key, ".")
+	out := make([]string, 0, len(parts))
+	for i, part := range parts {
+		out = append(out, part)
+		if i == len(parts)-1 {
+			break
+		}
+		spec, ok := fields[strings.Join(parts[:i+1], ".")]
+		if !ok {
+			continue
+		}
+	containers:
+		for t := derefType(spec.typ); ; t = derefType(t.Elem()) {
+			switch t.Kind() {
+			case reflect.Slice, reflect.Array:
+				out[len(out)-1] += "[]"
+			case reflect.Map:
+				out = append(out, mapKeyPlaceholder)
+			default:
+				break containers
+			}
+		}
+	}
+	return strings.Join(out, ".")
+}
+
+// hintedFields returns the fields of keys that carry any hint
+func hintedFields(keys []string, fields map[string]fieldSpec) []PromptField {
+	var out []PromptField
+	for _, f := range promptFields(keys, fields) {
+		if !f.IsZero() {
+			out = append(out, f)
+		}
+	}
+	return out
+}
+
+// parseFieldHints reads the desc, format, unit, enum and example struct tags and
+// the matching unstruct parameters, which take precedence. It returns the
+// parameters without the hints so that they do not split prompt groups.
+func parseFieldHints(tag reflect.StructTag, parameters map[string]string) (FieldHint, map[string]string) {
+	hints := FieldHint{
+		Description: tag.Get("desc"),
+		Format:      tag.Get("format"),
+		Unit:        tag.Get("unit"),
+		Example:     tag.Get("example"),
+	}
+	enum := tag.Get("enum")
+
+	cloned := false
+	for _, key := range []string{descriptionParam, formatParam, unitParam, enumParam, exampleParam} {
+		v, ok := parameters[key]
+		if !ok {
+			continue
+		}
+		if !cloned {
+			parameters = maps.Clone(parameters)
+			cloned = true
+		}
+		delete(parameters, key)
+		switch key {
+		case descriptionParam:
+			hints.Description = v
+		case formatParam:
+			hints.Format = v
+		case unitParam:
+			hints.Unit = v
+		case enumParam:
+			enum = v
+		case exampleParam:
+			hints.Example = v
+		}
+	}
+
+	hints.Enum = splitEnum(enum)
+	return hints, parameters
+}
+
+// splitEnum splits a comma-separated list of allowed values
+func splitEnum(enum string) []string {
+	var out []string
+	for _, v := range strings.Split(enum, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// describeType names a Go type the way the model sees it in JSON
+func describeType(t reflect.Type) string {
+	if t == nil {
+		return "any"
+	}
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t {
+	case reflect.TypeOf(time.Time{}):
+		return "date-time string (RFC 3339)"
+	case reflect.TypeOf(json.RawMessage(nil)):
+		return "any JSON value"
+	case reflect.TypeOf(big.Int{}):
+		return "integer"
+	case reflect.TypeOf(big.Rat{}), reflect.TypeOf(big.Float{}):
+		return "decimal number as a string"
+	}
+	if isLeafType(t) {
+		// Other types that decode themselves; text ones only accept JSON strings
+		if reflect.PointerTo(t).Implements(jsonUnmarshalerType) {
+			return "any"
+		}
+		return "string"
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array of " + describeType(t.Elem())
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return "any"
+}
+
+// generatePrompt builds an extraction prompt for keys from their types and hints.
+// It is used for groups without a prompt label when no fallback prompt is set.
+func generatePrompt(keys []string, fields map[string]fieldSpec) string {
+	var b strings.Builder
+	b.WriteString("Extract the following fields from the document and return a single JSON object with exactly these keys. ")
+	b.WriteString("Dotted keys are nested objects, so \"a.b\" is returned as {\"a\": {\"b\": ...}}. ")
+	described := promptFields(keys, fields)
+	if slices.ContainsFunc(described, func(f PromptField) bool { return strings.Contains(f.Key, "[]") }) {
+		b.WriteString("A segment followed by [] is an array of objects with one element per item found in the document, ")
+		b.WriteString("so \"a[].b\" is returned as {\"a\": [{\"b\": ...}, {\"b\": ...}]}. ")
+	}
+	if slices.ContainsFunc(described, func(f PromptField) bool { return strings.Contains(f.Key, mapKeyPlaceholder) }) {
+		b.WriteString("A <key> segment is an object with one entry per item found in the document, keyed by its name, ")
+		b.WriteString("so \"a.<key>.b\" is returned as {\"a\": {\"first\": {\"b\": ...}, \"second\": {\"b\": ...}}}. ")
+	}
+	b.WriteString("Use null for values that do not appear in the document; do not guess.\n\nFields:\n")
+
+	for _, f := range described {
+		fmt.Fprintf(&b, "- %s (%s)", f.Key, f.Type)
+		if f.Description != "" {
+			fmt.Fprintf(&b, ": %s", f.Description)
+		}
+		if f.Format != "" {
+			fmt.Fprintf(&b, ". Format: %s", f.Format)
+		}
+		if f.Unit != "" {
+			fmt.Fprintf(&b, ". Unit: %s", f.Unit)
+		}
+		if len(f.Enum) > 0 {
+			fmt.Fprintf(&b, ". One of: %s", strings.Join(f.Enum, ", "))
+		}
+		if f.Example != "" {
+			fmt.Fprintf(&b, ". Example: %s", f.Example)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,272 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type generatedInvoice struct {
+	Number string    `json:"number" desc:"Invoice number as printed" example:"INV-001"`
+	Total  float64   `json:"total" desc:"Grand total" unit:"EUR" unstruct:"?format=0.00"`
+	Status string    `json:"status" enum:"paid, open" unstruct:"?description=Payment status&enum=paid,open,overdue"`
+	Issued time.Time `json:"issued"`
+	Lines  []struct {
+		Amount float64 `json:"amount" unstruct:"?example=12.5&temperature=0.1"`
+	} `json:"lines"`
+	Tags []string `json:"tags"`
+}
+
+func TestParseFieldHints(t *testing.T) {
+	tag := reflect.StructTag(`desc:"From tag" enum:"a, b" example:"x" unit:"kg"`)
+
+	hints, params := parseFieldHints(tag, map[string]string{"temperature": "0.2"})
+	assert.Equal(t, FieldHint{Description: "From tag", Unit: "kg", Enum: []string{"a", "b"}, Example: "x"}, hints)
+	assert.Equal(t, map[string]string{"temperature": "0.2"}, params)
+
+	in := map[string]string{"description": "From param", "enum": "c,d", "format": "0.0", "temperature": "0.2"}
+	hints, params = parseFieldHints(tag, in)
+	assert.Equal(t, FieldHint{Description: "From param", Format: "0.0", Unit: "kg", Enum: []string{"c", "d"}, Example: "x"}, hints)
+	assert.Equal(t, map[string]string{"temperature": "0.2"}, params)
+	assert.Len(t, in, 4, "the tag's parameters are not modified")
+}
+
+func TestDescribeType(t *testing.T) {
+	var p *int
+	for _, tc := range []struct {
+		v    any
+		want string
+	}{
+		{"", "string"},
+		{1, "integer"},
+		{1.5, "number"},
+		{true, "boolean"},
+		{p, "integer"},
+		{[]string{}, "array of string"},
+		{time.Time{}, "date-time string (RFC 3339)"},
+		{map[string]int{}, "object"},
+		{struct{ A int }{1}, "object"},
+		{&time.Time{}, "date-time string (RFC 3339)"},
+		{json.RawMessage(nil), "any JSON value"},
+		{big.NewRat(1, 3), "decimal number as a string"},
+		{net.IP{}, "string"},
+	} {
+		assert.Equal(t, tc.want, describeType(reflect.TypeOf(tc.v)))
+	}
+}
+
+func TestGeneratePrompt(t *testing.T) {
+	sch, err := schemaOf[generatedInvoice]()
+	require.NoError(t, err)
+	require.Len(t, sch.group2keys, 2, "hint parameters do not split groups")
+
+	prompt := generatePrompt([]string{"number", "total", "status", "issued", "tags", "lines.amount"}, sch.json2field)
+	assert.Contains(t, prompt, "- number (string): Invoice number as printed. Example: INV-001\n")
+	assert.Contains(t, prompt, "- total (number): Grand total. Format: 0.00. Unit: EUR\n")
+	assert.Contains(t, prompt, "- status (string): Payment status. One of: paid, open, overdue\n")
+	assert.Contains(t, prompt, "- issued (date-time string (RFC 3339))\n")
+	assert.Contains(t, prompt, "- tags (array of string)\n")
+	assert.Contains(t, prompt, "- lines[].amount (number). Example: 12.5\n")
+	assert.Equal(t, map[string]string{"temperature": "0.1"}, sch.json2field["lines.amount"].parameters)
+}
+
+// fieldsInvoker answers generated prompts with the vendor and other prompts with
+// the total, recording every prompt
+type fieldsInvoker struct {
+	mu      sync.Mutex
+	prompts []string
+}
+
+func (f *fieldsInvoker) Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.prompts = append(f.prompts, prompt)
+	if strings.Contains(prompt, "Fields:") {
+		return []byte(`{"vendor": "Acme"}`), nil
+	}
+	return []byte(`{"total": "9"}`), nil
+}
+
+func TestWithFieldHints(t *testing.T) {
+	opts := Options{}
+	WithFieldHints(map[string]FieldHint{"total": {Description: "Amount due"}})(&opts)
+	WithFieldHints(map[string]FieldHint{"total": {Format: "0.0"}})(&opts)
+
+	sch, err := schemaOfWithOptions[generatedInvoice](&opts, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, FieldHint{Description: "Amount due", Format: "0.0", Unit: "EUR"}, sch.json2field["total"].hints)
+
+	fields := promptFields([]string{"total", "tags"}, sch.json2field)
+	assert.Equal(t, []PromptField{
+		{Key: "total", Type: "number", FieldHint: FieldHint{Description: "Amount due", Format: "0.0", Unit: "EUR"}},
+		{Key: "tags", Type: "array of string"},
+	}, fields)
+	assert.Len(t, hintedFields([]string{"total", "tags"}, sch.json2field), 1)
+}
+
+func TestUnstruct_FieldsInPromptContext(t *testing.T) {
+	type doc struct {
+		Total float64 `json:"total" desc:"Grand total" unit:"EUR" unstruct:"invoice"`
+		Date  string  `json:"date" unstruct:"invoice"`
+	}
+	stick, err := NewStickPromptProvider(WithTemplates(map[string]string{
+		"invoice": "{% for f in fields %}{{ f.key }}:{{ f.type }}:{{ f.unit }};{% endfor %}",
+	}))
+	require.NoError(t, err)
+	text, err := NewTextTemplatePromptProvider(WithTextTemplates(map[string]string{
+		"invoice": "{{range .Fields}}{{.Key}}:{{.Description}};{{end}}",
+	}))
+	require.NoError(t, err)
+
+	for name, tc := range map[string]struct {
+		prompts PromptProvider
+		want    string
+	}{
+		"stick":         {stick, "total:number:EUR;date:string:;"},
+		"text/template": {text, "total:Grand total;date:;"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			inv := &fieldsInvoker{}
+			ext := &Unstructor[doc]{invoker: inv, prompts: tc.prompts, log: slog.Default()}
+			_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset("total 9")}, WithModel("test-model"),
+				WithFieldHints(map[string]FieldHint{"date": {Format: "YYYY-MM-DD"}}))
+			require.NoError(t, err)
+			require.Len(t, inv.prompts, 1)
+			assert.Equal(t, tc.want, inv.prompts[0])
+		})
+	}
+}
+
+func TestExplain_FieldHints(t *testing.T) {
+	type doc struct {
+		Total  float64 `json:"total" desc:"Grand total" unit:"EUR" unstruct:"invoice"`
+		Status string  `json:"status" enum:"paid,open" unstruct:"invoice"`
+		Notes  string  `json:"notes" unstruct:"invoice"`
+	}
+	ext := &Unstructor[doc]{invoker: &fieldsInvoker{}, prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}"}, log: slog.Default()}
+
+	stats, err := ext.DryRun(context.Background(), []Asset{NewTextAsset("total 9")}, WithModel("test-model"))
+	require.NoError(t, err)
+	require.Len(t, stats.GroupDetails, 1)
+	assert.Len(t, stats.GroupDetails[0].FieldHints, 2, "fields without hints are left out")
+
+	plan, err := ext.Explain(context.Background(), []Asset{NewTextAsset("total 9")}, WithModel("test-model"),
+		WithFieldHints(map[string]FieldHint{"total": {Format: "0.00"}}))
+	require.NoError(t, err)
+	assert.Contains(t, plan, "· total: Grand total (format=0.00, unit=EUR)\n")
+	assert.Contains(t, plan, "· status (enum=paid|open)\n")
+	assert.NotContains(t, plan, "· notes")
+}
+
+func TestUnstruct_GeneratedPrompt(t *testing.T) {
+	type doc struct {
+		Vendor string `json:"vendor" desc:"Company that issued the invoice"`
+		Total  string `json:"total" unstruct:"invoice"`
+	}
+	inv := &fieldsInvoker{}
+	ext := &Unstructor[doc]{invoker: inv, prompts: SimplePromptProvider{"invoice": "Extract {{.Keys}}"}, log: slog.Default()}
+
+	res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset("vendor:Acme")}, WithModel("test-model"))
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", res.Value.Vendor)
+	assert.Contains(t, inv.prompts, "Extract total")
+
+	group, ok := res.Metadata.Group("vendor")
+	require.True(t, ok)
+	assert.Empty(t, group.Prompt)
+
+	stats, err := ext.DryRun(context.Background(), []Asset{NewTextAsset("vendor:Acme")}, WithModel("test-model"))
+	require.NoError(t, err)
+	assert.Len(t, stats.GroupDetails, 2)
+}
+
+func TestDryRun_GeneratedPromptIgnoresEarlierErrors(t *testing.T) {
+	type doc struct {
+		Vendor string `json:"vendor" desc:"Company that issued the invoice"`
+	}
+	ext := &Unstructor[doc]{invoker: &fieldsInvoker{}, prompts: SimplePromptProvider{}, log: slog.Default()}
+
+	clean, err := ext.DryRun(context.Background(), []Asset{NewTextAsset("vendor:Acme")}, WithModel("test-model"))
+	require.NoError(t, err)
+
+	// The unreadable asset fails prepareAssets, which must not replace the generated prompt
+	stats, err := ext.DryRun(context.Background(), []Asset{
+		NewTextAsset("vendor:Acme"),
+		&countingAsset{err: errors.New("unreadable")},
+	}, WithModel("test-model"))
+	require.NoError(t, err)
+	require.Len(t, stats.GroupDetails, 1)
+	assert.Equal(t, clean.GroupDetails[0].InputTokens, stats.GroupDetails[0].InputTokens)
+	assert.Greater(t, stats.GroupDetails[0].InputTokens,
+		EstimateTokensFromText(fmt.Sprintf("Extract the following fields from the document: %v", []string{"vendor"})))
+}
+
+func TestGeneratePrompt_SliceOfStructs(t *testing.T) {
+	sch, err := schemaOf[pointerOrder]()
+	require.NoError(t, err)
+
+	prompt := generatePrompt([]string{"items.qty", "items.sku"}, sch.json2field)
+	assert.Contains(t, prompt, `so "a[].b" is returned as {"a": [{"b": ...}, {"b": ...}]}`)
+	assert.Contains(t, prompt, "- items[].sku (string)\n")
+	assert.Contains(t, prompt, "- items[].qty (number)\n")
+	assert.NotContains(t, generatePrompt([]string{"billing.city"}, sch.json2field), "[]")
+
+	// The reply shape the prompt asks for fills the slice
+	c := newCoercer(nil)
+	var order pointerOrder
+	require.NoError(t, patchStruct(&order, []byte(`{"items": [{"sku": "A1", "qty": 2}, {"sku": "B2", "qty": 1}]}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+	assert.Equal(t, []*pointerItem{{SKU: "A1", Qty: 2}, {SKU: "B2", Qty: 1}}, order.Items)
+
+	// Containers nest in the described key
+	type line struct {
+		Amount int `json:"amount"`
+	}
+	type ledger struct {
+		Books map[string][][]line `json:"books" unstruct:"prompt/books"`
+	}
+	lsch, err := schemaOf[ledger]()
+	require.NoError(t, err)
+	assert.Equal(t, "books.<key>[][].amount", describeKey("books.amount", lsch.json2field))
+}
+
+func TestGeneratePrompt_MapOfStructs(t *testing.T) {
+	sch, err := schemaOf[pointerOrder]()
+	require.NoError(t, err)
+
+	keys := []string{"prices.amount", "prices.currency"}
+	prompt := generatePrompt(keys, sch.json2field)
+	assert.Contains(t, prompt, `so "a.<key>.b" is returned as {"a": {"first": {"b": ...}, "second": {"b": ...}}}`)
+	assert.Contains(t, prompt, "- prices.<key>.amount (number)\n")
+	assert.Contains(t, prompt, "- prices.<key>.currency (string)\n")
+	assert.NotContains(t, generatePrompt([]string{"items.sku"}, sch.json2field), "<key>")
+
+	// The reply shape the prompt asks for fills the map
+	c := newCoercer(nil)
+	var order pointerOrder
+	require.NoError(t, patchStruct(&order, []byte(`{"prices": {"list": {"amount": 9.5, "currency": "EUR"}, "sale": {"amount": 8, "currency": "EUR"}}}`), sch.json2field, c))
+	assert.Empty(t, c.errs)
+	assert.Equal(t, map[string]pointerMoney{
+		"list": {Amount: 9.5, Currency: "EUR"},
+		"sale": {Amount: 8, Currency: "EUR"},
+	}, order.Prices)
+
+	// A flat reply converts no entry and leaves the map nil
+	c = newCoercer(nil)
+	order = pointerOrder{}
+	require.NoError(t, patchStruct(&order, []byte(`{"prices": {"amount": 9.5, "currency": "EUR"}}`), sch.json2field, c))
+	assert.Len(t, c.errs, 2)
+	assert.Nil(t, order.Prices)
+}
@@ -0,0 +1,133 @@
+package unstruct
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// LatestPromptVersion asks a versioned provider for the newest template of a tag
+const LatestPromptVersion = 0
+
+// defaultPromptVersion is passed to providers that cannot resolve the latest version
+const defaultPromptVersion = 1
+
+// PromptVersionResolver is implemented by providers that keep several versions of
+// a template. ResolvePromptVersion returns the version of the stored template
+// GetPrompt would render for the request; LatestPromptVersion selects the newest
+// one. A tag with only an unversioned template reports version 1.
+type PromptVersionResolver interface {
+	ResolvePromptVersion(tag string, version int) (int, error)
+}
+
+// splitPromptVersion separates a pinned version from a prompt label, so that
+// "invoice@2" and "invoice@v2" both return ("invoice", 2). Labels without a
+// valid version suffix are returned unchanged with LatestPromptVersion.
+func splitPromptVersion(label string) (string, int) {
+	i := strings.LastIndex(label, "@")
+	if i <= 0 {
+		return label, LatestPromptVersion
+	}
+	v, err := strconv.Atoi(strings.TrimPrefix(label[i+1:], "v"))
+	if err != nil || v <= 0 {
+		return label, LatestPromptVersion
+	}
+	return label[:i], v
+}
+
+// resolvePromptVersion determines the template version used for label. A version
+// pinned in the label wins over WithPromptVersionFor, which wins over
+// WithPromptVersion. It returns the label without the version suffix.
+func resolvePromptVersion(prompts PromptProvider, label string, opts Options) (string, int, error) {
+	name, version := splitPromptVersion(label)
+	if version == LatestPromptVersion {
+		version = opts.PromptVersions[name]
+	}
+	if version == LatestPromptVersion {
+		version = opts.PromptVersion
+	}
+
+	if r, ok := prompts.(PromptVersionResolver); ok {
+		resolved, err := r.ResolvePromptVersion(name, version)
+		if err != nil {
+			return name, version, fmt.Errorf("prompt %q: %w", name, err)
+		}
+		return name, resolved, nil
+	}
+	if version == LatestPromptVersion {
+		version = defaultPromptVersion
+	}
+	return name, version, nil
+}
+
+// templateIndex holds checked templates by name and version; version 0 is the
+// unversioned template. Indexes are never modified once published.
+type templateIndex[T any] map[string]map[int]T
+
+// lookup finds the template for tag at version. While a tag has only an
+// unversioned template it serves every version; once versioned templates exist
+// the unversioned one counts as version 1 and other versions must exist.
+// LatestPromptVersion picks the highest version.
+func (ix templateIndex[T]) lookup(tag string, version int) (T, int, error) {
+	var zero T
+	name, pinned := splitPromptVersion(tag)
+	if pinned != LatestPromptVersion {
+		version = pinned
+	}
+
+	stored := ix[name]
+	unversioned, hasUnversioned := stored[LatestPromptVersion]
+	if len(stored) == 0 || (hasUnversioned && len(stored) == 1) {
+		if !hasUnversioned {
+			return zero, 0, fmt.Errorf("template %q not found", tag)
+		}
+		if version == LatestPromptVersion {
+			version = defaultPromptVersion
+		}
+		return unversioned, version, nil
+	}
+
+	if version == LatestPromptVersion {
+		version = defaultPromptVersion
+		for v := range stored {
+			version = max(version, v)
+		}
+	}
+	if tpl, ok := stored[version]; ok {
+		return tpl, version, nil
+	}
+	if version == defaultPromptVersion && hasUnversioned {
+		return unversioned, version, nil
+	}
+	return zero, 0, fmt.Errorf("template %q version %d not found", name, version)
+}
+
+// resolve reports the version of the template lookup serves for tag at
+// version. An unversioned template serving every version reports version 1.
+func (ix templateIndex[T]) resolve(tag string, version int) (int, error) {
+	_, resolved, err := ix.lookup(tag, version)
+	if err != nil {
+		return 0, err
+	}
+	name, _ := splitPromptVersion(tag)
+	if _, ok := ix[name][resolved]; !ok {
+		return defaultPromptVersion, nil
+	}
+	return resolved, nil
+}
+
+// with returns a copy of the index with one template added; the receiver is
+// left untouched so readers holding it are unaffected
+func (ix templateIndex[T]) with(name string, version int, tpl T) templateIndex[T] {
+	out := make(templateIndex[T], len(ix)+1)
+	for n, versions := range ix {
+		out[n] = versions
+	}
+	versions := make(map[int]T, len(ix[name])+1)
+	for v, t := range ix[name] {
+		versions[v] = t
+	}
+	versions[version] = tpl
+	out[name] = versions
+	return out
+}
@@ -0,0 +1,150 @@
+package unstruct
+
+import (
+	"context"
+	"log/slog"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitPromptVersion(t *testing.T) {
+	for label, want := range map[string]struct {
+		name    string
+		version int
+	}{
+		"invoice":      {"invoice", LatestPromptVersion},
+		"invoice@2":    {"invoice", 2},
+		"invoice@v3":   {"invoice", 3},
+		"invoice@beta": {"invoice@beta", LatestPromptVersion},
+		"@2":           {"@2", LatestPromptVersion},
+	} {
+		name, version := splitPromptVersion(label)
+		assert.Equal(t, want.name, name, label)
+		assert.Equal(t, want.version, version, label)
+	}
+}
+
+func TestStickPromptProvider_Versions(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prompts/invoice.twig":    {Data: []byte("invoice v{{ Version }} (unversioned)")},
+		"prompts/invoice@v2.twig": {Data: []byte("invoice v{{ Version }}")},
+		"prompts/v3/invoice.twig": {Data: []byte("invoice v{{ Version }} from dir")},
+		"prompts/person.twig":     {Data: []byte("person v{{ Version }}")},
+	}
+	provider, err := NewStickPromptProvider(WithFS(fsys, "prompts"))
+	require.NoError(t, err)
+
+	for version, want := range map[int]string{
+		LatestPromptVersion: "invoice v3 from dir",
+		1:                   "invoice v1 (unversioned)",
+		2:                   "invoice v2",
+	} {
+		prompt, err := provider.GetPrompt("invoice", version)
+		require.NoError(t, err)
+		assert.Equal(t, want, prompt)
+	}
+
+	prompt, err := provider.GetPrompt("invoice@2", LatestPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "invoice v2", prompt)
+
+	_, err = provider.GetPrompt("invoice", 4)
+	assert.ErrorContains(t, err, `template "invoice" version 4 not found`)
+
+	// Tags without versioned templates render for any version
+	resolved, err := provider.ResolvePromptVersion("person", LatestPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved)
+	prompt, err = provider.GetPrompt("person", 5)
+	require.NoError(t, err)
+	assert.Equal(t, "person v5", prompt)
+	resolved, err = provider.ResolvePromptVersion("person", 5)
+	require.NoError(t, err)
+	assert.Equal(t, 1, resolved, "reports the stored version, not the requested one")
+}
+
+func TestUnstruct_PromptVersions(t *testing.T) {
+	type doc struct {
+		Total  string `json:"total" unstruct:"prompt/invoice@2"`
+		Vendor string `json:"vendor" unstruct:"prompt/vendor"`
+		Date   string `json:"date" unstruct:"prompt/date"`
+	}
+	prompts, err := NewStickPromptProvider(WithTemplates(map[string]string{
+		"invoice":    "invoice v1",
+		"invoice@v2": "invoice v2",
+		"vendor@v1":  "vendor v1",
+		"vendor@v2":  "vendor v2",
+		"vendor@v3":  "vendor v3",
+		"date@v1":    "date v1",
+		"date@v2":    "date v2",
+	}))
+	require.NoError(t, err)
+	inv := &chunkInvoker{}
+	ext := &Unstructor[doc]{invoker: inv, prompts: prompts, log: slog.Default()}
+
+	res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset("text")},
+		WithModel("test-model"),
+		WithPromptVersion(1),
+		WithPromptVersionFor("vendor", 2),
+		WithPromptVersionFor("invoice", 1),
+	)
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"invoice v2", "vendor v2", "date v1"}, inv.prompts)
+
+	for key, want := range map[string]GroupResult{
+		"total":  {Prompt: "invoice", Version: 2},
+		"vendor": {Prompt: "vendor", Version: 2},
+		"date":   {Prompt: "date", Version: 1},
+	} {
+		group, ok := res.Metadata.Group(key)
+		require.True(t, ok, key)
+		assert.Equal(t, want.Prompt, group.Prompt, key)
+		assert.Equal(t, want.Version, group.Version, key)
+	}
+
+	// Plans show the version the real call would use
+	stats, err := ext.DryRun(context.Background(), []Asset{NewTextAsset("text")}, WithModel("test-model"))
+	require.NoError(t, err)
+	versions := map[string]int{}
+	for _, g := range stats.GroupDetails {
+		versions[g.PromptName] = g.Version
+	}
+	assert.Equal(t, map[string]int{"invoice": 2, "vendor": 3, "date": 2}, versions)
+
+	// Unknown versions fail the group instead of silently using another template
+	_, err = ext.Unstruct(context.Background(), []Asset{NewTextAsset("text")},
+		WithModel("test-model"), WithPromptVersionFor("date", 9))
+	assert.ErrorContains(t, err, `template "date" version 9 not found`)
+}
+
+func TestUnstruct_PromptVersionUnversionedTemplate(t *testing.T) {
+	type doc struct {
+		Name string `json:"name" unstruct:"prompt/person"`
+	}
+	prompts, err := NewTextTemplatePromptProvider(WithTextTemplates(map[string]string{"person": "person"}))
+	require.NoError(t, err)
+	ext := &Unstructor[doc]{invoker: staticInvoker(`{"name": "Ada"}`), prompts: prompts, log: slog.Default()}
+
+	res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset("text")},
+		WithModel("test-model"), WithPromptVersion(4))
+	require.NoError(t, err)
+	group, ok := res.Metadata.Group("name")
+	require.True(t, ok)
+	assert.Equal(t, 1, group.Version)
+}
+
+func TestResolvePromptVersion_PlainProvider(t *testing.T) {
+	prompts := SimplePromptProvider{"invoice": "x"}
+
+	name, version, err := resolvePromptVersion(prompts, "invoice", Options{})
+	require.NoError(t, err)
+	assert.Equal(t, "invoice", name)
+	assert.Equal(t, 1, version)
+
+	_, version, err = resolvePromptVersion(prompts, "invoice", Options{PromptVersion: 4})
+	require.NoError(t, err)
+	assert.Equal(t, 4, version)
+}
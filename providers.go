@@ -4,47 +4,77 @@ import (
 	"fmt"
 	"io/fs"
 	"path/filepath"
+	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/tyler-sommer/stick"
 )
 
-// → StickPromptProvider is fs-agnostic
+// versionDirRegex matches per-version template directories such as v3
+var versionDirRegex = regexp.MustCompile(`^v\d+$`)
+
+// → StickPromptProvider is fs-agnostic and safe for concurrent use
 type StickPromptProvider struct {
 	env       *stick.Env
-	templates map[string]string
+	mu        sync.RWMutex           // guards templates and index
+	templates map[string]string      // sources by template key; options write here before compile
+	index     templateIndex[string]  // checked templates served to callers
 	vars      map[string]interface{} // Template variables
 }
 
 // → Option pattern keeps the constructor flexible
 type Option func(*StickPromptProvider) error
 
-// WithFS loads every *.twig* file found under dir in the supplied FS.
+// WithFS loads every *.twig* file found under dir in the supplied FS. Versions
+// come from an @vN suffix (invoice@v3.twig) or a vN directory (v3/invoice.twig).
 func WithFS[F fs.FS](fsys F, dir string) Option {
 	return func(p *StickPromptProvider) error {
-		return fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
-			if err != nil {
-				return err
-			}
-			if d.IsDir() || !strings.HasSuffix(path, ".twig") {
-				return nil
-			}
-			content, readErr := fs.ReadFile(fsys, path)
-			if readErr != nil {
-				return fmt.Errorf("read %s: %w", path, readErr)
-			}
-			tag := strings.TrimSuffix(filepath.Base(path), ".twig")
-			p.templates[tag] = string(content)
-			return nil
-		})
+		templates, err := loadTemplates(fsys, dir, ".twig")
+		if err != nil {
+			return err
+		}
+		for k, v := range templates {
+			p.templates[k] = v
+		}
+		return nil
 	}
 }
 
+// loadTemplates reads every file with extension ext under dir, keyed by template name and version
+func loadTemplates(fsys fs.FS, dir, ext string) (map[string]string, error) {
+	templates := make(map[string]string)
+	err := fs.WalkDir(fsys, dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || !strings.HasSuffix(path, ext) {
+			return nil
+		}
+		content, readErr := fs.ReadFile(fsys, path)
+		if readErr != nil {
+			return fmt.Errorf("read %s: %w", path, readErr)
+		}
+		// invoice@v3.twig and v3/invoice.twig both hold version 3 of invoice
+		tag := strings.TrimSuffix(filepath.Base(path), ext)
+		name, version := splitPromptVersion(tag)
+		if version == LatestPromptVersion {
+			if dir := filepath.Base(filepath.Dir(path)); versionDirRegex.MatchString(dir) {
+				version, _ = strconv.Atoi(dir[1:])
+			}
+		}
+		templates[templateKey(name, version)] = string(content)
+		return nil
+	})
+	return templates, err
+}
+
 // WithTemplates lets you inject an in-memory map.
 func WithTemplates(m map[string]string) Option {
 	return func(p *StickPromptProvider) error {
 		for k, v := range m {
-			p.templates[k] = v
+			p.templates[templateKey(splitPromptVersion(k))] = v
 		}
 		return nil
 	}
@@ -73,62 +103,197 @@ func NewStickPromptProvider(opts ...Option) (*StickPromptProvider, error) {
 			return nil, err
 		}
 	}
+
+	// Syntax errors surface here rather than in the middle of an extraction
+	index, err := p.compile(p.templates)
+	if err != nil {
+		return nil, err
+	}
+	p.index = index
 	return p, nil
 }
 
-// AddTemplate updates or inserts one template.
-func (p *StickPromptProvider) AddTemplate(tag, tpl string) { p.templates[tag] = tpl }
+// AddTemplate updates or inserts one template. A tag such as "invoice@v3"
+// stores version 3 of invoice. The template is not checked; a broken one fails
+// when it is rendered. Use AddTemplateChecked to reject it up front.
+func (p *StickPromptProvider) AddTemplate(tag, tpl string) {
+	name, version := splitPromptVersion(tag)
+	p.store(name, version, tpl)
+}
 
-// GetPrompt renders the template for the given tag.
-func (p *StickPromptProvider) GetPrompt(tag string, version int) (string, error) {
-	tpl, ok := p.templates[tag]
-	if !ok {
-		return "", fmt.Errorf("template %q not found", tag)
+// AddTemplateChecked is like AddTemplate but test-renders the template first.
+// A template that fails is rejected with an error and the previous one is kept.
+func (p *StickPromptProvider) AddTemplateChecked(tag, tpl string) error {
+	name, version := splitPromptVersion(tag)
+	if err := p.check(name, tpl, version); err != nil {
+		return fmt.Errorf("template %q: %w", tag, err)
 	}
+	p.store(name, version, tpl)
+	return nil
+}
 
-	// Prepare template context with default variables plus custom ones
-	templateCtx := make(map[string]stick.Value)
-	templateCtx["version"] = version
-	templateCtx["tag"] = tag
-	templateCtx["Version"] = version // Capitalized version for consistency
-	templateCtx["Tag"] = tag         // Capitalized version for consistency
+// store swaps in a copy of the template set with tpl as version of name
+func (p *StickPromptProvider) store(name string, version int, tpl string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	templates := make(map[string]string, len(p.templates)+1)
+	for k, v := range p.templates {
+		templates[k] = v
+	}
+	templates[templateKey(name, version)] = tpl
+	p.templates = templates
+	p.index = p.index.with(name, version, tpl)
+}
 
-	// Add custom variables
-	for k, v := range p.vars {
-		templateCtx[k] = v
+// replaceTemplates swaps in a complete template set and its index
+func (p *StickPromptProvider) replaceTemplates(templates map[string]string, index templateIndex[string]) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.templates = templates
+	p.index = index
+}
+
+// compile checks every template and indexes it by name and version
+func (p *StickPromptProvider) compile(templates map[string]string) (templateIndex[string], error) {
+	index := make(templateIndex[string])
+	for key, tpl := range templates {
+		name, version := splitPromptVersion(key)
+		if err := p.check(name, tpl, version); err != nil {
+			return nil, fmt.Errorf("template %q: %w", key, err)
+		}
+		if index[name] == nil {
+			index[name] = make(map[int]string)
+		}
+		index[name][version] = tpl
 	}
+	return index, nil
+}
 
-	var out strings.Builder
-	if err := p.env.Execute(tpl, &out, templateCtx); err != nil {
-		return "", fmt.Errorf("execute %q: %w", tag, err)
+// samplePromptContext is used to test-render templates before they are served
+var samplePromptContext = PromptContext{
+	Keys:     []string{"example"},
+	Fields:   []PromptField{{Key: "example", Type: "string", FieldHint: FieldHint{Description: "example field", Enum: []string{"a", "b"}}}},
+	Document: "example document",
+	Assets:   []PromptAsset{{Text: "example document", MimeType: "text/plain"}},
+}
+
+// check parses and test-renders tpl with sample context variables
+func (p *StickPromptProvider) check(name, tpl string, version int) error {
+	if version == LatestPromptVersion {
+		version = defaultPromptVersion
 	}
-	return out.String(), nil
+	pc := samplePromptContext
+	_, err := p.render(name, tpl, version, &pc)
+	return err
+}
+
+// templateKey is the storage key of a template version
+func templateKey(name string, version int) string {
+	if version == LatestPromptVersion {
+		return name
+	}
+	return fmt.Sprintf("%s@v%d", name, version)
+}
+
+// lookup finds the template for tag at version
+func (p *StickPromptProvider) lookup(tag string, version int) (string, int, error) {
+	p.mu.RLock()
+	index := p.index
+	p.mu.RUnlock()
+	return index.lookup(tag, version)
+}
+
+// ResolvePromptVersion reports which stored version GetPrompt renders for tag
+// and version
+func (p *StickPromptProvider) ResolvePromptVersion(tag string, version int) (int, error) {
+	p.mu.RLock()
+	index := p.index
+	p.mu.RUnlock()
+	return index.resolve(tag, version)
+}
+
+// GetPrompt renders the template for the given tag. version selects one of the
+// tag's versioned templates; LatestPromptVersion renders the newest.
+func (p *StickPromptProvider) GetPrompt(tag string, version int) (string, error) {
+	tpl, version, err := p.lookup(tag, version)
+	if err != nil {
+		return "", err
+	}
+	return p.render(tag, tpl, version, nil)
 }
 
 // GetPromptWithContext renders the template with additional context variables.
 func (p *StickPromptProvider) GetPromptWithContext(tag string, version int, keys []string, document string) (string, error) {
-	tpl, ok := p.templates[tag]
-	if !ok {
-		return "", fmt.Errorf("template %q not found", tag)
+	return p.GetPromptWithAssets(tag, version, PromptContext{Keys: keys, Document: document})
+}
+
+// GetPromptWithAssets renders the template with the keys, the concatenated
+// document, the ordered list of assets and any few-shot examples. Each entry of
+// assets exposes index, text, mime_type, display_name and labels; each entry of
+// fields exposes key, type, description, format, unit, enum and example.
+func (p *StickPromptProvider) GetPromptWithAssets(tag string, version int, pc PromptContext) (string, error) {
+	tpl, version, err := p.lookup(tag, version)
+	if err != nil {
+		return "", err
 	}
+	return p.render(tag, tpl, version, &pc)
+}
 
+// render executes tpl. Without a prompt context only the tag, version and custom
+// variables are available.
+func (p *StickPromptProvider) render(tag, tpl string, version int, pc *PromptContext) (string, error) {
 	// Prepare template context with default variables plus custom ones
 	templateCtx := make(map[string]stick.Value)
 	templateCtx["version"] = version
 	templateCtx["tag"] = tag
 	templateCtx["Version"] = version // Capitalized version for consistency
 	templateCtx["Tag"] = tag         // Capitalized version for consistency
-	templateCtx["keys"] = keys
-	templateCtx["Keys"] = keys
-	templateCtx["KeyList"] = strings.Join(keys, ", ") // Comma-separated string of keys
-	templateCtx["document"] = document
-	templateCtx["Document"] = document
+
+	if pc != nil {
+		assets := make([]map[string]interface{}, 0, len(pc.Assets))
+		for _, a := range pc.Assets {
+			assets = append(assets, map[string]interface{}{
+				"index":        a.Index,
+				"text":         a.Text,
+				"mime_type":    a.MimeType,
+				"display_name": a.DisplayName,
+				"labels":       a.Labels,
+			})
+		}
+
+		fields := make([]map[string]interface{}, 0, len(pc.Fields))
+		for _, f := range pc.Fields {
+			fields = append(fields, map[string]interface{}{
+				"key":         f.Key,
+				"type":        f.Type,
+				"description": f.Description,
+				"format":      f.Format,
+				"unit":        f.Unit,
+				"enum":        f.Enum,
+				"example":     f.Example,
+			})
+		}
+
+		templateCtx["keys"] = pc.Keys
+		templateCtx["Keys"] = pc.Keys
+		templateCtx["KeyList"] = strings.Join(pc.Keys, ", ") // Comma-separated string of keys
+		templateCtx["document"] = pc.Document
+		templateCtx["Document"] = pc.Document
+		templateCtx["assets"] = assets
+		templateCtx["Assets"] = assets
+		templateCtx["fields"] = fields
+		templateCtx["Fields"] = fields
+		templateCtx["examples"] = pc.Examples
+		templateCtx["Examples"] = pc.Examples
+	}
 
 	// Add custom variables
 	for k, v := range p.vars {
 		templateCtx[k] = v
 	}
 
+	// stick parses the source on every Execute and cannot run a parsed tree
+	// through its public API, so compiled templates are not cached.
 	var out strings.Builder
 	if err := p.env.Execute(tpl, &out, templateCtx); err != nil {
 		return "", fmt.Errorf("execute %q: %w", tag, err)
@@ -1,6 +1,8 @@
 package unstruct
 
 import (
+	"fmt"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -158,3 +160,72 @@ func TestStickPromptProvider_GetPromptWithContext(t *testing.T) {
 		assert.Contains(t, err.Error(), "not found")
 	})
 }
+
+func TestStickPromptProvider_GetPromptWithAssets(t *testing.T) {
+	provider, err := NewStickPromptProvider(WithTemplates(map[string]string{
+		"multi": "{% for a in assets %}[{{ a.index }} {{ a.display_name }} {{ a.mime_type }}] {{ a.text }}\n{% endfor %}",
+	}))
+	require.NoError(t, err)
+
+	prompt, err := provider.GetPromptWithAssets("multi", 1, PromptContext{
+		Keys: []string{"total"},
+		Assets: []PromptAsset{
+			{Index: 0, Text: "invoice text", MimeType: "text/plain", DisplayName: "invoice.txt"},
+			{Index: 2, MimeType: "image/png", DisplayName: "photo.png"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "[0 invoice.txt text/plain] invoice text\n[2 photo.png image/png] \n", prompt)
+}
+
+func TestStickPromptProvider_SyntaxErrorsAtConstruction(t *testing.T) {
+	_, err := NewStickPromptProvider(WithTemplates(map[string]string{
+		"ok":     "Extract {{ KeyList }}",
+		"broken": "Extract {% for key in Keys %}{{ key }}",
+	}))
+	assert.ErrorContains(t, err, `template "broken"`)
+
+	provider, err := NewStickPromptProvider()
+	require.NoError(t, err)
+	assert.Error(t, provider.AddTemplateChecked("broken", "{% if %}"))
+	_, err = provider.GetPrompt("broken", 1)
+	assert.ErrorContains(t, err, "not found")
+
+	require.NoError(t, provider.AddTemplateChecked("invoice", "Invoice {{ Tag }}"))
+	assert.Error(t, provider.AddTemplateChecked("invoice", "Invoice {% endif %}"))
+	prompt, err := provider.GetPrompt("invoice", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice invoice", prompt, "a rejected template keeps the previous one")
+
+	// Unchecked templates fail when rendered
+	provider.AddTemplate("invoice", "Invoice {% endif %}")
+	_, err = provider.GetPrompt("invoice", 1)
+	assert.Error(t, err)
+}
+
+func TestStickPromptProvider_ConcurrentUse(t *testing.T) {
+	provider, err := NewStickPromptProvider(WithTemplates(map[string]string{"base": "Extract {{ KeyList }}"}))
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			provider.AddTemplate(fmt.Sprintf("tpl-%d", i), "Template {{ KeyList }}")
+			assert.NoError(t, provider.AddTemplateChecked(fmt.Sprintf("base@v%d", i+2), "Base v{{ Version }}"))
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				_, err := provider.GetPromptWithContext("base", LatestPromptVersion, []string{"a"}, "doc")
+				assert.NoError(t, err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	prompt, err := provider.GetPrompt("base", LatestPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "Base v9", prompt)
+}
@@ -0,0 +1,175 @@
+package unstruct
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often ReloadingPromptProvider polls when no interval is given
+const DefaultReloadInterval = 2 * time.Second
+
+// ReloadingPromptProvider is a StickPromptProvider that polls a template
+// directory and swaps in the new template set when files change. A changed set
+// is test-rendered first; if any template fails, the previous set stays active.
+// Templates added by options are kept across reloads, templates added with
+// AddTemplate or AddTemplateChecked are not.
+type ReloadingPromptProvider struct {
+	*StickPromptProvider
+
+	fsys         fs.FS
+	dir          string
+	providerOpts []Option
+	base         map[string]string // templates from options, overlaid by files
+	interval     time.Duration
+	onReload     func(error) // nil → ignored
+
+	mu       sync.Mutex
+	loaded   bool
+	digest   [sha256.Size]byte // active file set
+	rejected [sha256.Size]byte // file set that last failed validation
+	lastErr  error
+
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// ReloadOption configures a ReloadingPromptProvider
+type ReloadOption func(*ReloadingPromptProvider)
+
+// WithReloadInterval sets how often the directory is polled
+func WithReloadInterval(d time.Duration) ReloadOption {
+	return func(r *ReloadingPromptProvider) { r.interval = d }
+}
+
+// WithReloadHook is called after every reload attempt triggered by a change,
+// with nil on success or the reason the new templates were rejected.
+func WithReloadHook(fn func(error)) ReloadOption {
+	return func(r *ReloadingPromptProvider) { r.onReload = fn }
+}
+
+// WithProviderOptions applies StickPromptProvider options such as WithVar or WithTemplates
+func WithProviderOptions(opts ...Option) ReloadOption {
+	return func(r *ReloadingPromptProvider) { r.providerOpts = append(r.providerOpts, opts...) }
+}
+
+// NewReloadingPromptProvider loads every *.twig file under dir and starts
+// polling it for changes. Call Close to stop polling.
+func NewReloadingPromptProvider(fsys fs.FS, dir string, opts ...ReloadOption) (*ReloadingPromptProvider, error) {
+	r := &ReloadingPromptProvider{
+		fsys:     fsys,
+		dir:      dir,
+		interval: DefaultReloadInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if r.interval <= 0 {
+		r.interval = DefaultReloadInterval
+	}
+
+	p, err := NewStickPromptProvider(r.providerOpts...)
+	if err != nil {
+		return nil, err
+	}
+	r.StickPromptProvider = p
+	r.base = p.templates
+
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	go r.poll()
+	return r, nil
+}
+
+// Reload reads the directory and activates its templates if they changed and
+// all render. It reports whether a new set was activated.
+func (r *ReloadingPromptProvider) Reload() (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	files, err := loadTemplates(r.fsys, r.dir, ".twig")
+	if err != nil {
+		r.lastErr = fmt.Errorf("load templates: %w", err)
+		return false, r.lastErr
+	}
+	digest := templatesDigest(files)
+	if r.loaded && (digest == r.digest || (r.lastErr != nil && digest == r.rejected)) {
+		return false, nil
+	}
+
+	templates := make(map[string]string, len(r.base)+len(files))
+	for k, v := range r.base {
+		templates[k] = v
+	}
+	for k, v := range files {
+		templates[k] = v
+	}
+	index, err := r.compile(templates)
+	if err != nil {
+		r.rejected = digest
+		r.lastErr = fmt.Errorf("validate: %w", err)
+		return false, r.lastErr
+	}
+
+	r.replaceTemplates(templates, index)
+	r.loaded = true
+	r.digest = digest
+	r.lastErr = nil
+	return true, nil
+}
+
+// LastError returns why the most recent reload was rejected, or nil
+func (r *ReloadingPromptProvider) LastError() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.lastErr
+}
+
+// Close stops polling. It is safe to call more than once.
+func (r *ReloadingPromptProvider) Close() error {
+	r.once.Do(func() { close(r.stop) })
+	<-r.done
+	return nil
+}
+
+func (r *ReloadingPromptProvider) poll() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			changed, err := r.Reload()
+			if (changed || err != nil) && r.onReload != nil {
+				r.onReload(err)
+			}
+		}
+	}
+}
+
+// templatesDigest fingerprints a template set independent of map order
+func templatesDigest(templates map[string]string) [sha256.Size]byte {
+	keys := make([]string, 0, len(templates))
+	for k := range templates {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s\x00%d\x00%s", k, len(templates[k]), templates[k])
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	return sum
+}
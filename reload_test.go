@@ -0,0 +1,103 @@
+package unstruct
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTemplate(t *testing.T, dir, name, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644))
+}
+
+func TestReloadingPromptProvider_Reload(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "invoice.twig", "Extract {{ KeyList }} v1")
+	writeTemplate(t, dir, "person.twig", "Person {{ KeyList }}")
+
+	p, err := NewReloadingPromptProvider(os.DirFS(dir), ".",
+		WithReloadInterval(time.Hour),
+		WithProviderOptions(WithTemplates(map[string]string{"static": "static"})),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	prompt, err := p.GetPromptWithContext("invoice", 1, []string{"total"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Extract total v1", prompt)
+
+	changed, err := p.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed, "unchanged files keep the active set")
+
+	// A broken template rejects the whole set; the previous one stays active
+	writeTemplate(t, dir, "invoice.twig", "Extract {{ KeyList }} v2")
+	writeTemplate(t, dir, "person.twig", "Person {% if %}")
+	changed, err = p.Reload()
+	assert.False(t, changed)
+	assert.ErrorContains(t, err, `validate: template "person"`)
+	assert.Equal(t, err, p.LastError())
+	prompt, err = p.GetPromptWithContext("invoice", 1, []string{"total"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Extract total v1", prompt)
+
+	// Fixing it activates every change at once, keeping option templates
+	writeTemplate(t, dir, "person.twig", "Person {{ KeyList }} v2")
+	writeTemplate(t, dir, "v2/invoice.twig", "Invoice v2 from dir")
+	changed, err = p.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.NoError(t, p.LastError())
+
+	prompt, err = p.GetPrompt("invoice", LatestPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "Invoice v2 from dir", prompt)
+	prompt, err = p.GetPromptWithContext("person", 1, []string{"name"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Person name v2", prompt)
+	prompt, err = p.GetPrompt("static", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "static", prompt)
+}
+
+func TestReloadingPromptProvider_Polls(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "invoice.twig", "v1")
+
+	reloaded := make(chan error, 10)
+	p, err := NewReloadingPromptProvider(os.DirFS(dir), ".",
+		WithReloadInterval(10*time.Millisecond),
+		WithReloadHook(func(err error) { reloaded <- err }),
+	)
+	require.NoError(t, err)
+	defer p.Close()
+
+	writeTemplate(t, dir, "invoice.twig", "v2")
+	select {
+	case err := <-reloaded:
+		require.NoError(t, err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("templates were not reloaded")
+	}
+
+	prompt, err := p.GetPrompt("invoice", 1)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", prompt)
+
+	require.NoError(t, p.Close())
+	require.NoError(t, p.Close())
+}
+
+func TestNewReloadingPromptProvider_InvalidTemplate(t *testing.T) {
+	dir := t.TempDir()
+	writeTemplate(t, dir, "invoice.twig", "{% for %}")
+
+	_, err := NewReloadingPromptProvider(os.DirFS(dir), ".")
+	assert.ErrorContains(t, err, `validate: template "invoice"`)
+}
@@ -0,0 +1,38 @@
+package unstruct
+
+// Result is the outcome of an extraction together with metadata describing
+// how each prompt group was executed.
+type Result[T any] struct {
+	Value    *T
+	Metadata ResultMetadata
+}
+
+// ResultMetadata records per-group execution details of one extraction
+type ResultMetadata struct {
+	Groups []GroupResult `json:"groups"`
+	// CoercionErrors lists response values that could not be converted to
+	// their field's type; those fields are left as they were
+	CoercionErrors []CoercionError `json:"coercionErrors,omitempty"`
+}
+
+// GroupResult describes one executed prompt group
+type GroupResult struct {
+	Prompt   string   `json:"prompt"`             // resolved prompt label
+	Version  int      `json:"version"`            // template version the prompt was rendered from
+	Model    string   `json:"model"`              // model used for the call
+	Variant  string   `json:"variant,omitempty"`  // experiment variant the document was assigned to
+	Fields   []string `json:"fields"`             // JSON keys extracted by the group
+	ChunkIDs []string `json:"chunkIds,omitempty"` // retrieved chunks sent to the model, in document order
+}
+
+// Group returns the metadata of the group that extracted the given JSON key
+func (m ResultMetadata) Group(key string) (GroupResult, bool) {
+	for _, g := range m.Groups {
+		for _, f := range g.Fields {
+			if f == key {
+				return g, true
+			}
+		}
+	}
+	return GroupResult{}, false
+}
@@ -0,0 +1,239 @@
+package unstruct
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// DefaultRetrievalTopK is the number of chunks kept per prompt group when RetrievalOptions.TopK is zero
+const DefaultRetrievalTopK = 5
+
+// DefaultRetrievalChunkTokens is the chunk size used for retrieval when none is configured
+const DefaultRetrievalChunkTokens = 512
+
+// Chunk is a piece of a document considered for retrieval
+type Chunk struct {
+	ID   string // "<asset index>:<chunk index>", stable for one call
+	Text string
+}
+
+// Retriever ranks document chunks against a query built from a prompt group.
+// Implementations return at most k chunks, most relevant first.
+type Retriever interface {
+	Retrieve(ctx context.Context, query string, chunks []Chunk, k int) ([]Chunk, error)
+}
+
+// RetrievalOptions narrows the document sent to each prompt group to the
+// chunks most relevant to that group's prompt and keys.
+type RetrievalOptions struct {
+	Retriever Retriever       // nil → BM25Retriever
+	TopK      int             // chunks per group; 0 → DefaultRetrievalTopK
+	Chunking  ChunkingOptions // how the document is split; zero → paragraphs of DefaultRetrievalChunkTokens
+}
+
+func (r *RetrievalOptions) retriever() Retriever {
+	if r.Retriever != nil {
+		return r.Retriever
+	}
+	return NewBM25Retriever()
+}
+
+func (r *RetrievalOptions) topK() int {
+	if r.TopK > 0 {
+		return r.TopK
+	}
+	return DefaultRetrievalTopK
+}
+
+func (r *RetrievalOptions) chunking() ChunkingOptions {
+	c := r.Chunking
+	if c.Strategy == ChunkNone {
+		c.Strategy = ChunkByParagraphs
+	}
+	if c.ChunkTokens <= 0 {
+		c.ChunkTokens = DefaultRetrievalChunkTokens
+	}
+	return c
+}
+
+// BM25Retriever is a dependency-free Okapi BM25 ranker
+type BM25Retriever struct {
+	K1 float64 // term frequency saturation
+	B  float64 // length normalisation
+}
+
+// NewBM25Retriever returns a BM25 retriever with the usual k1 = 1.2 and b = 0.75
+func NewBM25Retriever() *BM25Retriever {
+	return &BM25Retriever{K1: 1.2, B: 0.75}
+}
+
+// Retrieve scores chunks against query and returns the k best; ties keep document order
+func (r *BM25Retriever) Retrieve(ctx context.Context, query string, chunks []Chunk, k int) ([]Chunk, error) {
+	if k <= 0 || k >= len(chunks) {
+		return chunks, nil
+	}
+
+	texts := make([]string, len(chunks))
+	for i, c := range chunks {
+		texts[i] = c.Text
+	}
+	order := rankByScore(r.scores(query, texts))
+
+	top := make([]Chunk, 0, k)
+	for _, i := range order[:k] {
+		top = append(top, chunks[i])
+	}
+	return top, nil
+}
+
+// rankByScore returns indices ordered by descending score; ties keep their order
+func rankByScore(scores []float64) []int {
+	order := make([]int, len(scores))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	return order
+}
+
+// scores returns the BM25 score of every text for query
+func (r *BM25Retriever) scores(query string, texts []string) []float64 {
+	docs := make([][]string, len(texts))
+	df := map[string]int{}
+	var totalLen int
+	for i, text := range texts {
+		docs[i] = tokenize(text)
+		totalLen += len(docs[i])
+		seen := map[string]bool{}
+		for _, term := range docs[i] {
+			if !seen[term] {
+				seen[term] = true
+				df[term]++
+			}
+		}
+	}
+	avgLen := float64(totalLen) / float64(max(len(texts), 1))
+	if avgLen == 0 {
+		avgLen = 1
+	}
+
+	queryTerms := map[string]bool{}
+	for _, term := range tokenize(query) {
+		queryTerms[term] = true
+	}
+
+	n := float64(len(texts))
+	scores := make([]float64, len(texts))
+	for i, doc := range docs {
+		tf := map[string]int{}
+		for _, term := range doc {
+			if queryTerms[term] {
+				tf[term]++
+			}
+		}
+		for term, f := range tf {
+			idf := math.Log((n-float64(df[term])+0.5)/(float64(df[term])+0.5) + 1)
+			freq := float64(f)
+			scores[i] += idf * freq * (r.K1 + 1) / (freq + r.K1*(1-r.B+r.B*float64(len(doc))/avgLen))
+		}
+	}
+	return scores
+}
+
+// tokenize lowercases text and splits it into letter/digit terms
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// retrievalQuery describes what a prompt group is looking for
+func retrievalQuery(label string, keys []string) string {
+	terms := []string{label}
+	for _, key := range keys {
+		terms = append(terms, splitIdentifier(key)...)
+	}
+	return strings.Join(terms, " ")
+}
+
+// splitIdentifier breaks dotted, snake_case and camelCase keys into words
+func splitIdentifier(key string) []string {
+	var words []string
+	var cur []rune
+	flush := func() {
+		if len(cur) > 0 {
+			words = append(words, string(cur))
+			cur = cur[:0]
+		}
+	}
+	runes := []rune(key)
+	for i, r := range runes {
+		switch {
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			flush()
+		case unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]):
+			flush()
+			cur = append(cur, unicode.ToLower(r))
+		default:
+			cur = append(cur, unicode.ToLower(r))
+		}
+	}
+	flush()
+	return words
+}
+
+// narrow keeps only the text chunks the retriever ranks highest for query. Media
+// parts are kept. It returns the narrowed snapshot and the ids of the chunks
+// sent, in document order.
+func (p *preparedAssets) narrow(ctx context.Context, query string, opts *RetrievalOptions) (*preparedAssets, []string, error) {
+	chunking := opts.chunking()
+	var (
+		chunks []Chunk
+		owner  []int // asset index per chunk
+	)
+	for ai, messages := range p.perAsset {
+		var texts []string
+		for _, msg := range messages {
+			for _, part := range msg.Parts {
+				if part.Type == "text" && part.Text != "" {
+					texts = append(texts, part.Text)
+				}
+			}
+		}
+		if len(texts) == 0 {
+			continue
+		}
+		for ci, text := range splitText(strings.Join(texts, "\n\n"), chunking) {
+			chunks = append(chunks, Chunk{ID: fmt.Sprintf("%d:%d", ai, ci), Text: text})
+			owner = append(owner, ai)
+		}
+	}
+	if len(chunks) == 0 {
+		return p, nil, nil
+	}
+
+	selected, err := opts.retriever().Retrieve(ctx, query, chunks, opts.topK())
+	if err != nil {
+		return nil, nil, fmt.Errorf("retrieve: %w", err)
+	}
+
+	// Restore document order so the model reads the chunks as they appear
+	keep := map[string]bool{}
+	for _, c := range selected {
+		keep[c.ID] = true
+	}
+	texts := map[int][]string{}
+	var ids []string
+	for i, c := range chunks {
+		if !keep[c.ID] {
+			continue
+		}
+		ids = append(ids, c.ID)
+		texts[owner[i]] = append(texts[owner[i]], c.Text)
+	}
+	return p.withAssetTexts(texts), ids, nil
+}
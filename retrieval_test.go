@@ -0,0 +1,82 @@
+package unstruct
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBM25Retriever(t *testing.T) {
+	chunks := []Chunk{
+		{ID: "0:0", Text: "The parties agree to the terms of service."},
+		{ID: "0:1", Text: "Invoice total amount due: 1200 EUR, payment within 30 days."},
+		{ID: "0:2", Text: "Signed in Berlin by both parties."},
+		{ID: "0:3", Text: "Payment by bank transfer; the invoice number is 42."},
+	}
+
+	top, err := NewBM25Retriever().Retrieve(context.Background(), "invoice total payment", chunks, 2)
+	require.NoError(t, err)
+	require.Len(t, top, 2)
+	assert.Equal(t, "0:1", top[0].ID)
+	assert.Equal(t, "0:3", top[1].ID)
+
+	all, err := NewBM25Retriever().Retrieve(context.Background(), "anything", chunks, 10)
+	require.NoError(t, err)
+	assert.Len(t, all, 4)
+}
+
+func TestRetrievalQuery(t *testing.T) {
+	assert.Equal(t, "invoice total amount due date", retrievalQuery("invoice", []string{"totalAmount", "due_date"}))
+}
+
+// failingRetriever always returns an error
+type failingRetriever struct{}
+
+func (failingRetriever) Retrieve(ctx context.Context, query string, chunks []Chunk, k int) ([]Chunk, error) {
+	return nil, errors.New("index offline")
+}
+
+func TestUnstruct_Retrieval(t *testing.T) {
+	type contract struct {
+		Total   string `json:"total" unstruct:"invoice"`
+		Signing string `json:"signing_city" unstruct:"signature"`
+	}
+	doc := strings.Join([]string{
+		"The parties agree to the terms of service.",
+		"Invoice total amount due: 1200 EUR.",
+		"Signed in Berlin, signing city of record.",
+		"Annex with unrelated boilerplate text.",
+	}, "\n\n")
+
+	inv := &chunkInvoker{}
+	ext := &Unstructor[contract]{invoker: inv, prompts: chunkPrompts{}, log: slog.Default()}
+	res, err := ext.UnstructWithResult(context.Background(), []Asset{NewTextAsset(doc)},
+		WithModel("test-model"),
+		WithRetrieval(nil, 1),
+		WithRetrievalChunking(ChunkByParagraphs, 12, 0),
+	)
+	require.NoError(t, err)
+
+	invoice, ok := res.Metadata.Group("total")
+	require.True(t, ok)
+	assert.Equal(t, "invoice", invoice.Prompt)
+	assert.Equal(t, []string{"0:1"}, invoice.ChunkIDs)
+
+	signature, ok := res.Metadata.Group("signing_city")
+	require.True(t, ok)
+	assert.Equal(t, []string{"0:2"}, signature.ChunkIDs)
+
+	// Each group only saw its own chunk
+	assert.ElementsMatch(t, []string{"Invoice total amount due: 1200 EUR.", "Signed in Berlin, signing city of record."}, inv.prompts)
+
+	t.Run("retriever error", func(t *testing.T) {
+		_, err := ext.Unstruct(context.Background(), []Asset{NewTextAsset(doc)},
+			WithModel("test-model"), WithRetrieval(failingRetriever{}, 1))
+		assert.ErrorContains(t, err, "index offline")
+	})
+}
@@ -2,9 +2,12 @@ package unstruct
 
 import (
 	"crypto/md5"
+	"encoding"
+	"encoding/json"
 	"fmt"
 	"log/slog"
 	"reflect"
+	"slices"
 	"sort"
 	"strings"
 	"time"
@@ -35,6 +38,7 @@ func hashParameters(params map[string]string) string {
 
 type promptKey struct {
 	prompt     string // explicit label or ""
+	group      string // named group, which may set retries and a timeout
 	parentPath string // dotted path w/o the leaf field
 	model      string // model name for this group
 	paramsHash string // hash of parameters for grouping
@@ -50,6 +54,9 @@ type fieldSpec struct {
 	model      string            // may be ""
 	parameters map[string]string // query parameters for this field
 	index      []int             // reflect path
+	typ        reflect.Type      // Go type of the field
+	hints      FieldHint         // description, format, unit, allowed values and example for prompts
+	sources    map[string]string // where each setting came from, see FieldConfig.Sources
 }
 
 type schema struct {
@@ -74,81 +81,57 @@ func schemaOfWithOptions[T any](opts *Options, log *slog.Logger) (*schema, error
 		group2specs: map[promptKey]promptGroup{},
 		json2field:  map[string]fieldSpec{},
 	}
-	// TODO: refactor
-	var walk func(t reflect.Type, parent, inheritedPrompt, inheritedModel string, inheritedParameters map[string]string, idx []int)
-	walk = func(t reflect.Type, parent, inheritedPrompt, inheritedModel string, inheritedParameters map[string]string, idx []int) {
-		for i := 0; i < t.NumField(); i++ {
-			f := t.Field(i)
-			if f.Anonymous || !f.IsExported() {
-				continue
-			}
-			jsonKey := strings.Split(f.Tag.Get("json"), ",")[0]
-			if jsonKey == "-" {
-				continue
-			}
-			if jsonKey == "" {
-				jsonKey = f.Name
-			}
-			fullKey := joinKey(parent, jsonKey)
-			tp := parseUnstructTag(f.Tag.Get("unstruct"), inheritedPrompt, log)
-
-			// Resolve group references
-			prompt := tp.prompt
-			model := tp.model
-			parameters := tp.parameters
+	overridden := map[string]bool{}
+	var walk func(t reflect.Type, parent string, inh inherited, idx []int)
+	walk = func(t reflect.Type, parent string, inh inherited, idx []int) {
+		for _, sf := range jsonFields(t) {
+			f := sf.StructField
+			fullKey := joinKey(parent, sf.key)
+			tp := parseUnstructTag(f.Tag.Get("unstruct"), "", log)
 
-			// Inherit parameters if none specified in tag
-			if len(parameters) == 0 && len(inheritedParameters) > 0 {
-				parameters = inheritedParameters
+			hints, parameters := parseFieldHints(f.Tag, tp.parameters)
+			if opts != nil {
+				hints = hints.merge(opts.FieldHints[fullKey])
 			}
 
-			if strings.HasPrefix(tp.prompt, "group:") {
-				groupName := strings.TrimPrefix(tp.prompt, "group:")
-				if opts != nil && opts.Groups != nil {
-					if groupDef, exists := opts.Groups[groupName]; exists {
-						prompt = groupDef.Prompt
-						model = groupDef.Model
-						// Group parameters could be merged here if needed
-					}
-				}
+			// Config, then field tag, then group, then parent; Options apply at call time.
+			// Tags of embedded structs apply to their promoted fields like a parent's.
+			cfg := inh
+			for _, e := range sf.embedded {
+				etp := parseUnstructTag(e.Tag.Get("unstruct"), "", log)
+				_, eparams := parseFieldHints(e.Tag, etp.parameters)
+				cfg = cfg.child()
+				cfg.apply(etp, eparams, SourceTag, opts)
 			}
-
-			// Inherit model if not specified in the tag and not from group
-			if model == "" {
-				model = inheritedModel
+			cfg = cfg.child()
+			cfg.apply(tp, parameters, SourceTag, opts)
+			for _, key := range opts.overrideKeys(sf.owner, f, fullKey) {
+				override := opts.FieldOverrides[key]
+				cfg.apply(override.tagParts(), override.Parameters, SourceConfig, opts)
+				hints = hints.merge(override.FieldHint)
+				overridden[key] = true
 			}
 
 			// Check for field-specific model override from Options
-			if opts != nil && opts.FieldModels != nil {
-				typeName := t.Name()
-				fieldKey := typeName + "." + f.Name
-				if fieldModel, exists := opts.FieldModels[fieldKey]; exists {
-					model = fieldModel
-				}
+			if fieldModel, exists := opts.fieldModel(sf.owner, f); exists {
+				cfg.model = fieldModel
+				cfg.sources["model"] = SourceOptions
 			}
 
-			nextIdx := append(idx, i)
-			if isPureStruct(f.Type) {
-				// Make the intermediate node addressable during patching
-				s.json2field[fullKey] = fieldSpec{
-					jsonKey:    fullKey,
-					model:      model,
-					parameters: parameters,
-					index:      nextIdx,
-				}
-				walk(f.Type, fullKey, prompt, model, parameters, nextIdx)
-				continue
+			spec := fieldSpec{
+				jsonKey:    fullKey,
+				model:      cfg.model,
+				parameters: cfg.parameters,
+				index:      append(slices.Clone(idx), f.Index...),
+				typ:        f.Type,
+				hints:      hints,
+				sources:    cfg.sources,
 			}
-
-			// Handle slices of structs
-			if f.Type.Kind() == reflect.Slice && isPureStruct(f.Type.Elem()) {
-				s.json2field[fullKey] = fieldSpec{
-					jsonKey:    fullKey,
-					model:      model,
-					parameters: parameters,
-					index:      nextIdx,
-				}
-				walk(f.Type.Elem(), fullKey, prompt, model, parameters, nextIdx)
+			// Descend into structs, also behind pointers and in slices, arrays and
+			// maps; the intermediate node stays addressable during patching
+			if st := nestedStruct(f.Type); st != nil {
+				s.json2field[fullKey] = spec
+				walk(st, fullKey, cfg, spec.index)
 				continue
 			}
 
@@ -159,25 +142,25 @@ func schemaOfWithOptions[T any](opts *Options, log *slog.Logger) (*schema, error
 			}
 
 			pk := promptKey{
-				prompt:     prompt,
+				prompt:     cfg.prompt,
+				group:      cfg.group,
 				parentPath: parentPathForGrouping,
-				model:      model,
-				paramsHash: hashParameters(parameters),
+				model:      cfg.model,
+				paramsHash: hashParameters(cfg.parameters),
 			}
 			s.group2keys[pk] = append(s.group2keys[pk], fullKey)
 			s.group2specs[pk] = promptGroup{
 				promptKey:  pk,
-				parameters: parameters,
-			}
-			s.json2field[fullKey] = fieldSpec{
-				jsonKey:    fullKey,
-				model:      model,
-				parameters: parameters,
-				index:      nextIdx,
+				parameters: cfg.parameters,
 			}
+			s.json2field[fullKey] = spec
 		}
 	}
-	walk(rt, "", "", "", nil, nil)
+	walk(rt, "", inherited{}, nil)
+
+	if err := unknownOverrides(opts, overridden, rt); err != nil {
+		return nil, err
+	}
 	return s, nil
 }
 
@@ -190,5 +173,154 @@ func joinKey(parent, child string) string {
 }
 
 func isPureStruct(t reflect.Type) bool {
-	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+	return t.Kind() == reflect.Struct && !isLeafType(t)
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// isLeafType reports whether values of t are decoded as a whole, like time.Time,
+// big.Rat or json.RawMessage, rather than field by field
+func isLeafType(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+	p := reflect.PointerTo(t)
+	return p.Implements(jsonUnmarshalerType) || p.Implements(textUnmarshalerType)
+}
+
+// nestedStruct returns the struct whose fields a field of type t is extracted
+// through: t itself or the element of a pointer, slice, array or map. It returns
+// nil for leaves.
+func nestedStruct(t reflect.Type) reflect.Type {
+	t = derefType(t)
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array, reflect.Map:
+		if isLeafType(t) {
+			return nil
+		}
+		t = derefType(t.Elem())
+	}
+	if isPureStruct(t) {
+		return t
+	}
+	return nil
+}
+
+// derefType strips pointers from t
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	return t
+}
+
+// structField is a field of a struct as encoding/json sees it
+type structField struct {
+	reflect.StructField                       // Index is the path from the walked struct
+	key                 string                // JSON key
+	owner               reflect.Type          // struct type that declares the field
+	embedded            []reflect.StructField // embedded fields it is promoted through, outermost first
+}
+
+// jsonFields lists the fields of t that encoding/json encodes, in index order.
+// Fields of embedded structs without a JSON name are promoted into t; when several
+// fields share a key, the shallowest wins, then the only one with a JSON name,
+// and otherwise all of them are dropped.
+func jsonFields(t reflect.Type) []structField {
+	type embedding struct {
+		typ      reflect.Type
+		index    []int
+		embedded []reflect.StructField
+	}
+	type candidate struct {
+		structField
+		depth  int
+		tagged bool
+	}
+
+	var candidates []candidate
+	visited := map[reflect.Type]bool{}
+	next := []embedding{{typ: t}}
+	for depth := 0; len(next) > 0; depth++ {
+		current := next
+		next = nil
+		// A type embedded twice at the same depth is walked twice so that its
+		// fields conflict, but never again deeper, which also stops cycles
+		seen := map[reflect.Type]bool{}
+		for _, e := range current {
+			if visited[e.typ] {
+				continue
+			}
+			seen[e.typ] = true
+
+			for i := 0; i < e.typ.NumField(); i++ {
+				f := e.typ.Field(i)
+				ft := f.Type
+				if ft.Name() == "" && ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if f.Anonymous {
+					if !f.IsExported() && ft.Kind() != reflect.Struct {
+						continue
+					}
+				} else if !f.IsExported() {
+					continue
+				}
+				tag := f.Tag.Get("json")
+				if tag == "-" {
+					continue
+				}
+				name := strings.Split(tag, ",")[0]
+				index := append(slices.Clone(e.index), i)
+
+				if name == "" && f.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, embedding{typ: ft, index: index, embedded: append(slices.Clone(e.embedded), f)})
+					continue
+				}
+				tagged := name != ""
+				if !tagged {
+					name = f.Name
+				}
+				f.Index = index
+				candidates = append(candidates, candidate{
+					structField: structField{StructField: f, key: name, owner: e.typ, embedded: e.embedded},
+					depth:       depth,
+					tagged:      tagged,
+				})
+			}
+		}
+		for typ := range seen {
+			visited[typ] = true
+		}
+	}
+
+	byKey := map[string][]candidate{}
+	for _, c := range candidates {
+		byKey[c.key] = append(byKey[c.key], c)
+	}
+	var out []structField
+	for _, group := range byKey {
+		// Only the shallowest fields compete; candidates are in depth order
+		var shallowest, tagged []candidate
+		for _, c := range group {
+			if c.depth != group[0].depth {
+				break
+			}
+			shallowest = append(shallowest, c)
+			if c.tagged {
+				tagged = append(tagged, c)
+			}
+		}
+		switch {
+		case len(shallowest) == 1:
+			out = append(out, shallowest[0].structField)
+		case len(tagged) == 1:
+			out = append(out, tagged[0].structField)
+		}
+	}
+	slices.SortFunc(out, func(a, b structField) int { return slices.Compare(a.Index, b.Index) })
+	return out
 }
@@ -1,7 +1,11 @@
 package unstruct
 
 import (
+	"encoding/json"
+	"maps"
+	"math/big"
 	"reflect"
+	"slices"
 	"testing"
 	"time"
 
@@ -283,6 +287,7 @@ func TestIsPureStruct(t *testing.T) {
 		{reflect.TypeOf(SimpleStruct{}), true},
 		{reflect.TypeOf(UserInfo{}), true},
 		{reflect.TypeOf(time.Time{}), false}, // time.Time is special
+		{reflect.TypeOf(big.Rat{}), false},   // decodes itself
 		{reflect.TypeOf("string"), false},
 		{reflect.TypeOf(42), false},
 		{reflect.TypeOf([]string{}), false},
@@ -755,7 +760,7 @@ func TestNestedStructFieldMappingFix(t *testing.T) {
 		require.NoError(t, err)
 
 		var result AerialsStruct
-		err = patchStruct(&result, []byte(nestedJSON), sch.json2field)
+		err = patchStruct(&result, []byte(nestedJSON), sch.json2field, nil)
 		require.NoError(t, err)
 
 		// Check if nested fields are populated (should be fixed now)
@@ -768,3 +773,236 @@ func TestNestedStructFieldMappingFix(t *testing.T) {
 		t.Logf("Final Result: %+v", result)
 	})
 }
+
+type embeddedAudit struct {
+	CreatedBy string `json:"createdBy"`
+	Version   int    `json:"version" unstruct:"prompt/meta"`
+}
+
+type EmbeddedAddress struct {
+	Street string `json:"street"`
+	City   string `json:"city"`
+}
+
+type embeddedName string
+
+type embeddedCustomer struct {
+	embeddedAudit    `unstruct:"prompt/audit"`
+	*EmbeddedAddress `unstruct:"prompt/address/model/gemini-1.5-pro"`
+	embeddedName
+	Name      string          `json:"name" unstruct:"prompt/basic"`
+	Billing   EmbeddedAddress `json:"billing" unstruct:"prompt/billing"`
+	Shipping  EmbeddedAddress `unstruct:"prompt/shipping"`
+	Conflicts embeddedConflicts
+}
+
+type embeddedLeft struct {
+	Label string `json:"Label"`
+	Kind  string
+}
+
+type embeddedRight struct {
+	Label string
+	Kind  string
+	Depth embeddedDeep
+}
+
+type embeddedDeep struct {
+	Note string
+}
+
+type embeddedConflicts struct {
+	embeddedLeft    // Label is tagged here only, so it wins; Kind conflicts and is dropped
+	embeddedRight   // Depth is named, so its Note is not promoted
+	Note            string
+	EmbeddedAddress `json:"address"` // a JSON name keeps it nested
+}
+
+func TestJSONFields_Embedded(t *testing.T) {
+	keys := func(t reflect.Type) []string {
+		var out []string
+		for _, f := range jsonFields(t) {
+			out = append(out, f.key)
+		}
+		return out
+	}
+
+	assert.Equal(t, []string{"createdBy", "version", "street", "city", "name", "billing", "Shipping", "Conflicts"},
+		keys(reflect.TypeOf(embeddedCustomer{})), "unexported non-struct embeddings are skipped like in encoding/json")
+	assert.Equal(t, []string{"Label", "Depth", "Note", "address"}, keys(reflect.TypeOf(embeddedConflicts{})))
+
+	// Same keys as encoding/json
+	b, err := json.Marshal(embeddedConflicts{})
+	require.NoError(t, err)
+	var encoded map[string]any
+	require.NoError(t, json.Unmarshal(b, &encoded))
+	assert.ElementsMatch(t, keys(reflect.TypeOf(embeddedConflicts{})), slices.Collect(maps.Keys(encoded)))
+
+	fields := jsonFields(reflect.TypeOf(embeddedCustomer{}))
+	city := fields[3]
+	assert.Equal(t, []int{1, 1}, city.Index)
+	assert.Equal(t, reflect.TypeOf(EmbeddedAddress{}), city.owner)
+	require.Len(t, city.embedded, 1)
+	assert.Equal(t, "EmbeddedAddress", city.embedded[0].Name)
+}
+
+func TestSchemaOf_EmbeddedStructs(t *testing.T) {
+	configs, err := ResolveFieldConfigs[embeddedCustomer](
+		WithModelFor("gemini-2.0-flash", EmbeddedAddress{}, "City"),
+	)
+	require.NoError(t, err)
+	byKey := map[string]FieldConfig{}
+	for _, c := range configs {
+		byKey[c.Key] = c
+	}
+
+	// Embedded tags are inherited; the field's own tag wins
+	assert.Equal(t, "audit", byKey["createdBy"].Prompt)
+	assert.Equal(t, SourceParent, byKey["createdBy"].Sources["prompt"])
+	assert.Equal(t, "meta", byKey["version"].Prompt)
+	assert.Equal(t, "address", byKey["street"].Prompt)
+	assert.Equal(t, "gemini-1.5-pro", byKey["street"].Model)
+
+	// Options address promoted fields by their declaring type, and also reach
+	// the same type used as a named field
+	assert.Equal(t, "gemini-2.0-flash", byKey["city"].Model)
+	assert.Equal(t, "gemini-2.0-flash", byKey["billing.city"].Model)
+	assert.Equal(t, "billing", byKey["billing.street"].Prompt)
+	assert.Contains(t, byKey, "Conflicts.Label")
+	assert.Contains(t, byKey, "Conflicts.address.city")
+	assert.NotContains(t, byKey, "Conflicts.Kind")
+
+	sch, err := schemaOf[embeddedCustomer]()
+	require.NoError(t, err)
+	var result embeddedCustomer
+	err = patchStruct(&result, []byte(`{
+		"createdBy": "ops", "version": 3, "street": "Main St 1", "city": "Riga",
+		"name": "ACME", "billing": {"city": "Tallinn"},
+		"Conflicts": {"Label": "c-1", "Kind": "x", "Note": "top", "address": {"city": "Vilnius"}}
+	}`), sch.json2field, nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, "ops", result.CreatedBy)
+	assert.Equal(t, 3, result.Version)
+	require.NotNil(t, result.EmbeddedAddress, "nil embedded pointers are allocated")
+	assert.Equal(t, EmbeddedAddress{Street: "Main St 1", City: "Riga"}, *result.EmbeddedAddress)
+	assert.Equal(t, "ACME", result.Name)
+	assert.Equal(t, "Tallinn", result.Billing.City)
+	assert.Equal(t, "c-1", result.Conflicts.embeddedLeft.Label)
+	assert.Empty(t, result.Conflicts.embeddedRight.Label)
+	assert.Empty(t, result.Conflicts.embeddedLeft.Kind)
+	assert.Equal(t, "top", result.Conflicts.Note)
+	assert.Equal(t, "Vilnius", result.Conflicts.EmbeddedAddress.City)
+}
+
+type embeddedPrivate struct {
+	Code string `json:"code" unstruct:"prompt/basic"`
+}
+
+func TestPatchStruct_UnexportedEmbeddedPointer(t *testing.T) {
+	type withPrivate struct {
+		*embeddedPrivate
+		Name string `json:"name" unstruct:"prompt/basic"`
+	}
+	sch, err := schemaOf[withPrivate]()
+	require.NoError(t, err)
+	require.Contains(t, sch.json2field, "code")
+
+	// encoding/json cannot set such pointers either, so the field is skipped
+	var result withPrivate
+	require.NoError(t, patchStruct(&result, []byte(`{"code": "X", "name": "ACME"}`), sch.json2field, nil))
+	assert.Nil(t, result.embeddedPrivate)
+	assert.Equal(t, "ACME", result.Name)
+}
+
+type pointerItem struct {
+	SKU string  `json:"sku"`
+	Qty float64 `json:"qty"`
+}
+
+type pointerMoney struct {
+	Amount   float64 `json:"amount"`
+	Currency string  `json:"currency"`
+}
+
+type pointerOrder struct {
+	Billing  *EmbeddedAddress        `json:"billing" unstruct:"prompt/address"`
+	Shipping *EmbeddedAddress        `json:"shipping" unstruct:"prompt/address"`
+	Items    []*pointerItem          `json:"items" unstruct:"prompt/items"`
+	Prices   map[string]pointerMoney `json:"prices" unstruct:"prompt/prices"`
+	Due      *time.Time              `json:"due" unstruct:"prompt/basic"`
+	Ratio    big.Rat                 `json:"ratio" unstruct:"prompt/basic"`
+	Raw      json.RawMessage         `json:"raw" unstruct:"prompt/basic"`
+	Extra    any                     `json:"extra" unstruct:"prompt/basic"`
+}
+
+func TestSchemaOf_PointersMapsAndLeaves(t *testing.T) {
+	sch, err := schemaOf[pointerOrder]()
+	require.NoError(t, err)
+
+	requested := map[string][]string{}
+	for pk, keys := range sch.group2keys {
+		requested[pk.prompt] = append(requested[pk.prompt], keys...)
+	}
+	for _, keys := range requested {
+		slices.Sort(keys)
+	}
+	assert.Equal(t, map[string][]string{
+		"address": {"billing.city", "billing.street", "shipping.city", "shipping.street"},
+		"items":   {"items.qty", "items.sku"},
+		"prices":  {"prices.amount", "prices.currency"},
+		"basic":   {"due", "extra", "ratio", "raw"},
+	}, requested)
+	for _, node := range []string{"billing", "items", "prices"} {
+		assert.Contains(t, sch.json2field, node, "nodes are patched as a whole")
+	}
+
+	var order pointerOrder
+	err = patchStruct(&order, []byte(`{
+		"billing": {"city": "Riga"},
+		"items": [{"sku": "A-1", "qty": 2}, {"sku": "B-2", "qty": 1}],
+		"prices": {"list": {"amount": 9.5, "currency": "EUR"}, "net": {"amount": 8}},
+		"due": "2024-05-01T00:00:00Z",
+		"ratio": "1/3",
+		"raw": {"any": [1, 2]},
+		"extra": "note"
+	}`), sch.json2field, nil)
+	require.NoError(t, err)
+
+	require.NotNil(t, order.Billing)
+	assert.Equal(t, "Riga", order.Billing.City)
+	assert.Nil(t, order.Shipping, "pointers stay nil without data")
+	assert.Equal(t, []*pointerItem{{SKU: "A-1", Qty: 2}, {SKU: "B-2", Qty: 1}}, order.Items)
+	assert.Equal(t, map[string]pointerMoney{
+		"list": {Amount: 9.5, Currency: "EUR"},
+		"net":  {Amount: 8},
+	}, order.Prices)
+	require.NotNil(t, order.Due)
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), *order.Due)
+	assert.Equal(t, "1/3", order.Ratio.String())
+	assert.JSONEq(t, `{"any": [1, 2]}`, string(order.Raw))
+	assert.Equal(t, "note", order.Extra)
+}
+
+func TestNestedStruct(t *testing.T) {
+	address := reflect.TypeOf(EmbeddedAddress{})
+	for _, tc := range []struct {
+		v    any
+		want reflect.Type
+	}{
+		{EmbeddedAddress{}, address},
+		{&EmbeddedAddress{}, address},
+		{[]*EmbeddedAddress{}, address},
+		{[2]EmbeddedAddress{}, address},
+		{map[string]*EmbeddedAddress{}, address},
+		{time.Time{}, nil},
+		{&time.Time{}, nil},
+		{[]time.Time{}, nil},
+		{big.Rat{}, nil},
+		{json.RawMessage{}, nil},
+		{map[string]int{}, nil},
+		{"", nil},
+	} {
+		assert.Equal(t, tc.want, nestedStruct(reflect.TypeOf(tc.v)), "%T", tc.v)
+	}
+}
@@ -0,0 +1,256 @@
+package unstruct
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"strings"
+	"sync"
+	"text/template"
+)
+
+// TextTemplatePromptProvider renders prompts with Go's text/template. Templates
+// see the same variables as StickPromptProvider templates: .Keys, .KeyList,
+// .Fields, .Document, .Assets, .Examples, .Tag, .Version and custom variables. .Keys
+// prints as a comma-separated list and can be ranged over; see PromptContext for
+// how its keys differ from those of .Fields for slices and maps. Helper functions:
+//
+//	json     JSON-encodes a value: {{json .Keys}}
+//	join     joins a list: {{join .Keys ", "}}
+//	truncate cuts text to about n tokens: {{truncate .Document 500}}
+//	describe looks up a field description: {{describe "invoice.total"}}
+//
+// describe reads the description hint of the rendered field first, so
+// WithFieldHints and desc tags apply, and falls back to WithFieldDescriptions.
+//
+// It is safe for concurrent use.
+type TextTemplatePromptProvider struct {
+	mu           sync.RWMutex
+	templates    map[string]string // sources by template key; options write here before compile
+	index        templateIndex[*template.Template]
+	vars         map[string]any
+	descriptions map[string]string
+}
+
+// TextTemplateOption configures a TextTemplatePromptProvider
+type TextTemplateOption func(*TextTemplatePromptProvider) error
+
+// WithTextTemplateFS loads every *.tmpl file under dir in the supplied FS.
+// Versions follow the WithFS conventions: invoice@v3.tmpl or v3/invoice.tmpl.
+func WithTextTemplateFS(fsys fs.FS, dir string) TextTemplateOption {
+	return func(p *TextTemplatePromptProvider) error {
+		templates, err := loadTemplates(fsys, dir, ".tmpl")
+		if err != nil {
+			return err
+		}
+		for k, v := range templates {
+			p.templates[k] = v
+		}
+		return nil
+	}
+}
+
+// WithTextTemplates adds in-memory templates keyed by tag, e.g. "invoice" or "invoice@v2"
+func WithTextTemplates(m map[string]string) TextTemplateOption {
+	return func(p *TextTemplatePromptProvider) error {
+		for k, v := range m {
+			p.templates[templateKey(splitPromptVersion(k))] = v
+		}
+		return nil
+	}
+}
+
+// WithTextTemplateVar adds a variable that will be available in all templates
+func WithTextTemplateVar(key string, value any) TextTemplateOption {
+	return func(p *TextTemplatePromptProvider) error {
+		p.vars[key] = value
+		return nil
+	}
+}
+
+// WithFieldDescriptions sets fallback descriptions for the describe helper, keyed
+// by JSON key. Hints on the rendered fields take precedence.
+func WithFieldDescriptions(descriptions map[string]string) TextTemplateOption {
+	return func(p *TextTemplatePromptProvider) error {
+		for k, v := range descriptions {
+			p.descriptions[k] = v
+		}
+		return nil
+	}
+}
+
+// NewTextTemplatePromptProvider builds a provider and parses every template.
+// Templates that fail to parse or render are reported here.
+func NewTextTemplatePromptProvider(opts ...TextTemplateOption) (*TextTemplatePromptProvider, error) {
+	p := &TextTemplatePromptProvider{
+		templates:    make(map[string]string),
+		index:        make(templateIndex[*template.Template]),
+		vars:         make(map[string]any),
+		descriptions: make(map[string]string),
+	}
+	for _, opt := range opts {
+		if err := opt(p); err != nil {
+			return nil, err
+		}
+	}
+	for key, src := range p.templates {
+		name, version := splitPromptVersion(key)
+		tpl, err := p.parse(key, src)
+		if err != nil {
+			return nil, err
+		}
+		p.index = p.index.with(name, version, tpl)
+	}
+	return p, nil
+}
+
+// AddTemplate parses and then updates or inserts one template. A tag such as
+// "invoice@v3" stores version 3 of invoice.
+func (p *TextTemplatePromptProvider) AddTemplate(tag, src string) error {
+	name, version := splitPromptVersion(tag)
+	tpl, err := p.parse(tag, src)
+	if err != nil {
+		return err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.index = p.index.with(name, version, tpl)
+	return nil
+}
+
+// parse compiles src and test-renders it with sample context variables
+func (p *TextTemplatePromptProvider) parse(key, src string) (*template.Template, error) {
+	tpl, err := template.New(key).Funcs(p.funcs()).Parse(src)
+	if err != nil {
+		return nil, fmt.Errorf("template %q: %w", key, err)
+	}
+	name, version := splitPromptVersion(key)
+	if version == LatestPromptVersion {
+		version = defaultPromptVersion
+	}
+	pc := samplePromptContext
+	if _, err := p.render(tpl, name, version, &pc); err != nil {
+		return nil, fmt.Errorf("template %q: %w", key, err)
+	}
+	return tpl, nil
+}
+
+// funcs returns the helper functions available to templates
+func (p *TextTemplatePromptProvider) funcs() template.FuncMap {
+	return template.FuncMap{
+		"json": func(v any) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join": func(list []string, sep string) string {
+			return strings.Join(list, sep)
+		},
+		"truncate": truncateTokens,
+		"describe": p.describer(nil),
+	}
+}
+
+// describer returns the describe helper for a render of pc. A key matches a
+// field by its entry in Keys or by its own described key.
+func (p *TextTemplatePromptProvider) describer(pc *PromptContext) func(string) string {
+	return func(key string) string {
+		if pc != nil {
+			for i, f := range pc.Fields {
+				if f.Description != "" && (f.Key == key || i < len(pc.Keys) && pc.Keys[i] == key) {
+					return f.Description
+				}
+			}
+		}
+		return p.descriptions[key]
+	}
+}
+
+// truncateTokens cuts text to about n tokens, at a word boundary when possible
+func truncateTokens(text string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	if EstimateTokensFromText(text) <= n {
+		return text
+	}
+	return chunkByTokens(text, n, 0)[0]
+}
+
+// keyList prints as a comma-separated list, like {{.Keys}} in basic templates
+type keyList []string
+
+func (k keyList) String() string { return strings.Join(k, ",") }
+
+// lookup finds the parsed template for tag at version
+func (p *TextTemplatePromptProvider) lookup(tag string, version int) (*template.Template, int, error) {
+	p.mu.RLock()
+	index := p.index
+	p.mu.RUnlock()
+	return index.lookup(tag, version)
+}
+
+// ResolvePromptVersion reports which stored version GetPrompt renders for tag
+// and version
+func (p *TextTemplatePromptProvider) ResolvePromptVersion(tag string, version int) (int, error) {
+	p.mu.RLock()
+	index := p.index
+	p.mu.RUnlock()
+	return index.resolve(tag, version)
+}
+
+// GetPrompt renders the template for the given tag without document context
+func (p *TextTemplatePromptProvider) GetPrompt(tag string, version int) (string, error) {
+	tpl, version, err := p.lookup(tag, version)
+	if err != nil {
+		return "", err
+	}
+	return p.render(tpl, tag, version, nil)
+}
+
+// GetPromptWithContext renders the template with the keys and document
+func (p *TextTemplatePromptProvider) GetPromptWithContext(tag string, version int, keys []string, document string) (string, error) {
+	return p.GetPromptWithAssets(tag, version, PromptContext{Keys: keys, Document: document})
+}
+
+// GetPromptWithAssets renders the template with the full prompt context
+func (p *TextTemplatePromptProvider) GetPromptWithAssets(tag string, version int, pc PromptContext) (string, error) {
+	tpl, version, err := p.lookup(tag, version)
+	if err != nil {
+		return "", err
+	}
+	return p.render(tpl, tag, version, &pc)
+}
+
+// render executes tpl. Without a prompt context only the tag, version and custom
+// variables are set.
+func (p *TextTemplatePromptProvider) render(tpl *template.Template, tag string, version int, pc *PromptContext) (string, error) {
+	data := make(map[string]any, len(p.vars)+8)
+	data["Tag"] = tag
+	data["Version"] = version
+	if pc != nil {
+		// Bind describe to this render's fields on a copy of the template
+		clone, err := tpl.Clone()
+		if err != nil {
+			return "", fmt.Errorf("execute %q: %w", tag, err)
+		}
+		tpl = clone.Funcs(template.FuncMap{"describe": p.describer(pc)})
+		data["Keys"] = keyList(pc.Keys)
+		data["KeyList"] = strings.Join(pc.Keys, ", ")
+		data["Fields"] = pc.Fields
+		data["Document"] = pc.Document
+		data["Assets"] = pc.Assets
+		data["Examples"] = pc.Examples
+	}
+
+	// Add custom variables
+	for k, v := range p.vars {
+		data[k] = v
+	}
+
+	var out strings.Builder
+	if err := tpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("execute %q: %w", tag, err)
+	}
+	return out.String(), nil
+}
@@ -0,0 +1,100 @@
+package unstruct
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTextTemplatePromptProvider(t *testing.T) {
+	fsys := fstest.MapFS{
+		"prompts/invoice.tmpl":    {Data: []byte("Extract {{.Keys}} ({{.KeyList}}) v{{.Version}} for {{.Tag}}")},
+		"prompts/v2/invoice.tmpl": {Data: []byte(`{{range .Keys}}{{.}}: {{describe .}}{{"\n"}}{{end}}{{json .Keys}} {{join .Keys "|"}} {{.company}}`)},
+		"prompts/ignored.twig":    {Data: []byte("{% if %}")},
+	}
+	p, err := NewTextTemplatePromptProvider(
+		WithTextTemplateFS(fsys, "prompts"),
+		WithTextTemplates(map[string]string{"summary": "{{truncate .Document 3}}"}),
+		WithTextTemplateVar("company", "Acme"),
+		WithFieldDescriptions(map[string]string{"total": "Grand total incl. VAT"}),
+	)
+	require.NoError(t, err)
+
+	prompt, err := p.GetPromptWithContext("invoice", 1, []string{"total", "date"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "Extract total,date (total, date) v1 for invoice", prompt)
+
+	prompt, err = p.GetPromptWithContext("invoice", LatestPromptVersion, []string{"total", "date"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "total: Grand total incl. VAT\ndate: \n[\"total\",\"date\"] total|date Acme", prompt)
+
+	prompt, err = p.GetPromptWithContext("summary", 1, nil, "one two three four five six")
+	require.NoError(t, err)
+	assert.Equal(t, "one two", prompt)
+
+	_, err = p.GetPrompt("ignored", 1)
+	assert.ErrorContains(t, err, "not found")
+}
+
+func TestTextTemplatePromptProvider_DescribeFields(t *testing.T) {
+	p, err := NewTextTemplatePromptProvider(
+		WithTextTemplates(map[string]string{"invoice": `{{range .Keys}}{{.}}: {{describe .}}{{"\n"}}{{end}}{{describe "lines[].sku"}}`}),
+		WithFieldDescriptions(map[string]string{"total": "fallback total", "date": "Issue date"}),
+	)
+	require.NoError(t, err)
+
+	prompt, err := p.GetPromptWithAssets("invoice", LatestPromptVersion, PromptContext{
+		Keys: []string{"total", "date", "lines.sku"},
+		Fields: []PromptField{
+			{Key: "total", FieldHint: FieldHint{Description: "Grand total from hints"}},
+			{Key: "date"},
+			{Key: "lines[].sku", FieldHint: FieldHint{Description: "Article number"}},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "total: Grand total from hints\ndate: Issue date\nlines.sku: Article number\nArticle number", prompt)
+
+	// Renders without fields keep using the configured descriptions
+	prompt, err = p.GetPromptWithContext("invoice", LatestPromptVersion, []string{"total"}, "")
+	require.NoError(t, err)
+	assert.Equal(t, "total: fallback total\n", prompt)
+}
+
+func TestTextTemplatePromptProvider_Errors(t *testing.T) {
+	_, err := NewTextTemplatePromptProvider(WithTextTemplates(map[string]string{"bad": "{{.Keys"}))
+	assert.ErrorContains(t, err, `template "bad"`)
+
+	_, err = NewTextTemplatePromptProvider(WithTextTemplates(map[string]string{"bad": "{{index .Keys 5}}"}))
+	assert.ErrorContains(t, err, `template "bad"`, "templates are test-rendered at load")
+
+	p, err := NewTextTemplatePromptProvider()
+	require.NoError(t, err)
+	assert.Error(t, p.AddTemplate("bad", "{{end}}"))
+	require.NoError(t, p.AddTemplate("good@v2", "v{{.Version}}"))
+	prompt, err := p.GetPrompt("good", LatestPromptVersion)
+	require.NoError(t, err)
+	assert.Equal(t, "v2", prompt)
+}
+
+func TestUnstruct_TextTemplateKeys(t *testing.T) {
+	type doc struct {
+		Total string `json:"total" unstruct:"invoice"`
+		Date  string `json:"date" unstruct:"invoice"`
+	}
+	p, err := NewTextTemplatePromptProvider(WithTextTemplates(map[string]string{
+		"invoice": "Extract {{.Keys}} from:\n{{.Document}}",
+	}))
+	require.NoError(t, err)
+	inv := &chunkInvoker{}
+	ext := &Unstructor[doc]{invoker: inv, prompts: p, log: slog.Default()}
+
+	_, err = ext.Unstruct(context.Background(), []Asset{NewTextAsset("Total: 5")}, WithModel("test-model"))
+	require.NoError(t, err)
+	require.Len(t, inv.prompts, 1)
+	assert.True(t, strings.HasPrefix(inv.prompts[0], "Extract total,date from:\nTotal: 5"))
+}
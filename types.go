@@ -26,35 +26,72 @@ type ContextualPromptProvider interface {
 	GetPromptWithContext(tag string, version int, keys []string, document string) (string, error)
 }
 
+// AssetAwarePromptProvider extends ContextualPromptProvider for templates that
+// work with several assets. It receives every asset routed to the prompt group,
+// in order, along with the concatenated document.
+type AssetAwarePromptProvider interface {
+	ContextualPromptProvider
+	GetPromptWithAssets(tag string, version int, pc PromptContext) (string, error)
+}
+
 // Invoker abstraction allows mocking, retrying, and caching
 type Invoker interface {
 	Generate(ctx context.Context, model Model, prompt string, media []*Part) ([]byte, error)
 }
 
+// ConversationInvoker extends Invoker for calls that need message roles, such as
+// generation parameters or few-shot example turns.
+type ConversationInvoker interface {
+	Invoker
+	GenerateMessages(ctx context.Context, model Model, messages []*Message, parameters map[string]string) ([]byte, error)
+}
+
 // FieldModelMap represents model overrides for specific type and field combinations
 type FieldModelMap map[string]string // key: "TypeName.FieldName", value: model name
 
-// GroupDefinition represents a named group configuration with prompt and model
+// GroupDefinition represents a named group configuration. Fields that reference
+// the group with unstruct:"group/name" use its settings unless their own tag
+// overrides them; see ResolveFieldConfigs for the precedence rules.
 type GroupDefinition struct {
-	Name   string
-	Prompt string
-	Model  string
+	Name       string
+	Prompt     string
+	Model      string
+	Parameters map[string]string // generation parameters, e.g. temperature; tag parameters win per key
+	Assets     []string          // asset labels the group receives, like ?assets=
+	MaxRetries int               // 0 → Options.MaxRetries
+	Backoff    time.Duration     // 0 → Options.Backoff
+	Timeout    time.Duration     // limit for each model call of the group, retries included; 0 → none
 }
 
 // Options represents functional options for extraction
 type Options struct {
 	Model            string
 	Timeout          time.Duration
-	Runner           Runner                     // nil → DefaultRunner
-	OutputSchemaJSON string                     // optional JSON-Schema
-	Streaming        bool                       // opt-in
-	MaxRetries       int                        // 0 → no retry
-	Backoff          time.Duration              // backoff duration for retries
-	CustomParser     func([]byte) (any, error)  // override JSON→struct
-	FallbackPrompt   string                     // used when tag.prompt == ""
-	FieldModels      FieldModelMap              // per-field model overrides
-	FlattenGroups    bool                       // if true, ignore parent paths when grouping by prompt+model
-	Groups           map[string]GroupDefinition // named group definitions
+	Runner           Runner                         // nil → DefaultRunner
+	OutputSchemaJSON string                         // optional JSON-Schema
+	Streaming        bool                           // opt-in
+	MaxRetries       int                            // 0 → no retry
+	Backoff          time.Duration                  // backoff duration for retries
+	CustomParser     func([]byte) (any, error)      // override JSON→struct
+	FallbackPrompt   string                         // used when tag.prompt == ""
+	FieldModels      FieldModelMap                  // per-field model overrides
+	FlattenGroups    bool                           // if true, ignore parent paths when grouping by prompt+model
+	Groups           map[string]GroupDefinition     // named group definitions
+	PromptAssets     map[string][]string            // prompt label → asset labels it receives
+	Chunking         *ChunkingOptions               // nil → documents are sent whole
+	Retrieval        *RetrievalOptions              // nil → every group sees the whole document
+	Examples         *ExampleOptions                // nil → no few-shot examples
+	PromptVersion    int                            // template version for every prompt; 0 → latest
+	PromptVersions   map[string]int                 // prompt label → pinned template version
+	Experiments      map[string][]ExperimentVariant // prompt label → variants traffic is split between
+	DocumentID       string                         // experiment assignment key; "" → hash of the document text
+	FieldHints       map[string]FieldHint           // JSON key → hints applied over the field's tags
+	FieldOverrides   map[string]FieldOverride       // JSON path or Type.Field → settings that win over the tag
+	Converters       map[reflect.Type]Converter     // field type → converter used instead of the built-in coercion
+	DateLayouts      []string                       // time layouts tried before DateLayouts
+	RequirePrompts   bool                           // Validate reports fields left to the generated prompt
+
+	attemptTimeout time.Duration // limit of each model call, set from a named group
 }
 
 // Functional option constructors
@@ -104,6 +141,13 @@ func WithFallbackPrompt(prompt string) func(*Options) {
 	return func(o *Options) { o.FallbackPrompt = prompt }
 }
 
+// WithRequirePrompts makes Validate report fields that have neither a prompt
+// nor a fallback, for teams that want every group served by a template.
+// Extraction itself generates a prompt for them.
+func WithRequirePrompts() func(*Options) {
+	return func(o *Options) { o.RequirePrompts = true }
+}
+
 // WithModelFor sets a specific model for a particular field of a given type
 // Usage: WithModelFor("gemini-1.5-pro", SomeType{}, "FieldName")
 func WithModelFor(model string, typ any, fieldName string) func(*Options) {
@@ -124,18 +168,159 @@ func WithFlattenGroups() func(*Options) {
 	return func(o *Options) { o.FlattenGroups = true }
 }
 
+// WithAssetsFor routes only the assets labelled with one of labels to the given prompt.
+// A tag's assets query parameter, e.g. unstruct:"prompt/invoice?assets=invoice,photo",
+// takes precedence.
+func WithAssetsFor(prompt string, labels ...string) func(*Options) {
+	return func(o *Options) {
+		if o.PromptAssets == nil {
+			o.PromptAssets = make(map[string][]string)
+		}
+		o.PromptAssets[prompt] = labels
+	}
+}
+
+// WithChunking splits long text assets and runs every prompt group once per chunk.
+// overlap is in tokens for ChunkByTokens and in paragraphs or pages otherwise.
+func WithChunking(strategy ChunkStrategy, chunkTokens, overlap int) func(*Options) {
+	return func(o *Options) {
+		if o.Chunking == nil {
+			o.Chunking = &ChunkingOptions{}
+		}
+		o.Chunking.Strategy = strategy
+		o.Chunking.ChunkTokens = chunkTokens
+		o.Chunking.Overlap = overlap
+	}
+}
+
+// WithMergeRule sets how per-chunk values are combined when chunking is enabled
+func WithMergeRule(rule MergeRule) func(*Options) {
+	return func(o *Options) {
+		if o.Chunking == nil {
+			o.Chunking = &ChunkingOptions{}
+		}
+		o.Chunking.Merge = rule
+	}
+}
+
+// WithFieldMergeRule overrides the merge rule for one dotted JSON key
+func WithFieldMergeRule(key string, rule MergeRule) func(*Options) {
+	return func(o *Options) {
+		if o.Chunking == nil {
+			o.Chunking = &ChunkingOptions{}
+		}
+		if o.Chunking.FieldMerge == nil {
+			o.Chunking.FieldMerge = make(map[string]MergeRule)
+		}
+		o.Chunking.FieldMerge[key] = rule
+	}
+}
+
+// WithReconcilePrompt sets the prompt label used by MergeReconcile.
+// The template may use {{.Keys}} and {{.Candidates}}.
+func WithReconcilePrompt(label string) func(*Options) {
+	return func(o *Options) {
+		if o.Chunking == nil {
+			o.Chunking = &ChunkingOptions{}
+		}
+		o.Chunking.ReconcilePrompt = label
+	}
+}
+
+// WithRetrieval sends each prompt group only the topK document chunks most
+// relevant to its prompt and keys. A nil retriever uses BM25.
+func WithRetrieval(retriever Retriever, topK int) func(*Options) {
+	return func(o *Options) {
+		if o.Retrieval == nil {
+			o.Retrieval = &RetrievalOptions{}
+		}
+		o.Retrieval.Retriever = retriever
+		o.Retrieval.TopK = topK
+	}
+}
+
+// WithRetrievalChunking sets how documents are split before retrieval
+func WithRetrievalChunking(strategy ChunkStrategy, chunkTokens, overlap int) func(*Options) {
+	return func(o *Options) {
+		if o.Retrieval == nil {
+			o.Retrieval = &RetrievalOptions{}
+		}
+		o.Retrieval.Chunking = ChunkingOptions{Strategy: strategy, ChunkTokens: chunkTokens, Overlap: overlap}
+	}
+}
+
+// WithExamples attaches few-shot examples from library to every prompt group.
+// Each group receives the examples most similar to its document that fit into
+// tokenBudget tokens (0 → DefaultExampleTokenBudget).
+func WithExamples(library *ExampleLibrary, mode ExampleMode, tokenBudget int) func(*Options) {
+	return func(o *Options) {
+		o.Examples = &ExampleOptions{Library: library, Mode: mode, TokenBudget: tokenBudget}
+	}
+}
+
+// WithPromptVersion pins the template version used by every prompt group.
+// Versions pinned per prompt or in a tag, e.g. unstruct:"prompt/invoice@2", take precedence.
+func WithPromptVersion(version int) func(*Options) {
+	return func(o *Options) { o.PromptVersion = version }
+}
+
+// WithPromptVersionFor pins the template version used by one prompt label
+func WithPromptVersionFor(prompt string, version int) func(*Options) {
+	return func(o *Options) {
+		if o.PromptVersions == nil {
+			o.PromptVersions = make(map[string]int)
+		}
+		o.PromptVersions[prompt] = version
+	}
+}
+
+// WithExperiment splits documents between variants of a prompt by weight.
+// Assignment is deterministic per document, see WithDocumentID, and the chosen
+// variant is recorded in GroupResult.Variant.
+func WithExperiment(prompt string, variants ...ExperimentVariant) func(*Options) {
+	return func(o *Options) {
+		if o.Experiments == nil {
+			o.Experiments = make(map[string][]ExperimentVariant)
+		}
+		o.Experiments[prompt] = variants
+	}
+}
+
+// WithDocumentID sets the key used to assign the document to experiment variants
+func WithDocumentID(id string) func(*Options) {
+	return func(o *Options) { o.DocumentID = id }
+}
+
+// WithFieldHints describes fields by JSON key, e.g. "invoice.total". Non-empty
+// attributes override those from struct tags. Hints reach templates through
+// PromptContext.Fields, generated prompts and Explain output.
+func WithFieldHints(hints map[string]FieldHint) func(*Options) {
+	return func(o *Options) {
+		if o.FieldHints == nil {
+			o.FieldHints = make(map[string]FieldHint)
+		}
+		for k, v := range hints {
+			o.FieldHints[k] = o.FieldHints[k].merge(v)
+		}
+	}
+}
+
 // WithGroup defines a named group with a specific prompt and model
-// Usage: WithGroup("group-name", "prompt-name", "model-name")
+// Usage: WithGroup("group-name", "prompt-name", "model-name", WithGroupParameters(...))
 // Fields can then reference this group using unstruct:"group/group-name"
-func WithGroup(name, prompt, model string) func(*Options) {
+func WithGroup(name, prompt, model string, groupOpts ...GroupOption) func(*Options) {
 	return func(o *Options) {
 		if o.Groups == nil {
 			o.Groups = make(map[string]GroupDefinition)
 		}
-		o.Groups[name] = GroupDefinition{
+		def := GroupDefinition{
 			Name:   name,
 			Prompt: prompt,
 			Model:  model,
 		}
+		for _, opt := range groupOpts {
+			opt(&def)
+		}
+		o.Groups[name] = def
 	}
 }
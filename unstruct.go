@@ -7,6 +7,7 @@ import (
 	"errors"
 	"fmt"
 	"log/slog"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -20,6 +21,14 @@ var ErrEmptyAssets = errors.New("no assets provided")
 var ErrModelMissing = errors.New("model not specified")
 var ErrMissingSchema = errors.New("schema is required")
 
+// Message roles understood by GenerateBytes
+const (
+	RoleUser      = "user"
+	RoleSystem    = "system"    // sent as the system instruction
+	RoleModel     = "model"     // earlier model turn, e.g. a few-shot answer
+	RoleAssistant = "assistant" // alias for RoleModel
+)
+
 // Message represents a message in a conversation
 type Message struct {
 	Role  string
@@ -28,12 +37,23 @@ type Message struct {
 
 // NewUserMessage creates a new user message
 func NewUserMessage(parts ...*Part) *Message {
-	return &Message{Role: "user", Parts: parts}
+	return &Message{Role: RoleUser, Parts: parts}
 }
 
 // NewSystemMessage creates a new system message
 func NewSystemMessage(parts ...*Part) *Message {
-	return &Message{Role: "system", Parts: parts}
+	return &Message{Role: RoleSystem, Parts: parts}
+}
+
+// NewModelMessage creates a model (assistant) turn
+func NewModelMessage(parts ...*Part) *Message {
+	return &Message{Role: RoleModel, Parts: parts}
+}
+
+// NewExampleTurns creates a few-shot example: a user turn with input followed
+// by the model turn answering it with output.
+func NewExampleTurns(output string, input ...*Part) []*Message {
+	return []*Message{NewUserMessage(input...), NewModelMessage(NewTextPart(output))}
 }
 
 // Unstructor provides multi-prompt extraction capabilities.
@@ -61,37 +81,9 @@ func GenerateBytes(ctx context.Context, client *genai.Client, log *slog.Logger,
 	}
 
 	// Build content from messages
-	var contents []*genai.Content
-
-	for _, msg := range cfg.Messages {
-		var parts []*genai.Part
-
-		for _, part := range msg.Parts {
-			log.Debug("Processing message part", "type", part.Type, "file_uri", part.FileURI, "mime_type", part.MimeType)
-			switch part.Type {
-			case "text":
-				// Add text part
-				parts = append(parts, genai.NewPartFromText(part.Text))
-			case "image":
-				// Add image data part using Blob
-				parts = append(parts, genai.NewPartFromBytes(part.Data, part.MimeType))
-			case "file":
-				// Add file part that references uploaded file using NewPartFromFile
-				// This creates the proper file data part that the AI model can process
-				file := genai.File{
-					URI:      part.FileURI,
-					MIMEType: part.MimeType,
-				}
-				genaiPart := genai.NewPartFromFile(file)
-				log.Debug("Created genai file part", "uri", file.URI, "mime_type", file.MIMEType)
-				parts = append(parts, genaiPart)
-			}
-		}
-
-		if len(parts) > 0 {
-			content := genai.NewContentFromParts(parts, genai.RoleUser)
-			contents = append(contents, content)
-		}
+	contents, systemInstruction, err := buildContents(cfg.Messages, log)
+	if err != nil {
+		return nil, err
 	}
 
 	// Fallback to text-only if no messages provided
@@ -100,11 +92,12 @@ func GenerateBytes(ctx context.Context, client *genai.Client, log *slog.Logger,
 		return nil, fmt.Errorf("no valid content provided")
 	}
 
-	log.Debug("Generating content", "model", modelName, "content_count", len(contents))
+	log.Debug("Generating content", "model", modelName, "content_count", len(contents), "has_system_instruction", systemInstruction != nil)
 
 	// Create generation config for JSON output
 	config := &genai.GenerateContentConfig{
-		ResponseMIMEType: "application/json",
+		ResponseMIMEType:  "application/json",
+		SystemInstruction: systemInstruction,
 	}
 
 	// Apply query parameters from tags if available
@@ -194,6 +187,59 @@ func GenerateBytes(ctx context.Context, client *genai.Client, log *slog.Logger,
 	return []byte(part.Text), nil
 }
 
+// buildContents converts messages into conversation turns. System messages are
+// merged into the returned system instruction; model and assistant turns keep
+// the model role so few-shot examples read as real conversation turns.
+func buildContents(messages []*Message, log *slog.Logger) ([]*genai.Content, *genai.Content, error) {
+	var contents []*genai.Content
+	var system *genai.Content
+
+	for _, msg := range messages {
+		var parts []*genai.Part
+
+		for _, part := range msg.Parts {
+			log.Debug("Processing message part", "role", msg.Role, "type", part.Type, "file_uri", part.FileURI, "mime_type", part.MimeType)
+			switch part.Type {
+			case "text":
+				// Add text part
+				parts = append(parts, genai.NewPartFromText(part.Text))
+			case "image":
+				// Add image data part using Blob
+				parts = append(parts, genai.NewPartFromBytes(part.Data, part.MimeType))
+			case "file":
+				// Add file part that references uploaded file using NewPartFromFile
+				// This creates the proper file data part that the AI model can process
+				file := genai.File{
+					URI:      part.FileURI,
+					MIMEType: part.MimeType,
+				}
+				genaiPart := genai.NewPartFromFile(file)
+				log.Debug("Created genai file part", "uri", file.URI, "mime_type", file.MIMEType)
+				parts = append(parts, genaiPart)
+			}
+		}
+
+		if len(parts) == 0 {
+			continue
+		}
+
+		switch msg.Role {
+		case RoleSystem:
+			if system == nil {
+				system = &genai.Content{}
+			}
+			system.Parts = append(system.Parts, parts...)
+		case RoleModel, RoleAssistant:
+			contents = append(contents, genai.NewContentFromParts(parts, genai.RoleModel))
+		case RoleUser, "":
+			contents = append(contents, genai.NewContentFromParts(parts, genai.RoleUser))
+		default:
+			return nil, nil, fmt.Errorf("unsupported message role %q", msg.Role)
+		}
+	}
+	return contents, system, nil
+}
+
 // New returns a Unstructor that logs with slog.Default().
 func New[T any](client *genai.Client, p PromptProvider) *Unstructor[T] {
 	return NewWithLogger[T](client, p, slog.Default())
@@ -213,6 +259,20 @@ func (x *Unstructor[T]) Unstruct(
 	assets []Asset,
 	optFns ...func(*Options),
 ) (*T, error) {
+	res, err := x.UnstructWithResult(ctx, assets, optFns...)
+	if err != nil {
+		return nil, err
+	}
+	return res.Value, nil
+}
+
+// UnstructWithResult runs the same flow as Unstruct and also returns metadata
+// about every executed prompt group.
+func (x *Unstructor[T]) UnstructWithResult(
+	ctx context.Context,
+	assets []Asset,
+	optFns ...func(*Options),
+) (*Result[T], error) {
 	x.log.Debug("=== UNSTRUCT STARTED ===",
 		"assets_count", len(assets),
 		"options_count", len(optFns),
@@ -223,6 +283,9 @@ func (x *Unstructor[T]) Unstruct(
 		return nil, fmt.Errorf("extract: %w", ErrEmptyAssets)
 	}
 
+	// Release uploaded files and other remote resources once extraction is done
+	defer cleanupAssets(ctx, assets, x.log)
+
 	// Log assets details
 	for i, asset := range assets {
 		x.log.Debug("Asset details",
@@ -295,11 +358,23 @@ func (x *Unstructor[T]) Unstruct(
 		return nil, fmt.Errorf("extract: %w", ErrModelMissing)
 	}
 
-	// 2. Fan-out prompt calls with improved grouping and model-specific handling.
+	// 3. Materialise assets once; every prompt group shares the same snapshot.
+	prepared, err := prepareAssets(ctx, assets, x.log)
+	if err != nil {
+		return nil, fmt.Errorf("prepare assets: %w", err)
+	}
+	if opts.DocumentID == "" && len(opts.Experiments) > 0 {
+		if opts.DocumentID, err = prepared.documentID(); err != nil {
+			return nil, fmt.Errorf("experiment: %w", err)
+		}
+	}
+
+	// 4. Fan-out prompt calls with improved grouping and model-specific handling.
 	type frag struct {
 		prompt string
 		raw    []byte
 		model  string
+		group  GroupResult
 	}
 	var (
 		mu        sync.Mutex
@@ -334,12 +409,14 @@ func (x *Unstructor[T]) Unstruct(
 					parameters = sch.json2field[keys[0]].parameters
 				}
 			}
-			raw, err := x.callPrompt(egCtx, pk.prompt, keys, assets, model, parameters, opts)
+			// Named groups may set their own retry policy and timeout
+			callOpts := groupCall(pk.group, opts)
+			raw, group, err := x.callPrompt(egCtx, pk.prompt, keys, sch.json2field, prepared, model, parameters, callOpts)
 			if err != nil {
 				return fmt.Errorf("%s: %w", pk.prompt, err)
 			}
 			mu.Lock()
-			fragments = append(fragments, frag{pk.prompt, raw, model})
+			fragments = append(fragments, frag{pk.prompt, raw, model, group})
 			mu.Unlock()
 			return nil
 		})
@@ -351,20 +428,31 @@ func (x *Unstructor[T]) Unstruct(
 	}
 	x.log.Debug("All prompt calls completed", "fragment_count", len(fragments))
 
-	// 3. Merge JSON fragments back into a single struct using new patcher.
+	// 5. Merge JSON fragments back into a single struct using new patcher.
 	var out T
+	var meta ResultMetadata
+	coerce := newCoercer(&opts)
 	x.log.Debug("Starting JSON fragment merge", "fragment_count", len(fragments))
 	for _, f := range fragments {
 		x.log.Debug("Processing fragment", "prompt", f.prompt, "raw_content", string(f.raw))
-		if err := patchStruct(&out, f.raw, sch.json2field); err != nil {
+		if err := patchStruct(&out, f.raw, sch.json2field, coerce); err != nil {
 			x.log.Debug("Merge failed", "prompt", f.prompt, "error", err)
 			return nil, fmt.Errorf("merge %q: %w", f.prompt, err)
 		}
 		x.log.Debug("Fragment merged successfully", "prompt", f.prompt)
+		meta.Groups = append(meta.Groups, f.group)
+	}
+
+	for _, e := range coerce.errs {
+		x.log.Warn("Response value not converted", "key", e.Key, "value", e.Value, "type", e.Type, "error", e.Err)
 	}
+	meta.CoercionErrors = coerce.errs
 
 	x.log.Info("Extraction completed successfully", "type", fmt.Sprintf("%T", out))
-	return &out, nil
+	sort.Slice(meta.Groups, func(i, j int) bool {
+		return meta.Groups[i].Fields[0] < meta.Groups[j].Fields[0]
+	})
+	return &Result[T]{Value: &out, Metadata: meta}, nil
 }
 
 // DynamicUnstructor is a specialized unstructor for dynamic schema extraction
@@ -476,45 +564,135 @@ func (gv *genkitInvoker) Generate(
 	)
 }
 
-// callPrompt invokes a single prompt template with a specific model and returns raw JSON bytes.
+// GenerateMessages sends a full conversation, keeping each message's role
+func (gv *genkitInvoker) GenerateMessages(
+	ctx context.Context,
+	model Model,
+	messages []*Message,
+	parameters map[string]string,
+) ([]byte, error) {
+	gv.log.Debug("Starting conversation generation", "model", string(model), "message_count", len(messages))
+
+	if gv.client == nil {
+		gv.log.Debug("Client not initialized")
+		return nil, fmt.Errorf("client not initialized")
+	}
+
+	return GenerateBytes(ctx, gv.client, gv.log,
+		WithModelName(string(model)),
+		WithMessages(messages...),
+		WithParameters(parameters),
+	)
+}
+
+// callPrompt invokes a single prompt template with a specific model and returns raw JSON bytes
+// together with a description of the executed group.
 func (x *Unstructor[T]) callPrompt(
 	ctx context.Context,
 	promptLabel string,
 	keys []string,
-	assets []Asset,
+	fields map[string]fieldSpec,
+	prepared *preparedAssets,
 	model string,
 	parameters map[string]string,
 	opts Options,
-) ([]byte, error) {
-	// label may be empty → check for fallback or error
+) ([]byte, GroupResult, error) {
+	// label may be empty → fallback prompt, or a prompt generated from the fields
 	label := promptLabel
 	if label == "" {
-		if opts.FallbackPrompt == "" {
-			return nil, fmt.Errorf("no prompt specified for fields %v and no fallback prompt provided - use WithFallbackPrompt() option", keys)
-		}
 		label = opts.FallbackPrompt
 	}
 
-	x.log.Debug("Calling prompt", "label", label, "keys", keys, "model", model)
+	var (
+		version int
+		variant string
+		err     error
+	)
+	if label != "" {
+		// Experiments may swap the template version and model for this document
+		label, model, variant, err = applyExperiment(label, model, opts)
+		if err != nil {
+			return nil, GroupResult{Prompt: label, Model: model, Fields: keys}, err
+		}
+
+		// Pick the template version: tag suffix, then per-prompt, then global option
+		label, version, err = resolvePromptVersion(x.prompts, label, opts)
+	}
+	group := GroupResult{Prompt: label, Version: version, Model: model, Variant: variant, Fields: keys}
+	if err != nil {
+		return nil, group, err
+	}
+
+	x.log.Debug("Calling prompt", "label", label, "version", version, "keys", keys, "model", model)
 
-	// Extract text content and media from assets for prompt building
-	var textContent string
-	var allMessages []*Message
+	// Route only the selected assets to this group
+	labels, parameters := assetSelection(label, parameters, opts)
+	prepared, err = prepared.selectAssets(labels, x.log)
+	if err != nil {
+		return nil, group, fmt.Errorf("%s: %w", label, err)
+	}
 
-	for _, asset := range assets {
-		messages, err := asset.CreateMessages(ctx, x.log)
+	// Send only the chunks relevant to this group
+	if opts.Retrieval != nil {
+		prepared, group.ChunkIDs, err = prepared.narrow(ctx, retrievalQuery(label, keys), opts.Retrieval)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create messages from asset: %w", err)
+			return nil, group, fmt.Errorf("%s: %w", label, err)
 		}
-		allMessages = append(allMessages, messages...)
+		x.log.Debug("Narrowed context", "label", label, "chunk_ids", group.ChunkIDs)
+	}
 
-		// Extract text content for template building (use first text part found)
-		for _, msg := range messages {
-			for _, part := range msg.Parts {
-				if part.Type == "text" && textContent == "" {
-					textContent = part.Text
-				}
+	// Long documents run once per chunk and the fragments are merged per field
+	views := prepared.chunks(opts.Chunking)
+	if len(views) == 1 {
+		raw, err := x.generateForAssets(ctx, label, version, keys, fields, views[0], model, parameters, opts)
+		return raw, group, err
+	}
+	x.log.Debug("Running prompt per chunk", "label", label, "chunks", len(views))
+	fragments := make([][]byte, 0, len(views))
+	for i, view := range views {
+		raw, err := x.generateForAssets(ctx, label, version, keys, fields, view, model, parameters, opts)
+		if err != nil {
+			return nil, group, fmt.Errorf("%s: chunk %d: %w", label, i, err)
+		}
+		fragments = append(fragments, raw)
+	}
+	raw, err := x.mergeChunkFragments(ctx, keys, model, fragments, opts)
+	return raw, group, err
+}
+
+// generateForAssets renders the prompt for label over the given assets and calls the model.
+func (x *Unstructor[T]) generateForAssets(
+	ctx context.Context,
+	label string,
+	version int,
+	keys []string,
+	fields map[string]fieldSpec,
+	prepared *preparedAssets,
+	model string,
+	parameters map[string]string,
+	opts Options,
+) ([]byte, error) {
+	// Text content and media come from the shared, already prepared assets
+	promptCtx := prepared.promptContext(keys)
+	promptCtx.Fields = promptFields(keys, fields)
+	textContent := promptCtx.Document
+	allMessages := prepared.messages()
+
+	// Few-shot examples most similar to this document
+	examples := opts.Examples.selectFor(label, keys, textContent)
+	var exampleMessages []*Message
+	if len(examples) > 0 {
+		x.log.Debug("Selected examples", "label", label, "count", len(examples), "mode", opts.Examples.Mode)
+		// Providers with GetPromptWithContext only cannot receive the variable
+		_, assetAware := x.prompts.(AssetAwarePromptProvider)
+		_, contextual := x.prompts.(ContextualPromptProvider)
+		if opts.Examples.Mode == ExamplesAsVariable && (assetAware || !contextual) {
+			promptCtx.Examples = formatExamples(examples)
+		} else {
+			if opts.Examples.Mode == ExamplesAsVariable {
+				x.log.Debug("Provider cannot take an examples variable, sending turns", "provider_type", fmt.Sprintf("%T", x.prompts))
 			}
+			exampleMessages = exampleTurns(examples)
 		}
 	}
 
@@ -529,16 +707,29 @@ func (x *Unstructor[T]) callPrompt(
 		"document_length", len(textContent),
 		"document_preview", textContent[:min(100, len(textContent))])
 
-	if contextProvider, ok := x.prompts.(ContextualPromptProvider); ok {
+	if label == "" {
+		x.log.Debug("Generating prompt from field metadata", "keys", keys)
+		tpl = generatePrompt(keys, fields)
+		if textContent != "" {
+			tpl += "\nDocument:\n" + textContent
+		}
+	} else if assetProvider, ok := x.prompts.(AssetAwarePromptProvider); ok {
+		x.log.Debug("Using AssetAwarePromptProvider", "provider_type", fmt.Sprintf("%T", assetProvider), "assets", len(promptCtx.Assets))
+		tpl, err = assetProvider.GetPromptWithAssets(label, version, promptCtx)
+		x.log.Debug("Got template from asset-aware provider",
+			"template_length", len(tpl),
+			"template_preview", tpl[:min(200, len(tpl))],
+			"error", err)
+	} else if contextProvider, ok := x.prompts.(ContextualPromptProvider); ok {
 		x.log.Debug("Using ContextualPromptProvider (Stick/Twig)", "provider_type", fmt.Sprintf("%T", contextProvider))
-		tpl, err = contextProvider.GetPromptWithContext(label, 1, keys, textContent)
+		tpl, err = contextProvider.GetPromptWithContext(label, version, keys, textContent)
 		x.log.Debug("Got template from contextual provider",
 			"template_length", len(tpl),
 			"template_preview", tpl[:min(200, len(tpl))],
 			"error", err)
 	} else {
 		x.log.Debug("Using basic PromptProvider", "provider_type", fmt.Sprintf("%T", x.prompts))
-		tpl, err = x.prompts.GetPrompt(label, 1)
+		tpl, err = x.prompts.GetPrompt(label, version)
 		x.log.Debug("Got template from basic provider",
 			"template_length", len(tpl),
 			"template_preview", tpl[:min(200, len(tpl))],
@@ -552,7 +743,7 @@ func (x *Unstructor[T]) callPrompt(
 
 	// Use the template we already got
 	prompt := tpl
-	if _, ok := x.prompts.(ContextualPromptProvider); !ok {
+	if _, ok := x.prompts.(ContextualPromptProvider); !ok && label != "" {
 		x.log.Debug("Using basic provider - replacing {{.Keys}} placeholder")
 		// Replace keys placeholder manually for basic providers
 		if strings.Contains(prompt, "{{.Keys}}") {
@@ -561,6 +752,26 @@ func (x *Unstructor[T]) callPrompt(
 			x.log.Debug("Replaced {{.Keys}} placeholder", "keys", keysStr)
 		}
 	}
+	// Basic and generated prompts only see the examples through the placeholder;
+	// without one they are prepended so they are not lost.
+	if _, ok := x.prompts.(ContextualPromptProvider); !ok || label == "" {
+		if strings.Contains(prompt, examplesPlaceholder) {
+			prompt = strings.ReplaceAll(prompt, examplesPlaceholder, promptCtx.Examples)
+		} else if promptCtx.Examples != "" {
+			prompt = promptCtx.Examples + "\n\n" + prompt
+		}
+	}
+
+	// Invokers without conversation support read the example turns as text
+	conversation, canConverse := x.invoker.(ConversationInvoker)
+	if len(exampleMessages) > 0 && !canConverse {
+		prompt = formatExamples(examples) + "\n\n" + prompt
+		exampleMessages = nil
+	}
+	if len(parameters) > 0 && !canConverse {
+		x.log.Warn("Invoker does not support generation parameters; they are ignored",
+			"label", label, "invoker", fmt.Sprintf("%T", x.invoker), "parameters", parameters)
+	}
 
 	x.log.Debug("Final prompt constructed",
 		"final_prompt_length", len(prompt),
@@ -579,20 +790,25 @@ func (x *Unstructor[T]) callPrompt(
 	var result []byte
 	err = retryable(func() error {
 		var genErr error
+		ctx, cancel := attemptContext(ctx, opts)
+		defer cancel()
 
-		// If we have parameters, use GenerateBytes directly for better control
-		if len(parameters) > 0 {
+		// Parameters and example turns need a real conversation
+		if canConverse && (len(parameters) > 0 || len(exampleMessages) > 0) {
 			// Build proper conversation messages
 			var messages []*Message
 
 			// Add system message with the template/instructions
 			messages = append(messages, NewSystemMessage(NewTextPart(prompt)))
 
-			// Add user messages with actual content
+			// Example turns come before the document
+			messages = append(messages, exampleMessages...)
+
+			// Add asset messages with actual content, keeping their roles
 			for _, msg := range allMessages {
-				userParts := append([]*Part(nil), msg.Parts...)
-				if len(userParts) > 0 {
-					messages = append(messages, NewUserMessage(userParts...))
+				parts := append([]*Part(nil), msg.Parts...)
+				if len(parts) > 0 {
+					messages = append(messages, &Message{Role: msg.Role, Parts: parts})
 				}
 			}
 
@@ -616,11 +832,7 @@ func (x *Unstructor[T]) callPrompt(
 				}
 			}
 
-			result, genErr = GenerateBytes(ctx, x.invoker.(*genkitInvoker).client, x.log,
-				WithModelName(model),
-				WithMessages(messages...),
-				WithParameters(parameters),
-			)
+			result, genErr = conversation.GenerateMessages(ctx, Model(model), messages, parameters)
 		} else {
 			// Use the old path for backward compatibility
 			result, genErr = x.invoker.Generate(ctx, Model(model), prompt, mediaParts)
@@ -645,6 +857,7 @@ func (x *Unstructor[T]) DryRun(
 	if len(assets) == 0 {
 		return nil, fmt.Errorf("dry run: %w", ErrEmptyAssets)
 	}
+	defer cleanupAssets(ctx, assets, x.log)
 
 	var opts Options
 	for _, fn := range optFns {
@@ -696,28 +909,18 @@ func (x *Unstructor[T]) DryRun(
 	x.log.Debug("Starting dry run analysis", "group_count", len(sch.group2keys), "field_count", len(sch.json2field))
 
 	// Extract text content from assets for token estimation
-	var textContent string
-	for _, asset := range assets {
-		messages, err := asset.CreateMessages(ctx, x.log)
+	prepared, err := prepareAssets(ctx, assets, x.log)
+	if err != nil {
+		x.log.Debug("Skipping assets that can't create messages", "error", err)
+	}
+	textContent := prepared.promptContext(nil).Document
+	x.log.Debug("Prepared document for estimation", "document_length", len(textContent))
+	if opts.DocumentID == "" && len(opts.Experiments) > 0 {
+		id, err := prepared.documentID()
 		if err != nil {
-			continue // Skip assets that can't create messages
-		}
-
-		// Extract text content for template building (use first text part found)
-		for _, msg := range messages {
-			for _, part := range msg.Parts {
-				if part.Type == "text" && textContent == "" {
-					textContent = part.Text
-					break
-				}
-			}
-			if textContent != "" {
-				break
-			}
-		}
-		if textContent != "" {
-			break
+			return nil, fmt.Errorf("dry run: experiment: %w", err)
 		}
+		opts.DocumentID = id
 	}
 
 	// Simulate the execution loop
@@ -732,10 +935,35 @@ func (x *Unstructor[T]) DryRun(
 			}
 		}
 
-		// Get prompt template to estimate tokens
-		tpl, err := x.prompts.GetPrompt(pk.prompt, 1)
-		if err != nil {
-			x.log.Debug("Failed to get prompt template", "prompt", pk.prompt, "error", err)
+		// Resolve the template version the real call would use
+		label := pk.prompt
+		if label == "" {
+			label = opts.FallbackPrompt
+		}
+		var (
+			version int
+			variant string
+			tpl     string
+			perr    error // scoped to the group so earlier failures don't leak in
+		)
+		if label == "" {
+			tpl = generatePrompt(keys, sch.json2field)
+		} else {
+			label, model, variant, perr = applyExperiment(label, model, opts)
+			if perr != nil {
+				return nil, fmt.Errorf("dry run: %w", perr)
+			}
+			label, version, perr = resolvePromptVersion(x.prompts, label, opts)
+			if perr != nil {
+				x.log.Debug("Failed to resolve prompt version", "prompt", pk.prompt, "error", perr)
+			}
+
+			// Get prompt template to estimate tokens
+			tpl, perr = x.prompts.GetPrompt(label, version)
+		}
+		promptName, _ := splitPromptVersion(pk.prompt)
+		if perr != nil {
+			x.log.Debug("Failed to get prompt template", "prompt", pk.prompt, "error", perr)
 			// Use default template for estimation
 			tpl = fmt.Sprintf("Extract the following fields from the document: %v", keys)
 		}
@@ -748,23 +976,50 @@ func (x *Unstructor[T]) DryRun(
 			fullPrompt = strings.ReplaceAll(fullPrompt, "{{.Keys}}", keysStr)
 		}
 
-		// Estimate tokens
-		inputTokens := EstimateTokensFromText(fullPrompt)
-		outputTokens := estimateOutputTokensForFields(keys)
+		// Only the assets routed to this group count towards its input
+		labels, _ := assetSelection(label, sch.group2specs[pk].parameters, opts)
+		selected, err := prepared.selectAssets(labels, x.log)
+		if err != nil {
+			return nil, fmt.Errorf("dry run: %s: %w", label, err)
+		}
+		if opts.Retrieval != nil {
+			if selected, _, err = selected.narrow(ctx, retrievalQuery(label, keys), opts.Retrieval); err != nil {
+				return nil, fmt.Errorf("dry run: %s: %w", label, err)
+			}
+		}
+
+		// Few-shot examples are sent with every call of the group
+		var exampleTokens int
+		for _, ex := range opts.Examples.selectFor(label, keys, textContent) {
+			exampleTokens += EstimateTokensFromText(ex.Input) + EstimateTokensFromText(ex.Output)
+		}
+
+		// Estimate tokens; chunked documents cost one call per chunk
+		views := selected.chunks(opts.Chunking)
+		var inputTokens int
+		for _, view := range views {
+			inputTokens += EstimateTokensFromText(fullPrompt) + exampleTokens + view.estimateTokens()
+		}
+		outputTokens := estimateOutputTokensForFields(keys) * len(views)
 
 		// Update statistics
-		stats.ModelCalls[model]++
+		stats.PromptCalls += len(views) - 1
+		stats.ModelCalls[model] += len(views)
 		stats.TotalInputTokens += inputTokens
 		stats.TotalOutputTokens += outputTokens
 
 		// Add group details
 		groupExec := GroupExecution{
-			PromptName:   pk.prompt,
+			PromptName:   promptName,
+			Version:      version,
+			Variant:      variant,
 			Model:        model,
 			Fields:       keys,
+			FieldHints:   hintedFields(keys, sch.json2field),
 			InputTokens:  inputTokens,
 			OutputTokens: outputTokens,
 			ParentPath:   pk.parentPath,
+			Chunks:       len(views),
 		}
 		stats.GroupDetails = append(stats.GroupDetails, groupExec)
 
@@ -838,8 +1093,10 @@ func statsToPlan(stats *ExecutionStats) *PlanNode {
 		promptNode := &PlanNode{
 			Type:         PromptCallType,
 			PromptName:   groupExec.PromptName,
+			Version:      groupExec.Version,
 			Model:        groupExec.Model,
 			Fields:       groupExec.Fields,
+			FieldHints:   groupExec.FieldHints,
 			InputTokens:  groupExec.InputTokens,
 			OutputTokens: groupExec.OutputTokens,
 			EstCost:      costConfig.PromptCallBaseCost + float64(groupExec.InputTokens)*costConfig.PromptCallTokenFactor,
@@ -2,7 +2,7 @@ package unstruct
 
 import (
 	"context"
-	"strings"
+	"log/slog"
 	"testing"
 	"time"
 )
@@ -18,8 +18,8 @@ type TestProject struct {
 // Test structure with missing prompts
 type ProjectWithMissingPrompts struct {
 	Name      string  `json:"name" unstruct:"basic"`
-	Code      string  `json:"code"` // Missing prompt - should error
-	Latitude  float64 `json:"lat"`  // Missing prompt - should error
+	Code      string  `json:"code"` // Missing prompt - generated from field metadata
+	Latitude  float64 `json:"lat"`  // Missing prompt - generated from field metadata
 	Longitude float64 `json:"lon" unstruct:"coords"`
 }
 
@@ -81,13 +81,17 @@ func TestUnstructor_CallPrompt(t *testing.T) {
 
 	keys := []string{"name", "code"}
 	doc := "Project Alpha with code ABC-123"
-	assets := []Asset{&TextAsset{Content: doc}}
+	prepared, err := prepareAssets(context.Background(), []Asset{&TextAsset{Content: doc}}, slog.Default())
+	if err != nil {
+		t.Fatalf("Expected no error preparing assets, got %v", err)
+	}
 
-	raw, err := ext.callPrompt(
+	raw, _, err := ext.callPrompt(
 		context.Background(),
 		"basic",
 		keys,
-		assets,
+		nil, // no field metadata
+		prepared,
 		"test-model",
 		nil, // no parameters
 		Options{},
@@ -165,13 +169,13 @@ func TestSanitizeJSONResponse(t *testing.T) {
 	}
 }
 
-func TestUnstructor_RequiredPrompts(t *testing.T) {
+func TestUnstructor_GeneratedPrompts(t *testing.T) {
 	ext := newTestingUnstructor[ProjectWithMissingPrompts](mockPrompts{})
 
 	doc := "Project Alpha with code ABC-123. Located at coordinates 40.7128, -74.0060."
 	assets := []Asset{&TextAsset{Content: doc}}
 
-	// Should error because fields are missing prompts and no fallback is provided
+	// Fields without prompts get a prompt generated from their metadata
 	result, err := ext.Unstruct(
 		context.Background(),
 		assets,
@@ -179,18 +183,12 @@ func TestUnstructor_RequiredPrompts(t *testing.T) {
 		WithTimeout(10*time.Second),
 	)
 
-	if err == nil {
-		t.Error("Expected error for missing prompts, got nil")
-	}
-
-	if result != nil {
-		t.Error("Expected nil result when error occurs")
+	if err != nil {
+		t.Fatalf("Expected no error for missing prompts, got: %v", err)
 	}
 
-	// Check that the error message mentions missing prompts
-	expectedError := "no prompt specified"
-	if !strings.Contains(err.Error(), expectedError) {
-		t.Errorf("Expected error to contain %q, got: %v", expectedError, err)
+	if result.Code != "TEST-123" || result.Latitude != 40.7128 {
+		t.Errorf("Expected generated prompt group to be merged, got %+v", result)
 	}
 }
 
@@ -0,0 +1,266 @@
+package unstruct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"google.golang.org/genai"
+)
+
+// Files API retention defaults used by upload caches
+const (
+	// DefaultFileExpiry is how long the Files API keeps uploads when it reports no expiration time.
+	DefaultFileExpiry = 48 * time.Hour
+	// uploadCacheExpiryMargin stops handing out uploads that are about to expire mid-request.
+	uploadCacheExpiryMargin = 5 * time.Minute
+)
+
+// UploadCacheKey identifies uploaded content independently of its path
+type UploadCacheKey struct {
+	Checksum string // hex-encoded SHA-256 of the file content
+	MIMEType string
+}
+
+// String returns the canonical string form used by persistent caches
+func (k UploadCacheKey) String() string {
+	return k.Checksum + "|" + k.MIMEType
+}
+
+// UploadCacheEntry records a Files API upload that can be reused
+type UploadCacheEntry struct {
+	Name       string    `json:"name"` // Files API file name, e.g. "files/abc123"
+	URI        string    `json:"uri"`
+	MIMEType   string    `json:"mimeType"`
+	UploadedAt time.Time `json:"uploadedAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+}
+
+// newUploadCacheEntry builds an entry from an ACTIVE upload
+func newUploadCacheEntry(file *genai.File, uploadedAt time.Time) UploadCacheEntry {
+	expiresAt := file.ExpirationTime
+	if expiresAt.IsZero() {
+		expiresAt = uploadedAt.Add(DefaultFileExpiry)
+	}
+	return UploadCacheEntry{
+		Name:       file.Name,
+		URI:        file.URI,
+		MIMEType:   file.MIMEType,
+		UploadedAt: uploadedAt,
+		ExpiresAt:  expiresAt,
+	}
+}
+
+// expired reports whether the entry is too close to its Files API expiry to be used
+func (e UploadCacheEntry) expired(now time.Time) bool {
+	return !now.Before(e.ExpiresAt.Add(-uploadCacheExpiryMargin))
+}
+
+// file converts the entry back into the Files API reference FileAsset uses
+func (e UploadCacheEntry) file() *genai.File {
+	return &genai.File{
+		Name:           e.Name,
+		URI:            e.URI,
+		MIMEType:       e.MIMEType,
+		State:          genai.FileStateActive,
+		ExpirationTime: e.ExpiresAt,
+	}
+}
+
+// UploadCache stores Files API uploads keyed by content checksum and MIME type
+// so that identical files are uploaded only once. Implementations must be safe
+// for concurrent use and must not return expired entries.
+type UploadCache interface {
+	Get(ctx context.Context, key UploadCacheKey) (UploadCacheEntry, bool, error)
+	Put(ctx context.Context, key UploadCacheKey, entry UploadCacheEntry) error
+	Delete(ctx context.Context, key UploadCacheKey) error
+}
+
+// MemoryUploadCache is an in-process UploadCache
+type MemoryUploadCache struct {
+	mu      sync.RWMutex
+	entries map[UploadCacheKey]UploadCacheEntry
+}
+
+// NewMemoryUploadCache creates an empty in-memory upload cache
+func NewMemoryUploadCache() *MemoryUploadCache {
+	return &MemoryUploadCache{entries: make(map[UploadCacheKey]UploadCacheEntry)}
+}
+
+// Get returns the entry for key unless it is missing or expired
+func (c *MemoryUploadCache) Get(ctx context.Context, key UploadCacheKey) (UploadCacheEntry, bool, error) {
+	c.mu.RLock()
+	entry, ok := c.entries[key]
+	c.mu.RUnlock()
+	if !ok {
+		return UploadCacheEntry{}, false, nil
+	}
+	if entry.expired(time.Now()) {
+		_ = c.Delete(ctx, key) // never fails
+		return UploadCacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Put stores entry under key
+func (c *MemoryUploadCache) Put(ctx context.Context, key UploadCacheKey, entry UploadCacheEntry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[key] = entry
+	return nil
+}
+
+// Delete removes the entry for key
+func (c *MemoryUploadCache) Delete(ctx context.Context, key UploadCacheKey) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.entries, key)
+	return nil
+}
+
+// FileUploadCache is an UploadCache persisted to a single JSON file, so that
+// repeated runs and parallel worker processes on one host share uploads.
+// Writers serialise through a lock file next to the cache and replace the
+// cache atomically, so readers never observe a partially written file.
+type FileUploadCache struct {
+	path      string
+	lockPath  string
+	staleLock time.Duration
+	mu        sync.Mutex // serialises writers within this process
+}
+
+// NewFileUploadCache opens (or creates on first write) the cache stored at path
+func NewFileUploadCache(path string) (*FileUploadCache, error) {
+	if path == "" {
+		return nil, fmt.Errorf("upload cache path is empty")
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, fmt.Errorf("create upload cache directory: %w", err)
+	}
+	return &FileUploadCache{
+		path:      path,
+		lockPath:  path + ".lock",
+		staleLock: 30 * time.Second,
+	}, nil
+}
+
+// Get returns the entry for key unless it is missing or expired
+func (c *FileUploadCache) Get(ctx context.Context, key UploadCacheKey) (UploadCacheEntry, bool, error) {
+	entries, err := c.load()
+	if err != nil {
+		return UploadCacheEntry{}, false, err
+	}
+	entry, ok := entries[key.String()]
+	if !ok || entry.expired(time.Now()) {
+		return UploadCacheEntry{}, false, nil
+	}
+	return entry, true, nil
+}
+
+// Put stores entry under key and prunes expired entries
+func (c *FileUploadCache) Put(ctx context.Context, key UploadCacheKey, entry UploadCacheEntry) error {
+	return c.update(ctx, func(entries map[string]UploadCacheEntry) {
+		entries[key.String()] = entry
+	})
+}
+
+// Delete removes the entry for key
+func (c *FileUploadCache) Delete(ctx context.Context, key UploadCacheKey) error {
+	return c.update(ctx, func(entries map[string]UploadCacheEntry) {
+		delete(entries, key.String())
+	})
+}
+
+func (c *FileUploadCache) load() (map[string]UploadCacheEntry, error) {
+	entries := make(map[string]UploadCacheEntry)
+	data, err := os.ReadFile(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return entries, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read upload cache: %w", err)
+	}
+	if len(data) == 0 {
+		return entries, nil
+	}
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("decode upload cache %s: %w", c.path, err)
+	}
+	return entries, nil
+}
+
+// update applies fn to the current entries under the cache lock and writes the result atomically
+func (c *FileUploadCache) update(ctx context.Context, fn func(map[string]UploadCacheEntry)) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	unlock, err := c.lock(ctx)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	entries, err := c.load()
+	if err != nil {
+		return err
+	}
+	fn(entries)
+
+	now := time.Now()
+	for k, e := range entries {
+		if e.expired(now) {
+			delete(entries, k)
+		}
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode upload cache: %w", err)
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(c.path), filepath.Base(c.path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("write upload cache: %w", err)
+	}
+	defer func() {
+		_ = os.Remove(tmp.Name()) // no-op after a successful rename
+	}()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("write upload cache: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("write upload cache: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), c.path); err != nil {
+		return fmt.Errorf("replace upload cache: %w", err)
+	}
+	return nil
+}
+
+// lock acquires the cross-process lock file, breaking locks older than staleLock
+func (c *FileUploadCache) lock(ctx context.Context) (func(), error) {
+	for {
+		f, err := os.OpenFile(c.lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o600)
+		if err == nil {
+			_ = f.Close()
+			return func() { _ = os.Remove(c.lockPath) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, fmt.Errorf("lock upload cache: %w", err)
+		}
+		if info, statErr := os.Stat(c.lockPath); statErr == nil && time.Since(info.ModTime()) > c.staleLock {
+			_ = os.Remove(c.lockPath) // holder crashed; the next attempt re-acquires
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("lock upload cache: %w", ctx.Err())
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
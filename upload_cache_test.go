@@ -0,0 +1,150 @@
+package unstruct
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genai"
+)
+
+func testUploadCacheContract(t *testing.T, cache UploadCache) {
+	ctx := context.Background()
+	key := UploadCacheKey{Checksum: "abc", MIMEType: "application/pdf"}
+
+	_, ok, err := cache.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	entry := UploadCacheEntry{Name: "files/1", URI: "https://files/1", UploadedAt: time.Now(), ExpiresAt: time.Now().Add(time.Hour)}
+	require.NoError(t, cache.Put(ctx, key, entry))
+
+	got, ok, err := cache.Get(ctx, key)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, "files/1", got.Name)
+
+	// Same checksum with another MIME type is a different upload
+	_, ok, err = cache.Get(ctx, UploadCacheKey{Checksum: "abc", MIMEType: "text/plain"})
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	require.NoError(t, cache.Delete(ctx, key))
+	_, ok, err = cache.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Entries about to expire are not handed out
+	entry.ExpiresAt = time.Now().Add(time.Minute)
+	require.NoError(t, cache.Put(ctx, key, entry))
+	_, ok, err = cache.Get(ctx, key)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
+
+func TestMemoryUploadCache(t *testing.T) {
+	testUploadCacheContract(t, NewMemoryUploadCache())
+}
+
+func TestFileUploadCache(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache", "uploads.json")
+	cache, err := NewFileUploadCache(path)
+	require.NoError(t, err)
+	testUploadCacheContract(t, cache)
+
+	t.Run("shared between instances", func(t *testing.T) {
+		ctx := context.Background()
+		key := UploadCacheKey{Checksum: "shared", MIMEType: "text/plain"}
+		require.NoError(t, cache.Put(ctx, key, UploadCacheEntry{Name: "files/shared", ExpiresAt: time.Now().Add(time.Hour)}))
+
+		other, err := NewFileUploadCache(path)
+		require.NoError(t, err)
+		got, ok, err := other.Get(ctx, key)
+		require.NoError(t, err)
+		require.True(t, ok)
+		assert.Equal(t, "files/shared", got.Name)
+	})
+
+	t.Run("concurrent writers", func(t *testing.T) {
+		ctx := context.Background()
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				writer, err := NewFileUploadCache(path)
+				require.NoError(t, err)
+				key := UploadCacheKey{Checksum: fmt.Sprintf("c%d", i), MIMEType: "text/plain"}
+				assert.NoError(t, writer.Put(ctx, key, UploadCacheEntry{Name: key.Checksum, ExpiresAt: time.Now().Add(time.Hour)}))
+			}(i)
+		}
+		wg.Wait()
+
+		entries, err := cache.load()
+		require.NoError(t, err)
+		for i := 0; i < 8; i++ {
+			assert.Contains(t, entries, fmt.Sprintf("c%d|text/plain", i))
+		}
+		_, err = os.Stat(path + ".lock")
+		assert.True(t, os.IsNotExist(err))
+	})
+}
+
+func TestNewUploadCacheEntry(t *testing.T) {
+	uploadedAt := time.Now()
+	entry := newUploadCacheEntry(&genai.File{Name: "files/x"}, uploadedAt)
+	assert.Equal(t, uploadedAt.Add(DefaultFileExpiry), entry.ExpiresAt)
+
+	expires := uploadedAt.Add(time.Hour)
+	entry = newUploadCacheEntry(&genai.File{Name: "files/x", ExpirationTime: expires}, uploadedAt)
+	assert.Equal(t, expires, entry.ExpiresAt)
+	assert.Equal(t, genai.FileStateActive, entry.file().State)
+}
+
+func TestFileAsset_UploadCache(t *testing.T) {
+	ctx := context.Background()
+	api, client := newFakeFilesAPI(t)
+	cache := NewMemoryUploadCache()
+
+	first := NewFileAsset(client, writeTempFile(t, "a.txt", "same content"), WithMimeType("text/plain"), WithUploadCache(cache))
+	second := NewFileAsset(client, writeTempFile(t, "b.txt", "same content"), WithMimeType("text/plain"), WithUploadCache(cache))
+	other := NewFileAsset(client, writeTempFile(t, "c.txt", "different"), WithMimeType("text/plain"), WithUploadCache(cache))
+
+	m1, err := first.CreateMessages(ctx, slog.Default())
+	require.NoError(t, err)
+	m2, err := second.CreateMessages(ctx, slog.Default())
+	require.NoError(t, err)
+	_, err = other.CreateMessages(ctx, slog.Default())
+	require.NoError(t, err)
+
+	assert.Equal(t, 2, api.uploads)
+	assert.Equal(t, m1[0].Parts[0].FileURI, m2[0].Parts[0].FileURI)
+
+	// Uploads deleted behind the cache's back are uploaded again
+	api.mu.Lock()
+	api.deleted = append(api.deleted, first.uploadedFile.Name)
+	api.mu.Unlock()
+	third := NewFileAsset(client, writeTempFile(t, "d.txt", "same content"), WithMimeType("text/plain"), WithUploadCache(cache))
+	m3, err := third.CreateMessages(ctx, slog.Default())
+	require.NoError(t, err)
+	assert.Equal(t, 3, api.uploads)
+	assert.NotEqual(t, m1[0].Parts[0].FileURI, m3[0].Parts[0].FileURI)
+	entry, ok, err := cache.Get(ctx, third.cacheKey)
+	require.NoError(t, err)
+	require.True(t, ok)
+	assert.Equal(t, third.uploadedFile.Name, entry.Name)
+
+	// Deleting the upload also evicts it from the cache
+	second.AutoCleanup = true
+	require.NoError(t, second.Cleanup(ctx))
+	_, ok, err = cache.Get(ctx, second.cacheKey)
+	require.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -1,10 +1,14 @@
 package unstruct
 
 import (
+	"bytes"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log/slog"
+	"maps"
 	"reflect"
+	"slices"
 	"strings"
 	"time"
 )
@@ -26,81 +30,76 @@ func traverse(m map[string]any, path string) (any, bool) {
 	return cur, true
 }
 
-// patchStruct merges JSON data into the destination struct using dotted keys support
-func patchStruct[T any](dst *T, raw []byte, spec map[string]fieldSpec) error {
+// patchStruct merges JSON data into the destination struct using dotted keys support.
+// Values are converted by c, which collects those it cannot convert; a nil c
+// converts with the defaults and drops them.
+func patchStruct[T any](dst *T, raw []byte, spec map[string]fieldSpec, c *coercer) error {
 	slog.Debug("Starting JSON merge", "raw_length", len(raw), "spec_size", len(spec))
 
+	// Numbers are kept as written so that large integers and decimals are exact
 	var payload map[string]any
-	if err := json.Unmarshal(raw, &payload); err != nil {
+	dec := json.NewDecoder(bytes.NewReader(raw))
+	dec.UseNumber()
+	if err := dec.Decode(&payload); err != nil {
 		slog.Debug("JSON unmarshal failed", "error", err)
 		return err
 	}
+	if _, err := dec.Token(); err != io.EOF {
+		return fmt.Errorf("invalid data after top-level JSON value")
+	}
 	slog.Debug("Unmarshaled JSON", "key_count", len(payload))
 
+	if c == nil {
+		c = newCoercer(nil)
+	}
 	vDst := reflect.ValueOf(dst).Elem()
 
-	for path, fs := range spec {
+	for _, path := range slices.Sorted(maps.Keys(spec)) {
+		// Nested fields are set together with their parent node
+		if i := strings.LastIndex(path, "."); i >= 0 {
+			if _, ok := spec[path[:i]]; ok {
+				continue
+			}
+		}
 		val, ok := traverse(payload, path)
 		if !ok {
 			slog.Debug("Path not found in payload", "path", path)
 			continue // nothing supplied for this key
 		}
 
-		field := vDst.FieldByIndex(fs.index)
-		if !field.CanSet() {
+		field, ok := fieldByIndex(vDst, spec[path].index)
+		if !ok || !field.CanSet() {
 			slog.Debug("Field cannot be set", "path", path)
 			continue
 		}
+		c.set(field, val, path)
+		slog.Debug("Set field", "path", path)
+	}
+	return nil
+}
 
-		// Handle different field types
-		switch field.Kind() {
-		case reflect.String:
-			if s, ok := val.(string); ok {
-				field.SetString(s)
-				slog.Debug("Set string field", "path", path, "value", s)
-			}
-		case reflect.Map, reflect.Struct, reflect.Interface:
-			// For complex types, marshal back to JSON and unmarshal into the field
-			b, err := json.Marshal(val)
-			if err != nil {
-				slog.Debug("Failed to marshal field value", "path", path, "error", err)
-				continue
+// fieldByIndex is like reflect.Value.FieldByIndex but allocates nil struct
+// pointers on the way, so they are only allocated when there is data for them.
+// It fails when one cannot be set, which is the case for embedded pointers to
+// unexported types as with encoding/json, and at slice, array and map elements,
+// which are patched as a whole with their field.
+func fieldByIndex(v reflect.Value, index []int) (reflect.Value, bool) {
+	for _, x := range index {
+		for v.Kind() == reflect.Pointer {
+			if v.IsNil() {
+				if !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
 			}
-			if err := json.Unmarshal(b, field.Addr().Interface()); err != nil {
-				slog.Debug("Failed to unmarshal into field", "path", path, "error", err)
-				return fmt.Errorf("%s: %w", path, err)
-			}
-			slog.Debug("Set complex field", "path", path)
-		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
-			if i, ok := val.(float64); ok { // JSON numbers are float64
-				field.SetInt(int64(i))
-				slog.Debug("Set int field", "path", path, "value", int64(i))
-			}
-		case reflect.Float32, reflect.Float64:
-			if f, ok := val.(float64); ok {
-				field.SetFloat(f)
-				slog.Debug("Set float field", "path", path, "value", f)
-			}
-		case reflect.Bool:
-			if b, ok := val.(bool); ok {
-				field.SetBool(b)
-				slog.Debug("Set bool field", "path", path, "value", b)
-			}
-		default:
-			// Fallback: try JSON marshal/unmarshal
-			b, err := json.Marshal(val)
-			if err != nil {
-				slog.Debug("Failed to marshal field value", "path", path, "error", err)
-				continue
-			}
-			if err := json.Unmarshal(b, field.Addr().Interface()); err != nil {
-				slog.Debug("Failed to unmarshal into field", "path", path, "error", err)
-				return fmt.Errorf("%s: %w", path, err)
-			}
-			slog.Debug("Set field via fallback", "path", path)
+			v = v.Elem()
 		}
+		if v.Kind() != reflect.Struct {
+			return reflect.Value{}, false
+		}
+		v = v.Field(x)
 	}
-	return nil
+	return v, true
 }
 
 // SanitizeJSONResponse removes garbage characters often produced by LLMs.
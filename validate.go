@@ -0,0 +1,436 @@
+package unstruct
+
+import (
+	"fmt"
+	"maps"
+	"net/url"
+	"reflect"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TagError is one problem found in an unstruct tag by Validate
+type TagError struct {
+	Field  string // Go field path, e.g. "Invoice.Lines.Amount", or "group/name" for WithGroup settings
+	Key    string // JSON key path, e.g. "invoice.lines.amount"; "" for embedded structs and settings outside tags
+	Tag    string // the unstruct tag as written
+	Offset int    // byte offset of the problem in Tag; -1 when it concerns the whole field or no tag
+	Msg    string
+}
+
+func (e TagError) Error() string {
+	field := e.Field
+	if e.Key != "" {
+		field = fmt.Sprintf("%s (%s)", e.Field, e.Key)
+	}
+	if e.Offset < 0 {
+		return fmt.Sprintf("%s: %s", field, e.Msg)
+	}
+	return fmt.Sprintf("%s: unstruct:%q at offset %d: %s", field, e.Tag, e.Offset, e.Msg)
+}
+
+// ValidationError lists every problem Validate found, in field order
+type ValidationError struct {
+	Errors []TagError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Errors)+1)
+	lines = append(lines, fmt.Sprintf("unstruct: %d invalid tag(s)", len(e.Errors)))
+	for _, te := range e.Errors {
+		lines = append(lines, "  "+te.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks every unstruct tag of T against the strict tag grammar
+//
+//	tag    = [ path ] [ "?" query ]
+//	path   = name | prompt "," model | pair { "/" pair }
+//	pair   = ( "prompt" | "model" | "group" ) "/" value
+//	query  = param { "&" param }
+//	param  = name "=" value
+//
+// and reports unknown keys and parameters, bad parameter values in tags and in
+// WithGroupParameters, malformed version suffixes and group/ references missing
+// from WithGroup. WithExtractionConfig entries and WithFieldHints keys are
+// checked too, including keys that name no field of T.
+//
+// With WithRequirePrompts it also reports fields that have no prompt and no
+// fallback, for which extraction would generate a prompt.
+//
+// Extraction itself parses tags leniently; run Validate in unit tests to catch
+// mistakes.
+func Validate[T any](optFns ...func(*Options)) error {
+	var opts Options
+	for _, fn := range optFns {
+		fn(&opts)
+	}
+
+	var zero T
+	rt := reflect.TypeOf(zero)
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return fmt.Errorf("unstruct: T must be struct")
+	}
+
+	// Group parameters are written in Go rather than in tags
+	var errs []TagError
+	for _, name := range slices.Sorted(maps.Keys(opts.Groups)) {
+		parameters := opts.Groups[name].Parameters
+		for _, k := range slices.Sorted(maps.Keys(parameters)) {
+			check, known := tagParameters[k]
+			switch {
+			case !known:
+				errs = append(errs, TagError{Field: "group/" + name, Offset: -1,
+					Msg: fmt.Sprintf("unknown parameter %q%s", k, suggestParameter(k))})
+			case check(parameters[k]) != nil:
+				errs = append(errs, TagError{Field: "group/" + name, Offset: -1,
+					Msg: fmt.Sprintf("%s %v", k, check(parameters[k]))})
+			}
+		}
+	}
+
+	overridden := map[string]bool{}
+	keys := map[string]bool{}    // JSON keys of every field, for WithFieldHints
+	checked := map[string]bool{} // embedded fields, shared by their promoted fields
+	var walk func(t reflect.Type, goPath, parent, inheritedPrompt string)
+	walk = func(t reflect.Type, goPath, parent, inheritedPrompt string) {
+		for _, sf := range jsonFields(t) {
+			f := sf.StructField
+			fullKey := joinKey(parent, sf.key)
+			field, prompt := goPath, inheritedPrompt
+			keys[fullKey] = true
+
+			// Tags of embedded structs are checked once and inherited like a parent's
+			for _, e := range sf.embedded {
+				field = joinKey(field, e.Name)
+				etag := e.Tag.Get("unstruct")
+				etp, egroupOffset, problems := parseTagStrict(etag)
+				if !checked[field] {
+					checked[field] = true
+					for _, p := range problems {
+						errs = append(errs, TagError{Field: field, Tag: etag, Offset: p.offset, Msg: p.msg})
+					}
+					if group, ok := strings.CutPrefix(etp.prompt, "group:"); ok {
+						if _, exists := opts.Groups[group]; !exists {
+							errs = append(errs, TagError{Field: field, Tag: etag, Offset: egroupOffset,
+								Msg: fmt.Sprintf("group %q is not defined with WithGroup", group)})
+						}
+					}
+				}
+				if etp.prompt != "" {
+					prompt = etp.prompt
+				}
+			}
+			field = joinKey(field, f.Name)
+			tag := f.Tag.Get("unstruct")
+
+			tp, groupOffset, problems := parseTagStrict(tag)
+			for _, p := range problems {
+				errs = append(errs, TagError{Field: field, Key: fullKey, Tag: tag, Offset: p.offset, Msg: p.msg})
+			}
+			if group, ok := strings.CutPrefix(tp.prompt, "group:"); ok {
+				if _, exists := opts.Groups[group]; !exists {
+					errs = append(errs, TagError{Field: field, Key: fullKey, Tag: tag, Offset: groupOffset,
+						Msg: fmt.Sprintf("group %q is not defined with WithGroup", group)})
+				}
+			}
+
+			// Config entries win over the tag
+			for _, key := range opts.overrideKeys(sf.owner, f, fullKey) {
+				override := opts.FieldOverrides[key]
+				overridden[key] = true
+				if override.Prompt != "" {
+					tp.prompt = override.Prompt
+				}
+				if override.Group != "" {
+					tp.prompt = "group:" + override.Group
+					if _, exists := opts.Groups[override.Group]; !exists {
+						errs = append(errs, TagError{Field: field, Key: fullKey, Offset: -1,
+							Msg: fmt.Sprintf("config %q: group %q is not defined", key, override.Group)})
+					}
+				}
+				for _, k := range slices.Sorted(maps.Keys(override.Parameters)) {
+					if check, known := tagParameters[k]; !known {
+						errs = append(errs, TagError{Field: field, Key: fullKey, Offset: -1,
+							Msg: fmt.Sprintf("config %q: unknown parameter %q%s", key, k, suggestParameter(k))})
+					} else if err := check(override.Parameters[k]); err != nil {
+						errs = append(errs, TagError{Field: field, Key: fullKey, Offset: -1,
+							Msg: fmt.Sprintf("config %q: %s %v", key, k, err)})
+					}
+				}
+			}
+
+			if tp.prompt != "" {
+				prompt = tp.prompt
+			}
+			if st := nestedStruct(f.Type); st != nil {
+				walk(st, field, fullKey, prompt)
+				continue
+			}
+
+			if opts.RequirePrompts && prompt == "" && opts.FallbackPrompt == "" {
+				errs = append(errs, TagError{Field: field, Key: fullKey, Tag: tag, Offset: -1,
+					Msg: "no prompt: add a prompt tag or WithFallbackPrompt instead of the generated prompt"})
+			}
+		}
+	}
+	walk(rt, rt.Name(), "", "")
+
+	for _, key := range slices.Sorted(maps.Keys(opts.FieldOverrides)) {
+		if !overridden[key] {
+			errs = append(errs, TagError{Field: "config", Offset: -1,
+				Msg: fmt.Sprintf("no field %q in %s", key, rt.Name())})
+		}
+	}
+	for _, key := range slices.Sorted(maps.Keys(opts.FieldHints)) {
+		if !keys[key] {
+			errs = append(errs, TagError{Field: "hints", Offset: -1,
+				Msg: fmt.Sprintf("no field %q in %s", key, rt.Name())})
+		}
+	}
+
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+// MustValidate is like Validate but panics on any problem, for package-level
+// checks such as var _ = unstruct.MustValidate[Invoice]()
+func MustValidate[T any](optFns ...func(*Options)) bool {
+	if err := Validate[T](optFns...); err != nil {
+		panic(err)
+	}
+	return true
+}
+
+// tagProblem is a problem at a byte offset of a tag
+type tagProblem struct {
+	offset int
+	msg    string
+}
+
+// tagKeys are the keys of the path grammar
+var tagKeys = []string{"prompt", "model", "group"}
+
+// tagParameters checks the values of known query parameters
+var tagParameters = map[string]func(string) error{
+	"temperature":     checkFloatRange(0, 1),
+	"topP":            checkFloatRange(0, 1),
+	"topK":            checkPositiveFloat,
+	"maxTokens":       checkPositiveInt,
+	"maxOutputTokens": checkPositiveInt,
+	assetsParam:       checkList,
+	enumParam:         checkList,
+	descriptionParam:  checkNonEmpty,
+	formatParam:       checkNonEmpty,
+	unitParam:         checkNonEmpty,
+	exampleParam:      checkNonEmpty,
+}
+
+// parseTagStrict parses tag with the grammar documented on Validate. It returns
+// what it could parse, the offset of a group reference, and every problem found.
+func parseTagStrict(tag string) (tp tagParts, groupOffset int, problems []tagProblem) {
+	tp.parameters = make(map[string]string)
+	report := func(offset int, format string, args ...any) {
+		problems = append(problems, tagProblem{offset: offset, msg: fmt.Sprintf(format, args...)})
+	}
+
+	path, query, hasQuery := strings.Cut(tag, "?")
+	if _, err := url.PathUnescape(path); err != nil {
+		report(0, "invalid escape in path: %v", err)
+	}
+
+	switch {
+	case path == "":
+	case strings.Contains(path, ","):
+		parts := strings.Split(path, ",")
+		if len(parts) != 2 || strings.TrimSpace(parts[0]) == "" || strings.TrimSpace(parts[1]) == "" {
+			report(strings.IndexByte(path, ','), "malformed prompt,model pair")
+			break
+		}
+		tp.prompt, tp.model = parts[0], parts[1]
+	default:
+		groupOffset = parsePathStrict(path, &tp, report)
+	}
+
+	if tp.prompt != "" && strings.Contains(tp.prompt, "@") && !strings.HasPrefix(tp.prompt, "group:") {
+		if _, version := splitPromptVersion(tp.prompt); version == LatestPromptVersion {
+			report(strings.LastIndex(tag, "@"), "invalid version suffix in prompt %q, want name@N or name@vN", tp.prompt)
+		}
+	}
+
+	if hasQuery {
+		parseQueryStrict(query, len(path)+1, &tp, report)
+	}
+	return tp, groupOffset, problems
+}
+
+// parsePathStrict parses the key/value path and returns the offset of a group value
+func parsePathStrict(path string, tp *tagParts, report func(int, string, ...any)) int {
+	segs := strings.Split(path, "/")
+	offsets := make([]int, len(segs))
+	for i, off := 1, 0; i < len(segs); i++ {
+		off += len(segs[i-1]) + 1
+		offsets[i] = off
+	}
+	for i, s := range segs {
+		if s == "" {
+			report(offsets[i], "empty path segment")
+			return 0
+		}
+	}
+
+	if len(segs) == 1 {
+		if looksLikeModel(path) {
+			tp.model = path
+		} else {
+			tp.prompt = path
+		}
+		return 0
+	}
+
+	var groupOffset int
+	seen := map[string]bool{}
+	for i := 0; i < len(segs); {
+		key := segs[i]
+		if !slices.Contains(tagKeys, key) {
+			report(offsets[i], "unknown key %q, want prompt, model or group", key)
+			return groupOffset
+		}
+		if seen[key] {
+			report(offsets[i], "duplicate key %q", key)
+		}
+		seen[key] = true
+		if i+1 >= len(segs) {
+			report(offsets[i], "missing value for %s", key)
+			return groupOffset
+		}
+
+		// A value runs until the next key at an even position, like the lenient
+		// parser; key names elsewhere are swallowed into the value
+		end := len(segs)
+		if !(key == "model" && i == 0) {
+			for j := i + 2; j < len(segs); j++ {
+				if j%2 == 0 && slices.Contains(tagKeys, segs[j]) {
+					end = j
+					break
+				}
+			}
+		}
+		for j := i + 1; j < end; j++ {
+			if slices.Contains(tagKeys, segs[j]) {
+				report(offsets[j], "%q is read as part of the %s value", segs[j], key)
+			}
+		}
+
+		value := strings.Join(segs[i+1:end], "/")
+		switch key {
+		case "prompt":
+			tp.prompt = value
+		case "model":
+			tp.model = value
+		case "group":
+			tp.prompt = "group:" + value
+			groupOffset = offsets[i+1]
+		}
+		i = end
+	}
+	if seen["prompt"] && seen["group"] {
+		report(0, "prompt and group are exclusive")
+	}
+	return groupOffset
+}
+
+// parseQueryStrict parses name=value parameters starting at base in the tag
+func parseQueryStrict(query string, base int, tp *tagParts, report func(int, string, ...any)) {
+	off := base
+	for _, param := range strings.Split(query, "&") {
+		at := off
+		off += len(param) + 1
+
+		rawName, rawValue, ok := strings.Cut(param, "=")
+		if !ok || rawName == "" {
+			report(at, "parameter %q is not name=value", param)
+			continue
+		}
+		name, err := url.QueryUnescape(rawName)
+		if err != nil {
+			report(at, "invalid escape in parameter name: %v", err)
+			continue
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			report(at+len(rawName)+1, "invalid escape in %s: %v", name, err)
+			continue
+		}
+		if _, dup := tp.parameters[name]; dup {
+			report(at, "duplicate parameter %q", name)
+			continue
+		}
+		tp.parameters[name] = value
+
+		check, known := tagParameters[name]
+		if !known {
+			report(at, "unknown parameter %q%s", name, suggestParameter(name))
+			continue
+		}
+		if err := check(value); err != nil {
+			report(at+len(rawName)+1, "%s %v", name, err)
+		}
+	}
+}
+
+// suggestParameter names a known parameter that differs from name only in case
+func suggestParameter(name string) string {
+	known := make([]string, 0, len(tagParameters))
+	for k := range tagParameters {
+		if strings.EqualFold(k, name) {
+			return fmt.Sprintf(", did you mean %q?", k)
+		}
+		known = append(known, k)
+	}
+	sort.Strings(known)
+	return fmt.Sprintf(", want one of %s", strings.Join(known, ", "))
+}
+
+func checkFloatRange(lo, hi float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < lo || v > hi {
+			return fmt.Errorf("must be a number between %g and %g, got %q", lo, hi, s)
+		}
+		return nil
+	}
+}
+
+func checkPositiveFloat(s string) error {
+	if v, err := strconv.ParseFloat(s, 64); err != nil || v <= 0 {
+		return fmt.Errorf("must be a number greater than 0, got %q", s)
+	}
+	return nil
+}
+
+func checkPositiveInt(s string) error {
+	if v, err := strconv.Atoi(s); err != nil || v <= 0 {
+		return fmt.Errorf("must be an integer greater than 0, got %q", s)
+	}
+	return nil
+}
+
+func checkList(s string) error {
+	if len(splitEnum(s)) == 0 {
+		return fmt.Errorf("must list at least one value")
+	}
+	return nil
+}
+
+func checkNonEmpty(s string) error {
+	if strings.TrimSpace(s) == "" {
+		return fmt.Errorf("must not be empty")
+	}
+	return nil
+}
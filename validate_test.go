@@ -0,0 +1,134 @@
+package unstruct
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type validInvoice struct {
+	Number string `json:"number" unstruct:"prompt/invoice@v2/model/gemini-1.5-pro?temperature=0.2&topK=40"`
+	Vendor struct {
+		Name string `json:"name"`
+		VAT  string `json:"vat" unstruct:"model/vertex/gemini-1.5-flash"`
+	} `json:"vendor" unstruct:"vendor"`
+	Total  float64 `json:"total" unstruct:"group/totals?assets=invoice&unit=EUR"`
+	Status string  `json:"status" desc:"Payment status"`
+	Legacy string  `json:"legacy" unstruct:"basic,gemini-1.5-flash"`
+}
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate[validInvoice](WithGroup("totals", "invoice", "")))
+	assert.True(t, MustValidate[validInvoice](WithGroup("totals", "invoice", "")))
+
+	err := Validate[validInvoice]()
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 1)
+	assert.Equal(t, TagError{
+		Field:  "validInvoice.Total",
+		Key:    "total",
+		Tag:    "group/totals?assets=invoice&unit=EUR",
+		Offset: 6,
+		Msg:    `group "totals" is not defined with WithGroup`,
+	}, verr.Errors[0])
+	assert.Panics(t, func() { MustValidate[validInvoice]() })
+}
+
+func TestValidate_Problems(t *testing.T) {
+	type lines struct {
+		Amount float64 `json:"amount" unstruct:"prompt/lines?temperature=2"`
+	}
+	type doc struct {
+		A string  `json:"a" unstruct:"basic,gemini,extra"`
+		B string  `json:"b" unstruct:"prompt/x?topk=3&maxTokens=0"`
+		C string  `json:"c" unstruct:"foo/bar"`
+		D string  `json:"d" unstruct:"prompt//x"`
+		E string  `json:"e" unstruct:"prompt/a/b/model/x"`
+		F string  `json:"f" unstruct:"prompt/x@vnext?enum=&temperature=0.1&temperature=0.2"`
+		G string  `json:"g"`
+		H string  `json:"h" unstruct:"prompt/a/prompt/b"`
+		K string  `json:"k" unstruct:"prompt/a/model"`
+		I []lines `json:"items"`
+	}
+
+	err := Validate[doc]()
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+
+	var got []string
+	for _, e := range verr.Errors {
+		got = append(got, e.Error())
+	}
+	assert.Equal(t, []string{
+		`doc.A (a): unstruct:"basic,gemini,extra" at offset 5: malformed prompt,model pair`,
+		`doc.B (b): unstruct:"prompt/x?topk=3&maxTokens=0" at offset 9: unknown parameter "topk", did you mean "topK"?`,
+		`doc.B (b): unstruct:"prompt/x?topk=3&maxTokens=0" at offset 26: maxTokens must be an integer greater than 0, got "0"`,
+		`doc.C (c): unstruct:"foo/bar" at offset 0: unknown key "foo", want prompt, model or group`,
+		`doc.D (d): unstruct:"prompt//x" at offset 7: empty path segment`,
+		`doc.E (e): unstruct:"prompt/a/b/model/x" at offset 11: "model" is read as part of the prompt value`,
+		`doc.F (f): unstruct:"prompt/x@vnext?enum=&temperature=0.1&temperature=0.2" at offset 8: invalid version suffix in prompt "x@vnext", want name@N or name@vN`,
+		`doc.F (f): unstruct:"prompt/x@vnext?enum=&temperature=0.1&temperature=0.2" at offset 20: enum must list at least one value`,
+		`doc.F (f): unstruct:"prompt/x@vnext?enum=&temperature=0.1&temperature=0.2" at offset 37: duplicate parameter "temperature"`,
+		`doc.H (h): unstruct:"prompt/a/prompt/b" at offset 9: duplicate key "prompt"`,
+		`doc.K (k): unstruct:"prompt/a/model" at offset 9: missing value for model`,
+		`doc.I.Amount (items.amount): unstruct:"prompt/lines?temperature=2" at offset 25: temperature must be a number between 0 and 1, got "2"`,
+	}, got)
+	assert.Contains(t, err.Error(), "unstruct: 12 invalid tag(s)\n  doc.A (a):")
+
+	// Fields left to the generated prompt are reported on request
+	err = Validate[doc](WithRequirePrompts())
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 16)
+	assert.Equal(t, `doc.G (g): no prompt: add a prompt tag or WithFallbackPrompt instead of the generated prompt`, verr.Errors[12].Error())
+	err = Validate[doc](WithRequirePrompts(), WithFallbackPrompt("default"))
+	require.ErrorAs(t, err, &verr)
+	assert.Len(t, verr.Errors, 12)
+
+	// Hints must name a field by its JSON key
+	err = Validate[doc](WithFieldHints(map[string]FieldHint{
+		"items.amount": {Unit: "EUR"},
+		"items.amout":  {Unit: "EUR"},
+		"Amount":       {Unit: "EUR"},
+	}))
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 14)
+	assert.Equal(t, `hints: no field "Amount" in doc`, verr.Errors[12].Error())
+	assert.Equal(t, `hints: no field "items.amout" in doc`, verr.Errors[13].Error())
+}
+
+func TestValidate_EmbeddedStructs(t *testing.T) {
+	type audit struct {
+		CreatedBy string `json:"createdBy"`
+		UpdatedBy string `json:"updatedBy"`
+	}
+	type Address struct {
+		City string `json:"city"`
+	}
+	type doc struct {
+		audit    `unstruct:"prompt/audit?temprature=0.1"`
+		*Address `unstruct:"group/places"`
+		Name     string `json:"name" unstruct:"prompt/basic"`
+	}
+
+	err := Validate[doc]()
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	assert.Equal(t, []TagError{
+		{Field: "doc.audit", Tag: "prompt/audit?temprature=0.1", Offset: 13,
+			Msg: `unknown parameter "temprature", want one of assets, description, enum, example, format, maxOutputTokens, maxTokens, temperature, topK, topP, unit`},
+		{Field: "doc.Address", Tag: "group/places", Offset: 6,
+			Msg: `group "places" is not defined with WithGroup`},
+	}, verr.Errors, "embedded tags are reported once, promoted fields inherit their prompt")
+	assert.Equal(t, `doc.Address: unstruct:"group/places" at offset 6: group "places" is not defined with WithGroup`, verr.Errors[1].Error())
+
+	// Promoted fields are addressed by their declaring type
+	err = Validate[doc](WithGroup("places", "address", ""),
+		WithExtractionConfig(&ExtractionConfig{Fields: map[string]FieldOverride{
+			"Address.City": {Prompt: "cities"},
+		}}))
+	require.ErrorAs(t, err, &verr)
+	require.Len(t, verr.Errors, 1)
+	assert.Equal(t, "doc.audit", verr.Errors[0].Field)
+}